@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	botUC "github.com/usual2970/retell/internal/usecase/bot"
+	"github.com/usual2970/retell/internal/util/app"
+
+	"github.com/spf13/cobra"
+)
+
+// NewEssaysCommand 文章库的导出和导入命令, 用于备份和在部署之间迁移
+func NewEssaysCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "essays",
+		Short: "Export or import the essay library",
+	}
+	command.AddCommand(exportCommand(), importCommand())
+	return command
+}
+
+func exportCommand() *cobra.Command {
+	var user, output string
+	command := &cobra.Command{
+		Use:          "export",
+		Short:        "Export essays, words, review state and audio files as a zip archive",
+		Example:      "retell essays export --user learner@example.com -o backup.zip",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			req := &domain.ExportArchiveReq{All: user == ""}
+			if user != "" {
+				id, err := findUser(user)
+				if err != nil {
+					return err
+				}
+				req.User = id
+			}
+			if output == "" {
+				output = "retell-" + time.Now().Format("20060102") + ".zip"
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			rs, err := botUC.NewArchiveUsecase().Export(command.Context(), req, f)
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			fmt.Printf("exported %d essays and %d words to %s\n", rs.Essays, rs.Words, output)
+			return nil
+		},
+	}
+	command.Flags().StringVar(&user, "user", "", "id or email of the user to export, all essays when empty")
+	command.Flags().StringVarP(&output, "output", "o", "", "archive path, retell-<date>.zip by default")
+	return command
+}
+
+func importCommand() *cobra.Command {
+	var user string
+	command := &cobra.Command{
+		Use:          "import <archive.zip|folder>",
+		Short:        "Import an exported archive or a folder of Markdown files, skipping duplicated essays",
+		Example:      "retell essays import backup.zip --user learner@example.com",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			req := &domain.ImportArchiveReq{ImportWords: true}
+			if user != "" {
+				id, err := findUser(user)
+				if err != nil {
+					return err
+				}
+				req.User = id
+			}
+
+			info, err := os.Stat(args[0])
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				req.Files = os.DirFS(args[0])
+			} else {
+				zr, err := zip.OpenReader(args[0])
+				if err != nil {
+					return err
+				}
+				defer zr.Close()
+				req.Files = zr
+			}
+
+			rs, err := botUC.NewArchiveUsecase().Import(command.Context(), req)
+			if err != nil {
+				return err
+			}
+			for _, failure := range rs.Failed {
+				fmt.Printf("failed %s: %s\n", failure.Source, failure.Error)
+			}
+			fmt.Printf("imported %d essays and %d words, skipped %d duplicated essays\n", rs.Imported, rs.Words, rs.Duplicated)
+
+			// 等待封面、音频等资源生成完, 中断后会在下次启动服务时补做
+			if rs.Imported > 0 {
+				fmt.Println("generating covers, audio and vectors...")
+			}
+			return botUC.WaitBackground(command.Context())
+		},
+	}
+	command.Flags().StringVar(&user, "user", "", "id or email of the user who owns the imported essays")
+	return command
+}
+
+// findUser 按邮箱或 id 查找用户
+func findUser(user string) (string, error) {
+	if strings.Contains(user, "@") {
+		record, err := app.Get().FindAuthRecordByEmail("users", user)
+		if err != nil {
+			return "", fmt.Errorf("user %s not found", user)
+		}
+		return record.Id, nil
+	}
+
+	record, err := app.Get().FindRecordById("users", user)
+	if err != nil {
+		return "", fmt.Errorf("user %s not found", user)
+	}
+	return record.Id, nil
+}
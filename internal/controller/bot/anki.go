@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/resp"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type ankiController struct {
+	uc domain.IAnkiUsecase
+}
+
+// Export 下载 Anki 卡组, schedule=true 时保留单词的复习进度, 超级管理员可以用 user 参数指定用户
+func (c *ankiController) Export(ctx *core.RequestEvent) error {
+	query := ctx.Request.URL.Query()
+	req := &domain.AnkiExportReq{Schedule: query.Get("schedule") == "true"}
+	if !ctx.HasSuperuserAuth() {
+		req.User = ctx.Auth.Id
+	} else if user := query.Get("user"); user != "" {
+		req.User = user
+	} else {
+		req.All = true
+	}
+
+	tmp, err := os.CreateTemp("", "retell-anki-*.apkg")
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := c.uc.Export(ctx.Request.Context(), req, tmp); err != nil {
+		return resp.Err(ctx, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	name := "retell-" + time.Now().Format("20060102") + ".apkg"
+	ctx.Response.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	return ctx.Stream(http.StatusOK, "application/octet-stream", tmp)
+}
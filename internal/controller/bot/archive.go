@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/domain/constant"
+	"github.com/usual2970/retell/internal/util/resp"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxArchiveSize 上传的归档最大大小, 归档中包含音频
+const maxArchiveSize = 512 << 20
+
+type archiveController struct {
+	uc domain.IArchiveUsecase
+}
+
+// Export 下载文章库的 zip 归档, 超级管理员可以用 user 参数指定用户, 不指定时导出全部
+func (c *archiveController) Export(ctx *core.RequestEvent) error {
+	req := &domain.ExportArchiveReq{}
+	if !ctx.HasSuperuserAuth() {
+		req.User = ctx.Auth.Id
+	} else if user := ctx.Request.URL.Query().Get("user"); user != "" {
+		req.User = user
+	} else {
+		req.All = true
+	}
+
+	// 先写到临时文件, 导出失败时还能返回错误
+	tmp, err := os.CreateTemp("", "retell-export-*.zip")
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := c.uc.Export(ctx.Request.Context(), req, tmp); err != nil {
+		return resp.Err(ctx, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	name := "retell-" + time.Now().Format("20060102") + ".zip"
+	ctx.Response.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	return ctx.Stream(http.StatusOK, "application/zip", tmp)
+}
+
+// Import 上传 zip 归档导入文章, 表单字段为 file, 超级管理员可以用 user 字段指定所属用户
+func (c *archiveController) Import(ctx *core.RequestEvent) error {
+	file, header, err := ctx.Request.FormFile("file")
+	if err != nil {
+		return resp.Err(ctx, constant.ErrInvalidParams)
+	}
+	defer file.Close()
+
+	files, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		return resp.Err(ctx, constant.ErrInvalidParams)
+	}
+
+	req := &domain.ImportArchiveReq{Files: files}
+	if ctx.HasSuperuserAuth() {
+		req.User = ctx.Request.FormValue("user")
+		req.ImportWords = true
+	} else {
+		req.User = ctx.Auth.Id
+	}
+
+	rs, err := c.uc.Import(ctx.Request.Context(), req)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, rs)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/usual2970/retell/internal/domain"
 	"github.com/usual2970/retell/internal/util/resp"
 
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/router"
 )
@@ -13,23 +14,62 @@ type controller struct {
 }
 
 func (c *controller) Start(ctx *core.RequestEvent) error {
-	c.uc.Start(ctx.Request.Context())
-	return resp.Succ(ctx, nil)
+	if err := c.uc.Start(ctx.Request.Context()); err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, c.uc.Status(ctx.Request.Context()))
 }
 
 func (c *controller) Stop(ctx *core.RequestEvent) error {
-	c.uc.Stop(ctx.Request.Context())
-	return resp.Succ(ctx, nil)
+	if err := c.uc.Stop(ctx.Request.Context()); err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, c.uc.Status(ctx.Request.Context()))
 }
 
-func Register(route *router.Router[*core.RequestEvent], uc domain.IBotUsecase, essayUc domain.IessayUsecase) {
+func (c *controller) Restart(ctx *core.RequestEvent) error {
+	if err := c.uc.Restart(ctx.Request.Context()); err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, c.uc.Status(ctx.Request.Context()))
+}
+
+func (c *controller) Status(ctx *core.RequestEvent) error {
+	return resp.Succ(ctx, c.uc.Status(ctx.Request.Context()))
+}
+
+func Register(route *router.Router[*core.RequestEvent], uc domain.IBotUsecase, essayUc domain.IessayUsecase, ttsUc domain.ITtsUsecase, archiveUc domain.IArchiveUsecase, ankiUc domain.IAnkiUsecase) {
 	c := &controller{uc: uc}
 
 	group := route.Group("/api/v1/bot")
-	group.POST("/start", c.Start)
-	group.POST("/stop", c.Stop)
+	// notify 是语音合成服务的回调, 不能要求登录
+	group.POST("/start", c.Start).Bind(apis.RequireSuperuserAuth())
+	group.POST("/stop", c.Stop).Bind(apis.RequireSuperuserAuth())
+	group.POST("/restart", c.Restart).Bind(apis.RequireSuperuserAuth())
+	group.GET("/status", c.Status).Bind(apis.RequireSuperuserAuth())
 
 	essayController := &essayController{uc: essayUc}
 	group.POST("/notify", essayController.Notify)
 
+	essays := route.Group("/api/v1/essays")
+	essays.Bind(apis.RequireAuth("users", core.CollectionNameSuperusers))
+	essays.GET("", essayController.List)
+	essays.POST("", essayController.Create)
+	essays.GET("/search", essayController.Search)
+
+	archiveController := &archiveController{uc: archiveUc}
+	essays.GET("/export", archiveController.Export)
+	essays.POST("/import", archiveController.Import).Bind(apis.BodyLimit(maxArchiveSize))
+
+	ankiController := &ankiController{uc: ankiUc}
+	essays.GET("/anki", ankiController.Export)
+
+	essays.GET("/{id}", essayController.Detail)
+	essays.PATCH("/{id}", essayController.Update)
+	essays.DELETE("/{id}", essayController.Delete)
+	essays.POST("/{id}/regenerate", essayController.Regenerate)
+
+	ttsController := &ttsController{uc: ttsUc}
+	route.GET("/api/v1/tts/stats", ttsController.Stats).Bind(apis.RequireSuperuserAuth())
+
 }
@@ -1,11 +1,21 @@
 package bot
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/domain/constant"
+	"github.com/usual2970/retell/internal/util/resp"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
 type essayController struct {
 	uc domain.IessayUsecase
 }
@@ -17,3 +27,145 @@ func (c *essayController) Notify(ctx *core.RequestEvent) error {
 	}
 	return c.uc.Notify(ctx.Request.Context(), req)
 }
+
+func (c *essayController) Search(ctx *core.RequestEvent) error {
+	req := &domain.SearchEssayReq{
+		Query: ctx.Request.URL.Query().Get("q"),
+	}
+	if limit, err := strconv.Atoi(ctx.Request.URL.Query().Get("limit")); err == nil && limit > 0 {
+		req.Limit = min(limit, maxListLimit)
+	}
+	if ctx.HasSuperuserAuth() {
+		req.All = true
+	} else {
+		req.User = ctx.Auth.Id
+	}
+
+	rs, err := c.uc.Search(ctx.Request.Context(), req)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, rs)
+}
+
+// List 按游标分页, cursor 为上一页最后一篇文章的 id
+func (c *essayController) List(ctx *core.RequestEvent) error {
+	limit := defaultListLimit
+	if l, err := strconv.Atoi(ctx.Request.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxListLimit)
+	}
+
+	filters := []string{"deleted = ''"}
+	req := &domain.ListessayReq{
+		// 多取一条用来判断是否还有下一页
+		Limit:  limit + 1,
+		Params: map[string]any{},
+	}
+	if !ctx.HasSuperuserAuth() {
+		filters = append(filters, "user = {:user}")
+		req.Params["user"] = ctx.Auth.Id
+	}
+	if cursor := ctx.Request.URL.Query().Get("cursor"); cursor != "" {
+		filters = append(filters, "id < {:cursor}")
+		req.Params["cursor"] = cursor
+	}
+	req.Filter = strings.Join(filters, " && ")
+
+	essays, err := c.uc.List(ctx.Request.Context(), req)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	rs := &domain.ListessayResp{Items: essays}
+	if len(essays) > limit {
+		rs.Items = essays[:limit]
+		rs.NextCursor = rs.Items[limit-1].Id
+	}
+	return resp.Succ(ctx, rs)
+}
+
+func (c *essayController) Detail(ctx *core.RequestEvent) error {
+	essay, err := c.owned(ctx)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, essay)
+}
+
+func (c *essayController) Create(ctx *core.RequestEvent) error {
+	req := &domain.AddessayReq{}
+	if err := ctx.BindBody(req); err != nil {
+		return resp.Err(ctx, constant.ErrInvalidParams)
+	}
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+		return resp.Err(ctx, constant.ErrInvalidParams)
+	}
+
+	// 超级管理员不属于 users 集合, 创建的文章没有所属用户
+	if !ctx.HasSuperuserAuth() {
+		req.User = ctx.Auth.Id
+	}
+
+	essay, err := c.uc.Add(ctx.Request.Context(), req)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, essay)
+}
+
+func (c *essayController) Update(ctx *core.RequestEvent) error {
+	essay, err := c.owned(ctx)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	req := &domain.UpdateessayReq{}
+	if err := ctx.BindBody(req); err != nil {
+		return resp.Err(ctx, constant.ErrInvalidParams)
+	}
+	req.Id = essay.Id
+
+	rs, err := c.uc.Update(ctx.Request.Context(), req)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, rs)
+}
+
+func (c *essayController) Delete(ctx *core.RequestEvent) error {
+	essay, err := c.owned(ctx)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	if err := c.uc.Delete(ctx.Request.Context(), essay.Id); err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, nil)
+}
+
+// Regenerate 异步重新生成封面、音频等资源, 立即返回
+func (c *essayController) Regenerate(ctx *core.RequestEvent) error {
+	essay, err := c.owned(ctx)
+	if err != nil {
+		return resp.Err(ctx, err)
+	}
+
+	if err := c.uc.RegenerateAssets(ctx.Request.Context(), essay.Id); err != nil {
+		return resp.Err(ctx, err)
+	}
+	return resp.Succ(ctx, nil)
+}
+
+// owned 取出路径中的文章, 不属于当前用户或已在回收站时按不存在处理, 超级管理员不受所属用户限制
+func (c *essayController) owned(ctx *core.RequestEvent) (*domain.Essay, error) {
+	essay, err := c.uc.Detail(ctx.Request.Context(), ctx.Request.PathValue("id"))
+	if err != nil || !essay.Deleted.IsZero() {
+		return nil, constant.ErrNotFound
+	}
+
+	if !ctx.HasSuperuserAuth() && essay.User != ctx.Auth.Id {
+		return nil, constant.ErrNotFound
+	}
+	return essay, nil
+}
@@ -0,0 +1,16 @@
+package bot
+
+import (
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/resp"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type ttsController struct {
+	uc domain.ITtsUsecase
+}
+
+func (c *ttsController) Stats(ctx *core.RequestEvent) error {
+	return resp.Succ(ctx, c.uc.Stats(ctx.Request.Context()))
+}
@@ -0,0 +1,40 @@
+package health
+
+import (
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/resp"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+type controller struct {
+	uc domain.IHealthUsecase
+}
+
+func (c *controller) Health(ctx *core.RequestEvent) error {
+	return resp.Succ(ctx, nil)
+}
+
+func (c *controller) Ready(ctx *core.RequestEvent) error {
+	rs := c.uc.Ready(ctx.Request.Context())
+	if !rs.Ready {
+		return resp.Unavailable(ctx, rs)
+	}
+	return resp.Succ(ctx, rs)
+}
+
+func (c *controller) Diagnostics(ctx *core.RequestEvent) error {
+	return resp.Succ(ctx, c.uc.Diagnostics(ctx.Request.Context()))
+}
+
+func Register(route *router.Router[*core.RequestEvent], uc domain.IHealthUsecase) {
+	c := &controller{uc: uc}
+
+	group := route.Group("/api/v1")
+	group.GET("/health", c.Health)
+	group.GET("/ready", c.Ready)
+	// 探测会真实调用外部服务, 仅限超级管理员
+	group.GET("/diagnostics", c.Diagnostics).Bind(apis.RequireSuperuserAuth())
+}
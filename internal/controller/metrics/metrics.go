@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"github.com/usual2970/retell/internal/domain/constant"
+	"github.com/usual2970/retell/internal/util/metrics"
+	"github.com/usual2970/retell/internal/util/resp"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// requireToken 设置了 METRICS_TOKEN 时要求 Authorization: Bearer <token>
+func requireToken(token string) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		want := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(e.Request.Header.Get("Authorization")), []byte(want)) != 1 {
+			return resp.Err(e, constant.ErrAuthFailed)
+		}
+		return e.Next()
+	}
+}
+
+func Register(route *router.Router[*core.RequestEvent]) {
+	r := route.GET("/metrics", apis.WrapStdHandler(metrics.Handler()))
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		r.BindFunc(requireToken(token))
+	}
+}
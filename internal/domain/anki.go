@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"io"
+)
+
+// IAnkiUsecase 把单词和文章句子导出成 Anki 卡组
+type IAnkiUsecase interface {
+	// Export 生成 .apkg 写入 w, 没有可导出的内容时返回 constant.ErrNothingToExport
+	Export(ctx context.Context, req *AnkiExportReq, w io.Writer) (*AnkiExportResp, error)
+}
+
+type AnkiExportReq struct {
+	// User 只导出这个用户文章中的单词和句子, 为空时导出没有所属用户的文章
+	User string
+	// All 为 true 时导出全部, 忽略 User
+	All bool
+	// Schedule 为 true 时按单词的复习进度生成复习卡片, 否则都是新卡片
+	Schedule bool
+}
+
+type AnkiExportResp struct {
+	Words     int `json:"words"`
+	Sentences int `json:"sentences"`
+	// Audio 带发音的单词数量
+	Audio int `json:"audio"`
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// IArchiveUsecase 文章库的批量导出和导入, 用于备份和迁移
+type IArchiveUsecase interface {
+	// Export 把文章、单词、复习进度和媒体文件打包成 zip 写入 w
+	Export(ctx context.Context, req *ExportArchiveReq, w io.Writer) (*ExportArchiveResp, error)
+	// Import 导入归档或 Markdown 文件夹, 内容相同的文章只保留一篇
+	Import(ctx context.Context, req *ImportArchiveReq) (*ImportArchiveResp, error)
+}
+
+type ExportArchiveReq struct {
+	// User 只导出这个用户的文章, 为空时导出没有所属用户的文章
+	User string
+	// All 为 true 时导出全部文章, 忽略 User
+	All bool
+}
+
+type ExportArchiveResp struct {
+	Essays int `json:"essays"`
+	Words  int `json:"words"`
+}
+
+type ImportArchiveReq struct {
+	// User 导入的文章所属的用户
+	User string
+	// Files 解压后的归档或者本地文件夹
+	Files fs.FS
+	// ImportWords 是否导入单词和复习进度, 单词表所有用户共用, 只有超级管理员可以导入
+	ImportWords bool
+}
+
+type ImportFailure struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+type ImportArchiveResp struct {
+	Imported int `json:"imported"`
+	// Duplicated 内容和已有文章相同而跳过的数量
+	Duplicated int             `json:"duplicated"`
+	Words      int             `json:"words"`
+	Failed     []ImportFailure `json:"failed"`
+}
@@ -0,0 +1,8 @@
+package domain
+
+import "context"
+
+type IAssistantUsecase interface {
+	// Ask 回答学习者的问题, 期间可能调用查词、找文章、复习统计等工具
+	Ask(ctx context.Context, question string) (string, error)
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -9,9 +10,36 @@ import (
 type IBotUsecase interface {
 	Process(ctx context.Context) error
 
-	Start(ctx context.Context)
+	// Start 启动机器人, 已经在运行时直接返回
+	Start(ctx context.Context) error
 
-	Stop(ctx context.Context)
+	// Stop 停止机器人, 未运行时直接返回
+	Stop(ctx context.Context) error
+
+	Restart(ctx context.Context) error
+
+	Status(ctx context.Context) *BotStatus
+}
+
+const (
+	BotStateStopped  = "stopped"
+	BotStateStarting = "starting"
+	BotStateRunning  = "running"
+	BotStateStopping = "stopping"
+)
+
+type BotStatus struct {
+	State    string `json:"state"`
+	Running  bool   `json:"running"`
+	Username string `json:"username"`
+	// Uptime 运行时长, 单位秒
+	Uptime int64 `json:"uptime"`
+	// QueueDepth 已拉取但还未处理的更新数量
+	QueueDepth  int       `json:"queueDepth"`
+	LastError   string    `json:"lastError"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+	// LastPollAt 最近一次成功拉取更新的时间
+	LastPollAt time.Time `json:"lastPollAt"`
 }
 
 type Essay struct {
@@ -22,6 +50,9 @@ type Essay struct {
 	File      string `json:"file"`
 	Thumb     string `json:"thumb"`
 	Telegraph string `json:"telegraph"`
+	User      string `json:"user"`
+	// Deleted 移入回收站的时间, 未删除时为零值
+	Deleted time.Time `json:"deleted"`
 	Meta
 }
 
@@ -29,11 +60,65 @@ type ListessayReq struct {
 	Offset int
 	Limit  int
 	Filter string
+	// Params 过滤条件中 {:name} 占位符对应的参数
+	Params map[string]any
+}
+
+// 文章列表的排序方式
+const (
+	EssaySortNewest  = "newest"
+	EssaySortTitle   = "title"
+	EssaySortStudied = "studied" // 最久未学习的排在前面
+)
+
+type PageessayReq struct {
+	Sort      string
+	EssayType string
+	// Cursor 翻页的基准文章, 为空时取第一页
+	Cursor string
+	// Backward 为 true 时取 Cursor 之前的一页, 否则取之后的一页
+	Backward bool
+	// Trash 为 true 时只列出回收站里的文章
+	Trash bool
+	Limit int
+}
+
+type PageessayResp struct {
+	Items []Essay
+	Total int
+	// Page 当前页码, 从 1 开始
+	Page    int
+	Pages   int
+	HasPrev bool
+	HasNext bool
+	// Types 可以筛选的文章类型
+	Types []string
 }
 
 type AddessayReq struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	User    string `json:"-"`
+}
+
+type ListessayResp struct {
+	Items []Essay `json:"items"`
+	// NextCursor 下一页的游标, 为空表示没有更多
+	NextCursor string `json:"nextCursor"`
+}
+
+// EssayVersion 修改前的文章内容
+type EssayVersion struct {
+	EssayId string `json:"essayId"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Meta
+}
+
+type UpdateessayReq struct {
+	Id      string `json:"-"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
 }
 
 type TtsAsyncReq struct {
@@ -97,6 +182,8 @@ type TtsAsyncSentence struct {
 type TgChatItem struct {
 	Chat     tgbotapi.Chattable
 	Callback func(message tgbotapi.Message) error
+	// Fallback Chat 无法发送时(如编辑的消息已被删除或过期)改为发送的消息
+	Fallback tgbotapi.Chattable
 }
 
 type TgCallback func(message tgbotapi.Message) error
@@ -113,12 +200,72 @@ func NewTgChatItem(chat tgbotapi.Chattable, callback ...TgCallback) *TgChatItem
 }
 
 type IessayUsecase interface {
-	Add(ctx context.Context, req *AddessayReq) error
+	Add(ctx context.Context, req *AddessayReq) (*Essay, error)
+	// Update 更新标题或内容, 为空的字段保持不变, 旧内容保存为历史版本, 只重新生成受影响的资源
+	Update(ctx context.Context, req *UpdateessayReq) (*Essay, error)
+	// Versions 文章的历史版本, 最新的在前
+	Versions(ctx context.Context, id string) ([]EssayVersion, error)
+	Version(ctx context.Context, versionId string) (*EssayVersion, error)
+	// RestoreVersion 把文章恢复成某个历史版本, 当前内容同样会保存为历史版本
+	RestoreVersion(ctx context.Context, versionId string) (*Essay, error)
 	List(ctx context.Context, req *ListessayReq) ([]Essay, error)
+	// Delete 把文章移入回收站
 	Delete(ctx context.Context, id string) error
+	// Restore 从回收站恢复文章
+	Restore(ctx context.Context, id string) error
+	// Purge 彻底删除 before 之前移入回收站的文章及其文件, 返回删除的数量
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// Page 按排序方式和类型分页, 支持向前和向后翻页
+	Page(ctx context.Context, req *PageessayReq) (*PageessayResp, error)
+	// MarkStudied 记录最近一次学习文章的时间
+	MarkStudied(ctx context.Context, id string) error
+	// RegenerateAssets 异步重新生成封面、telegraph 页面、向量和音频
+	RegenerateAssets(ctx context.Context, id string) error
+	// ResumePending 启动时补做上次停机时中断的后台任务
+	ResumePending(ctx context.Context) error
 	Detail(ctx context.Context, id string) (*Essay, error)
 	Notify(ctx context.Context, req *TtsAsyncResp) error
 	UpdateFileId(ctx context.Context, id string, fileId string) error
 
 	CreateTelegraph(ctx context.Context, id string) error
+
+	// GenerateCover 生成文章封面, 图片接口失败时使用本地渲染的标题卡片
+	GenerateCover(ctx context.Context, id string) error
+	// RegenerateCover 重新生成封面并刷新 telegraph 页面
+	RegenerateCover(ctx context.Context, id string) error
+
+	// Explain 讲解文章中的语法, onChunk 不为空时以流式方式逐段回调
+	Explain(ctx context.Context, id string, onChunk func(ctx context.Context, chunk []byte) error) (string, error)
+
+	// Embed 为文章及其句子生成向量, 覆盖已有的向量
+	Embed(ctx context.Context, id string) error
+	// Search 结合向量相似度和关键词匹配搜索文章和句子
+	Search(ctx context.Context, req *SearchEssayReq) (*SearchEssayResp, error)
+}
+
+type SearchEssayReq struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+	// User 只检索这个用户的文章, 为空时检索没有所属用户的文章
+	User string `json:"-"`
+	// All 为 true 时检索全部文章, 忽略 User
+	All bool `json:"-"`
+}
+
+type EssayHit struct {
+	Id    string  `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+type SentenceHit struct {
+	EssayId    string  `json:"essayId"`
+	EssayTitle string  `json:"essayTitle"`
+	Text       string  `json:"text"`
+	Score      float64 `json:"score"`
+}
+
+type SearchEssayResp struct {
+	Essays    []EssayHit    `json:"essays"`
+	Sentences []SentenceHit `json:"sentences"`
 }
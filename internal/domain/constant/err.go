@@ -2,6 +2,12 @@ package constant
 
 var ErrAuthFailed = NewXError(4999, "auth failed")
 
+var ErrInvalidParams = NewXError(4000, "invalid params")
+
+var ErrNotFound = NewXError(4004, "not found")
+
+var ErrNothingToExport = NewXError(4010, "nothing to export")
+
 type XError struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
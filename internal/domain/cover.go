@@ -0,0 +1,17 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+type CoverReq struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// ICoverGenerator 生成文章封面, 可以是图片大模型也可以是本地渲染
+type ICoverGenerator interface {
+	Generate(ctx context.Context, req *CoverReq) (*filesystem.File, error)
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	CheckStatusOk      = "ok"
+	CheckStatusError   = "error"
+	CheckStatusSkipped = "skipped"
+)
+
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Latency 检查耗时, 单位毫秒
+	Latency int64  `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReadyResp struct {
+	Ready      bool          `json:"ready"`
+	Checks     []CheckResult `json:"checks"`
+	LastPollAt time.Time     `json:"lastPollAt"`
+}
+
+type DiagnosticsResp struct {
+	Providers []CheckResult `json:"providers"`
+}
+
+type IHealthUsecase interface {
+	// Ready 检查数据库和机器人轮询是否正常
+	Ready(ctx context.Context) *ReadyResp
+	// Diagnostics 逐个探测外部服务的凭证和连通性
+	Diagnostics(ctx context.Context) *DiagnosticsResp
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ILLM 大模型能力的统一抽象, 对话、向量和图片生成可以由不同的服务商或模型提供
+type ILLM interface {
+	llms.Model
+
+	CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+
+	// GenerateImg 根据提示词生成图片, 返回图片地址
+	GenerateImg(ctx context.Context, prompt string) (string, error)
+
+	// Vision 让多模态模型按提示词处理图片, 返回模型输出的文字
+	Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error)
+}
@@ -0,0 +1,8 @@
+package domain
+
+import "context"
+
+// IOcr 识别图片中的文字, 可以是多模态大模型也可以是本地引擎
+type IOcr interface {
+	Recognize(ctx context.Context, image []byte, mimeType string) (string, error)
+}
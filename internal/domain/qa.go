@@ -0,0 +1,26 @@
+package domain
+
+import "context"
+
+type AskReq struct {
+	Question string `json:"question"`
+	// EssayId 不为空时只在这篇文章中检索资料
+	EssayId string `json:"essayId"`
+}
+
+type Citation struct {
+	Index   int    `json:"index"`
+	EssayId string `json:"essayId"`
+	Title   string `json:"title"`
+	Text    string `json:"text"`
+}
+
+type AskResp struct {
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+type IQaUsecase interface {
+	// Ask 根据学习者自己的文章回答问题, 回答中用 [编号] 标注引用的资料
+	Ask(ctx context.Context, req *AskReq) (*AskResp, error)
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "context"
+
+// TgUser 机器人用户的个人设置
+type TgUser struct {
+	Meta
+	TgId int64 `json:"tgId"`
+	// Language 用户选择的界面语言, 为空时跟随 Telegram 客户端的语言
+	Language string `json:"language"`
+}
+
+type ITgUserRepository interface {
+	// Get 用户还没有保存过设置时返回 nil
+	Get(ctx context.Context, tgId int64) (*TgUser, error)
+	SaveLanguage(ctx context.Context, tgId int64, language string) error
+}
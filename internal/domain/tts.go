@@ -0,0 +1,29 @@
+package domain
+
+import "context"
+
+type TtsCache struct {
+	Meta
+	Key      string `json:"key"`
+	Provider string `json:"provider"`
+	Voice    string `json:"voice"`
+	Rate     string `json:"rate"`
+}
+
+type TtsCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+type ITtsCacheRepository interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Save(ctx context.Context, cache *TtsCache, data []byte) error
+}
+
+type ITtsUsecase interface {
+	// Speech 合成整段文本, 未命中缓存时整段一次合成, 按全文缓存
+	Speech(ctx context.Context, text string) ([]byte, error)
+	// SentenceSpeech 合成单个句子
+	SentenceSpeech(ctx context.Context, text string) ([]byte, error)
+	Stats(ctx context.Context) *TtsCacheStats
+}
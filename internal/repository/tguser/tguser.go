@@ -0,0 +1,71 @@
+package tguser
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const collectionName = "tg_users"
+
+var once sync.Once
+var instance domain.ITgUserRepository
+
+type repository struct{}
+
+func NewRepository() domain.ITgUserRepository {
+	once.Do(func() {
+		instance = &repository{}
+	})
+	return instance
+}
+
+func (r *repository) find(tgId int64) (*core.Record, error) {
+	record, err := app.Get().FindFirstRecordByFilter(collectionName, "tg_id = {:tg_id}", dbx.Params{"tg_id": tgId})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return record, err
+}
+
+func (r *repository) Get(ctx context.Context, tgId int64) (*domain.TgUser, error) {
+	record, err := r.find(tgId)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return &domain.TgUser{
+		Meta: domain.Meta{
+			Id:      record.Id,
+			Created: record.GetDateTime("created").Time(),
+			Updated: record.GetDateTime("updated").Time(),
+		},
+		TgId:     int64(record.GetInt("tg_id")),
+		Language: record.GetString("language"),
+	}, nil
+}
+
+func (r *repository) SaveLanguage(ctx context.Context, tgId int64, language string) error {
+	record, err := r.find(tgId)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		collection, err := app.Get().FindCollectionByNameOrId(collectionName)
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("tg_id", tgId)
+	}
+
+	record.Set("language", language)
+	return app.Get().Save(record)
+}
@@ -0,0 +1,69 @@
+package ttscache
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const collectionName = "tts_cache"
+
+var once sync.Once
+var instance domain.ITtsCacheRepository
+
+type repository struct{}
+
+func NewRepository() domain.ITtsCacheRepository {
+	once.Do(func() {
+		instance = &repository{}
+	})
+	return instance
+}
+
+func (r *repository) Get(ctx context.Context, key string) ([]byte, error) {
+	record, err := app.Get().FindFirstRecordByData(collectionName, "key", key)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := app.Get().NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Close()
+
+	reader, err := fs.GetReader(record.BaseFilesPath() + "/" + record.GetString("file"))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func (r *repository) Save(ctx context.Context, cache *domain.TtsCache, data []byte) error {
+	collection, err := app.Get().FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+
+	f, err := filesystem.NewFileFromBytes(data, cache.Key+".mp3")
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("key", cache.Key)
+	record.Set("provider", cache.Provider)
+	record.Set("voice", cache.Voice)
+	record.Set("rate", cache.Rate)
+	record.Set("file", []*filesystem.File{f})
+
+	return app.Get().Save(record)
+}
@@ -1,7 +1,11 @@
 package routes
 
 import (
+	"context"
+
+	"github.com/usual2970/retell/internal/domain"
 	botUC "github.com/usual2970/retell/internal/usecase/bot"
+	"github.com/usual2970/retell/internal/util/logger"
 
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -13,7 +17,9 @@ func OnessayUpdate(e *core.RecordRequestEvent) error {
 
 	uc := botUC.NewessayUsecase()
 
-	return uc.CreateTelegraph(e.Request.Context(), e.Record.Id)
+	embed(uc, e.Record.Id)
+
+	return uc.CreateTelegraph(logger.With(e.Request.Context(), "essay_id", e.Record.Id), e.Record.Id)
 }
 
 func OnessayCreate(e *core.RecordRequestEvent) error {
@@ -23,5 +29,33 @@ func OnessayCreate(e *core.RecordRequestEvent) error {
 
 	uc := botUC.NewessayUsecase()
 
-	return uc.CreateTelegraph(e.Request.Context(), e.Record.Id)
+	embed(uc, e.Record.Id)
+
+	// 没有上传封面时异步生成, 封面生成后再创建 telegraph 页面, 每篇文章只创建一次
+	if e.Record.GetString("thumb") == "" {
+		cover(uc, e.Record.Id)
+		return nil
+	}
+
+	return uc.CreateTelegraph(logger.With(e.Request.Context(), "essay_id", e.Record.Id), e.Record.Id)
+}
+
+// cover 异步生成文章封面并创建 telegraph 页面, 不阻塞请求
+func cover(uc domain.IessayUsecase, id string) {
+	ctx := logger.With(context.Background(), "essay_id", id)
+	botUC.Background(ctx, "cover", func(ctx context.Context) error {
+		// 封面生成失败也要创建页面, 只是没有封面
+		if err := uc.GenerateCover(ctx, id); err != nil {
+			logger.FromContext(ctx).Error("generate cover error:", "err", err)
+		}
+		return uc.CreateTelegraph(ctx, id)
+	})
+}
+
+// embed 异步更新文章向量, 不阻塞请求
+func embed(uc domain.IessayUsecase, id string) {
+	ctx := logger.With(context.Background(), "essay_id", id)
+	botUC.Background(ctx, "embed", func(ctx context.Context) error {
+		return uc.Embed(ctx, id)
+	})
 }
@@ -2,21 +2,39 @@ package routes
 
 import (
 	botUC "github.com/usual2970/retell/internal/usecase/bot"
+	healthUC "github.com/usual2970/retell/internal/usecase/health"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	"github.com/google/uuid"
 
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/router"
 
 	"github.com/usual2970/retell/internal/controller/bot"
+	"github.com/usual2970/retell/internal/controller/health"
+	"github.com/usual2970/retell/internal/controller/metrics"
 )
 
 func Route(router *router.Router[*core.RequestEvent]) {
 
+	// 为每个请求生成 request_id, 贯穿这次请求产生的所有日志
+	router.BindFunc(func(e *core.RequestEvent) error {
+		ctx := logger.With(e.Request.Context(), "request_id", uuid.NewString())
+		e.Request = e.Request.WithContext(ctx)
+		return e.Next()
+	})
+
 	uc, err := botUC.New()
 	if err != nil {
 		panic(err)
 	}
 
 	essayUc := botUC.NewessayUsecase()
-	bot.Register(router, uc, essayUc)
+	ttsUc := botUC.NewTtsUsecase()
+	bot.Register(router, uc, essayUc, ttsUc, botUC.NewArchiveUsecase(), botUC.NewAnkiUsecase())
+
+	health.Register(router, healthUC.New(uc))
+
+	metrics.Register(router)
 
 }
@@ -2,9 +2,19 @@ package routes
 
 import (
 	"context"
+	"time"
 
 	"github.com/usual2970/retell/internal/domain"
 	botUC "github.com/usual2970/retell/internal/usecase/bot"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/logger"
+)
+
+const (
+	// shutdownTimeout 停机时等待处理中任务的最长时间
+	shutdownTimeout = 25 * time.Second
+	// purgeCron 每天凌晨清理回收站
+	purgeCron = "0 3 * * *"
 )
 
 var botUc domain.IBotUsecase
@@ -12,15 +22,44 @@ var botUc domain.IBotUsecase
 func Register() error {
 	var err error
 	botUc, err = botUC.New()
+	if err != nil {
+		return err
+	}
+
+	// 启动失败不影响服务启动, 可以通过 /api/v1/bot/status 查看原因后重新启动
+	if err := botUc.Start(context.Background()); err != nil {
+		logger.FromContext(context.Background()).Error("start bot error:", "err", err)
+	}
+
+	botUC.Background(context.Background(), "resume", botUC.NewessayUsecase().ResumePending)
 
-	botUc.Start(context.Background())
+	app.Get().Cron().MustAdd("purgeEssays", purgeCron, purge)
 
-	return err
+	return nil
 }
 
+// purge 彻底删除在回收站中超过保留天数的文章
+func purge() {
+	botUC.Background(context.Background(), "purge", func(ctx context.Context) error {
+		before := time.Now().AddDate(0, 0, -botUC.TrashDays())
+		_, err := botUC.NewessayUsecase().Purge(ctx, before)
+		return err
+	})
+}
+
+// UnRegister 停机时停止接收更新, 等待处理中的更新和后台任务结束, 最多等待 shutdownTimeout
 func UnRegister() {
-	if botUc == nil {
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	log := logger.FromContext(ctx)
+	if botUc != nil {
+		if err := botUc.Stop(ctx); err != nil {
+			log.Error("stop bot error:", "err", err)
+		}
+	}
+
+	if err := botUC.WaitBackground(ctx); err != nil {
+		log.Error("wait background jobs error:", "err", err)
 	}
-	botUc.Stop(context.Background())
 }
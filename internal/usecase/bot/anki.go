@@ -0,0 +1,389 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/domain/constant"
+	"github.com/usual2970/retell/internal/util/anki"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/hash"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/str"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	ankiDeck         = "Retell"
+	ankiWordDeck     = "Retell::Words"
+	ankiSentenceDeck = "Retell::Sentences"
+	// maxAudioFailures 连续合成失败这么多次后不再给单词配音, 避免语音服务不可用时逐个超时
+	maxAudioFailures = 3
+	// minClozeLetters 句子中没有生词时挖空最长的单词, 太短的词不挖
+	minClozeLetters = 5
+	// maxClozes 一个句子最多挖空的生词数量
+	maxClozes = 3
+	// maxBotDocumentSize 机器人上传文件的大小限制
+	maxBotDocumentSize = 50 << 20
+)
+
+const ankiCSS = `.card { font-family: arial; font-size: 22px; text-align: center; color: #222; background: #fff; }
+.word { font-size: 32px; font-weight: bold; }
+.meaning { margin-top: 12px; }
+.example { margin-top: 12px; font-style: italic; color: #555; }
+.source { margin-top: 12px; font-size: 14px; color: #999; }
+.cloze { font-weight: bold; color: #1a73e8; }`
+
+// 笔记类型的 id 固定, 重复导入时 Anki 复用已有的笔记类型
+var (
+	ankiWordModel = &anki.Model{
+		ID:     1718000000001,
+		Name:   "Retell Word",
+		Fields: []string{"Word", "Meaning", "Example", "Audio", "Source"},
+		Front:  `<div class="word">{{Word}}</div>{{Audio}}`,
+		Back: `{{FrontSide}}<hr id=answer><div class="meaning">{{Meaning}}</div>` +
+			`{{#Example}}<div class="example">{{Example}}</div>{{/Example}}` +
+			`{{#Source}}<div class="source">{{Source}}</div>{{/Source}}`,
+		CSS: ankiCSS,
+	}
+	ankiClozeModel = &anki.Model{
+		ID:     1718000000002,
+		Name:   "Retell Cloze",
+		Cloze:  true,
+		Fields: []string{"Text", "Source"},
+		Front:  `{{cloze:Text}}`,
+		Back:   `{{cloze:Text}}{{#Source}}<div class="source">{{Source}}</div>{{/Source}}`,
+		CSS:    ankiCSS,
+	}
+)
+
+var tokenReg = regexp.MustCompile(`[A-Za-z]+(?:['’-][A-Za-z]+)*`)
+
+type ankiUsecase struct {
+	tts domain.ITtsUsecase
+}
+
+func NewAnkiUsecase() domain.IAnkiUsecase {
+	return &ankiUsecase{tts: NewTtsUsecase()}
+}
+
+// ankiEssay 导出用到的文章内容
+type ankiEssay struct {
+	title     string
+	essayType string
+	sentences []string
+}
+
+func (a *ankiUsecase) Export(ctx context.Context, req *domain.AnkiExportReq, w io.Writer) (*domain.AnkiExportResp, error) {
+	filter := "deleted = ''"
+	params := dbx.Params{}
+	if !req.All {
+		filter += " && " + ownerFilter(req.User, params)
+	}
+	records, err := app.Get().FindRecordsByFilter("essay", filter, "id", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+
+	essays := make(map[string]*ankiEssay, len(records))
+	for _, record := range records {
+		essays[record.Id] = &ankiEssay{
+			title:     record.GetString("title"),
+			essayType: record.GetString("essay_type"),
+			sentences: essaySentences(record),
+		}
+	}
+
+	// 单词表不区分用户, 按单词关联的文章归属
+	words, err := app.Get().FindRecordsByFilter("words", "deleted = ''", "word", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := anki.New(ankiDeck)
+	rs := &domain.AnkiExportResp{}
+	vocab := make(map[string]bool)
+	failures := 0
+	for _, word := range words {
+		essay := essays[word.GetString("essays")]
+		if essay == nil && !req.All {
+			continue
+		}
+		text := strings.TrimSpace(word.GetString("word"))
+		if text == "" {
+			continue
+		}
+		vocab[strings.ToLower(text)] = true
+
+		note := &anki.Note{
+			Model:  ankiWordModel,
+			Deck:   ankiWordDeck,
+			Fields: []string{anki.Escape(text), anki.Escape(meaningText(jsonField(word, "means"))), "", "", ""},
+			Tags:   append([]string{"retell"}, wordLabels(word)...),
+		}
+		if essay != nil {
+			note.Fields[2] = exampleSentence(essay.sentences, text)
+			note.Fields[4] = anki.Escape(essay.title)
+		}
+
+		if failures < maxAudioFailures {
+			data, err := a.tts.SentenceSpeech(ctx, text)
+			if err != nil {
+				failures++
+				logger.FromContext(ctx).Warn("anki word speech error:", "word", text, "err", err)
+			} else {
+				failures = 0
+				name := "retell-" + hash.Md5(strings.ToLower(text)) + ".mp3"
+				p.AddMedia(name, data)
+				note.Fields[3] = "[sound:" + name + "]"
+				rs.Audio++
+			}
+		}
+		if req.Schedule {
+			note.Schedule = wordSchedule(word)
+		}
+		p.Add(note)
+		rs.Words++
+	}
+
+	for _, record := range records {
+		essay := essays[record.Id]
+		tags := []string{"retell", "essay"}
+		if essay.essayType != "" {
+			tags = append(tags, essay.essayType)
+		}
+		for _, sentence := range essay.sentences {
+			text, n := clozeSentence(sentence, vocab)
+			if n == 0 {
+				continue
+			}
+			p.Add(&anki.Note{
+				Model:  ankiClozeModel,
+				Deck:   ankiSentenceDeck,
+				Fields: []string{text, anki.Escape(essay.title)},
+				Tags:   tags,
+			})
+			rs.Sentences++
+		}
+	}
+
+	if p.Len() == 0 {
+		return nil, constant.ErrNothingToExport
+	}
+	if err := p.Write(w); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("anki deck exported", "user", req.User, "words", rs.Words, "sentences", rs.Sentences, "audio", rs.Audio)
+	return rs, nil
+}
+
+// essaySentences 优先使用语音合成时切分的句子, 和音频里的断句一致
+func essaySentences(record *core.Record) []string {
+	items := make([]domain.TtsAsyncSentence, 0)
+	if raw := jsonField(record, "sentences"); raw != nil {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			items = items[:0]
+		}
+	}
+
+	rs := make([]string, 0, len(items))
+	for _, item := range items {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			rs = append(rs, text)
+		}
+	}
+	if len(rs) == 0 {
+		rs = str.Sentences(record.GetString("content"))
+	}
+	return rs
+}
+
+func wordLabels(word *core.Record) []string {
+	labels := make([]string, 0)
+	if raw := jsonField(word, "labels"); raw != nil {
+		_ = json.Unmarshal(raw, &labels)
+	}
+	return labels
+}
+
+// wordSchedule 把单词的 SM-2 复习进度换成卡片的进度, 没有复习过的仍是新卡片
+func wordSchedule(word *core.Record) *anki.Schedule {
+	reps := word.GetFloat("repetions")
+	interval := word.GetFloat("interval")
+	if reps <= 0 || interval <= 0 {
+		return nil
+	}
+
+	due := word.GetDateTime("need_review_at").Time()
+	if due.IsZero() {
+		due = time.Now()
+	}
+	return &anki.Schedule{
+		Due:      due,
+		Interval: max(int(math.Round(interval)), 1),
+		Ease:     word.GetFloat("eassiness"),
+		Reps:     int(reps),
+	}
+}
+
+// meaningText 释义是大模型生成的 json, 结构不固定, 按字符串、数组、对象逐层展开
+func meaningText(raw json.RawMessage) string {
+	if raw == nil {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(flattenMeaning(v))
+}
+
+func flattenMeaning(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		lines := make([]string, 0, len(v))
+		for _, item := range v {
+			if line := flattenMeaning(item); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if part := flattenMeaning(v[key]); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// exampleSentence 文章中第一个包含该单词的句子, 单词加粗
+func exampleSentence(sentences []string, word string) string {
+	reg, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
+	if err != nil {
+		return ""
+	}
+	for _, sentence := range sentences {
+		if loc := reg.FindStringIndex(sentence); loc != nil {
+			return anki.Escape(sentence[:loc[0]]) + "<b>" + anki.Escape(sentence[loc[0]:loc[1]]) + "</b>" + anki.Escape(sentence[loc[1]:])
+		}
+	}
+	return ""
+}
+
+// clozeSentence 挖空句子中的生词, 同一个词共用一个序号; 没有生词时挖空最长的单词, 返回挖空的数量
+func clozeSentence(sentence string, vocab map[string]bool) (string, int) {
+	tokens := tokenReg.FindAllStringIndex(sentence, -1)
+
+	ords := make(map[string]int)
+	for _, loc := range tokens {
+		word := strings.ToLower(sentence[loc[0]:loc[1]])
+		if vocab[word] && ords[word] == 0 && len(ords) < maxClozes {
+			ords[word] = len(ords) + 1
+		}
+	}
+	if len(ords) == 0 {
+		longest := ""
+		for _, loc := range tokens {
+			if word := sentence[loc[0]:loc[1]]; len(word) >= minClozeLetters && len(word) > len(longest) {
+				longest = word
+			}
+		}
+		if longest == "" {
+			return "", 0
+		}
+		ords[strings.ToLower(longest)] = 1
+	}
+
+	b := strings.Builder{}
+	last := 0
+	for _, loc := range tokens {
+		token := sentence[loc[0]:loc[1]]
+		n := ords[strings.ToLower(token)]
+		if n == 0 {
+			continue
+		}
+		b.WriteString(anki.Escape(sentence[last:loc[0]]))
+		b.WriteString(anki.Cloze(n, anki.Escape(token)))
+		last = loc[1]
+	}
+	b.WriteString(anki.Escape(sentence[last:]))
+	return b.String(), len(ords)
+}
+
+func (s *Session) ankiMenu(update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.T("anki.new"), "ankinew"),
+			tgbotapi.NewInlineKeyboardButtonData(s.T("anki.review"), "ankireview"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.T("common.menu"), "return2menu"),
+		),
+	)
+	return []domain.TgChatItem{s.edit(update, s.T("anki.menu"), "", &keyboards)}, nil
+}
+
+// exportAnki 生成卡组后作为文件发送, 生成可能需要逐个合成单词发音, 先回复一条进度消息
+func (s *Session) exportAnki(ctx context.Context, update tgbotapi.Update, schedule bool) ([]domain.TgChatItem, error) {
+	chatID := update.CallbackQuery.From.ID
+	l := s.localizer()
+	reply := tgbotapi.NewMessage(chatID, l.T("anki.loading"))
+
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply, func(message tgbotapi.Message) error {
+		editor := newStreamEditor(ctx, s.dispatcher, message)
+		buf := &bytes.Buffer{}
+		rs, err := NewAnkiUsecase().Export(ctx, &domain.AnkiExportReq{All: true, Schedule: schedule}, buf)
+		if errors.Is(err, constant.ErrNothingToExport) {
+			editor.Fail(l.T("anki.empty"))
+			return nil
+		}
+		if err != nil {
+			editor.Fail(l.T("anki.failed"))
+			return err
+		}
+		if buf.Len() > maxBotDocumentSize {
+			editor.Fail(l.T("anki.too_large", "/api/v1/essays/anki"))
+			return nil
+		}
+
+		editor.Write(ctx, []byte(l.T("anki.done", l.N("anki.words", rs.Words), l.N("anki.sentences", rs.Sentences))))
+		if err := editor.Close(); err != nil {
+			return err
+		}
+
+		doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+			Name:  "retell-" + time.Now().Format("20060102") + ".apkg",
+			Bytes: buf.Bytes(),
+		})
+		return s.send(ctx, *domain.NewTgChatItem(doc))
+	})}, nil
+}
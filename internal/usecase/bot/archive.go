@@ -0,0 +1,357 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/archive"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// importWorkers 导入后同时生成资源的文章数, 所有导入共用.
+// 生成资源要调用外部接口, 大归档不能一次全部开始.
+const importWorkers = 2
+
+var importSlots = make(chan struct{}, importWorkers)
+
+type archiveUsecase struct {
+	essay *essayUsecase
+}
+
+func NewArchiveUsecase() domain.IArchiveUsecase {
+	return &archiveUsecase{essay: newEssayUsecase()}
+}
+
+// ownerFilter 按所属用户过滤, 空字符串参数匹配不到空值, 没有所属用户时直接写空字符串
+func ownerFilter(user string, params dbx.Params) string {
+	if user == "" {
+		return "user = ''"
+	}
+	params["user"] = user
+	return "user = {:user}"
+}
+
+func (a *archiveUsecase) Export(ctx context.Context, req *domain.ExportArchiveReq, w io.Writer) (*domain.ExportArchiveResp, error) {
+	filter := "deleted = ''"
+	params := dbx.Params{}
+	if !req.All {
+		filter += " && " + ownerFilter(req.User, params)
+	}
+	// 列表按 id 倒序展示, 导出时按 id 顺序, 导入后文章的先后顺序不变
+	records, err := app.Get().FindRecordsByFilter("essay", filter, "id", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := app.Get().NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	writer := archive.NewWriter(w)
+	rs := &domain.ExportArchiveResp{}
+	for _, record := range records {
+		essay, media, err := exportEssay(ctx, fsys, record)
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.Add(essay, media); err != nil {
+			return nil, err
+		}
+		rs.Essays++
+		rs.Words += len(essay.Words)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("essays exported", "user", req.User, "essays", rs.Essays, "words", rs.Words)
+	return rs, nil
+}
+
+func exportEssay(ctx context.Context, fsys *filesystem.System, record *core.Record) (*archive.Essay, map[string][]byte, error) {
+	essay := &archive.Essay{
+		Title:     record.GetString("title"),
+		Content:   record.GetString("content"),
+		Type:      record.GetString("essay_type"),
+		VideoLink: record.GetString("video_link"),
+		Sentences: jsonField(record, "sentences"),
+		StudiedAt: record.GetDateTime("studied_at").Time(),
+	}
+
+	media := map[string][]byte{}
+	// 文件缺失时只导出文字, 导入后会重新生成
+	if data, name := readMedia(ctx, fsys, record, "file", "audio"); data != nil {
+		essay.Audio = name
+		media[name] = data
+	}
+	if data, name := readMedia(ctx, fsys, record, "thumb", "cover"); data != nil {
+		essay.Cover = name
+		media[name] = data
+	}
+	// 没有音频时句子的时间轴也没有意义
+	if essay.Audio == "" {
+		essay.Sentences = nil
+	}
+
+	words, err := app.Get().FindRecordsByFilter("words", "essays = {:essay} && deleted = ''", "word", 0, 0, dbx.Params{"essay": record.Id})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, word := range words {
+		essay.Words = append(essay.Words, archive.Word{
+			Word:         word.GetString("word"),
+			Labels:       jsonField(word, "labels"),
+			Means:        jsonField(word, "means"),
+			Proficiency:  word.GetString("proficiency"),
+			NeedReviewAt: word.GetDateTime("need_review_at").Time(),
+			Repetitions:  word.GetFloat("repetions"),
+			Interval:     word.GetFloat("interval"),
+			Easiness:     word.GetFloat("eassiness"),
+		})
+	}
+	return essay, media, nil
+}
+
+// readMedia 读取记录中的文件, 在归档中重命名为 name 加原来的扩展名
+func readMedia(ctx context.Context, fsys *filesystem.System, record *core.Record, field string, name string) ([]byte, string) {
+	file := record.GetString(field)
+	if file == "" {
+		return nil, ""
+	}
+
+	reader, err := fsys.GetReader(record.BaseFilesPath() + "/" + file)
+	if err != nil {
+		logger.FromContext(ctx).Warn("read essay file error:", "essay_id", record.Id, "field", field, "err", err)
+		return nil, ""
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		logger.FromContext(ctx).Warn("read essay file error:", "essay_id", record.Id, "field", field, "err", err)
+		return nil, ""
+	}
+	return data, name + path.Ext(file)
+}
+
+func jsonField(record *core.Record, field string) json.RawMessage {
+	raw, _ := record.Get(field).(types.JSONRaw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return json.RawMessage(raw)
+}
+
+func (a *archiveUsecase) Import(ctx context.Context, req *domain.ImportArchiveReq) (*domain.ImportArchiveResp, error) {
+	entries, err := archive.Read(req.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := essayHashes(req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	log := logger.FromContext(ctx)
+	rs := &domain.ImportArchiveResp{Failed: make([]domain.ImportFailure, 0)}
+	pending := make([]importedEssay, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Err != nil {
+			rs.Failed = append(rs.Failed, domain.ImportFailure{Source: entry.Source, Error: entry.Err.Error()})
+			continue
+		}
+		if hashes[entry.Hash] {
+			rs.Duplicated++
+			continue
+		}
+
+		id, words, assets, err := a.importEssay(ctx, req, entry)
+		if err != nil {
+			log.Error("import essay error:", "source", entry.Source, "err", err)
+			rs.Failed = append(rs.Failed, domain.ImportFailure{Source: entry.Source, Error: err.Error()})
+			continue
+		}
+		hashes[entry.Hash] = true
+		rs.Imported++
+		rs.Words += words
+		pending = append(pending, importedEssay{id: id, assets: assets})
+	}
+
+	log.Info("essays imported", "user", req.User, "imported", rs.Imported, "duplicated", rs.Duplicated, "words", rs.Words, "failed", len(rs.Failed))
+	a.generate(ctx, pending)
+	return rs, nil
+}
+
+type importedEssay struct {
+	id     string
+	assets asset
+}
+
+// generate 在后台依次生成导入文章缺失的资源, 同时进行的不超过 importWorkers 篇
+func (a *archiveUsecase) generate(ctx context.Context, essays []importedEssay) {
+	if len(essays) == 0 {
+		return
+	}
+
+	Background(ctx, "import", func(ctx context.Context) error {
+		wg := &sync.WaitGroup{}
+		for _, essay := range essays {
+			importSlots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-importSlots
+					wg.Done()
+				}()
+				ctx := logger.With(ctx, "essay_id", essay.id)
+				if err := a.essay.generate(ctx, essay.id, essay.assets); err != nil {
+					logger.FromContext(ctx).Error("generate imported essay error:", "err", err)
+				}
+			}()
+		}
+		wg.Wait()
+		return nil
+	})
+}
+
+// essayHashes 用户已有文章的内容哈希, 回收站里的文章不算
+func essayHashes(user string) (map[string]bool, error) {
+	params := dbx.Params{}
+	records, err := app.Get().FindRecordsByFilter("essay", "deleted = '' && "+ownerFilter(user, params), "", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make(map[string]bool, len(records))
+	for _, record := range records {
+		rs[archive.Hash(record.GetString("content"))] = true
+	}
+	return rs, nil
+}
+
+// importEssay 保存文章和单词, 返回需要重新生成的资源; 归档中带了音频和封面时不再重新生成
+func (a *archiveUsecase) importEssay(ctx context.Context, req *domain.ImportArchiveReq, entry *archive.Entry) (string, int, asset, error) {
+	collection, err := app.Get().FindCollectionByNameOrId("essay")
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("title", entry.Title)
+	record.Set("content", entry.Content)
+	record.Set("user", req.User)
+	record.Set("essay_type", entry.Type)
+	record.Set("video_link", entry.VideoLink)
+	if !entry.StudiedAt.IsZero() {
+		record.Set("studied_at", entry.StudiedAt)
+	}
+
+	// telegraph 页面中的封面地址指向原来的部署, 需要重新创建
+	assets := assetTelegraph | assetVectors
+	if f := entryFile(ctx, entry, entry.Audio); f != nil {
+		record.Set("file", f)
+		if entry.Sentences != nil {
+			record.Set("sentences", types.JSONRaw(entry.Sentences))
+		}
+	} else {
+		assets |= assetAudio
+	}
+	if f := entryFile(ctx, entry, entry.Cover); f != nil {
+		record.Set("thumb", f)
+	} else {
+		assets |= assetCover
+	}
+
+	words := 0
+	err = app.Get().RunInTransaction(func(txApp core.App) error {
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		if !req.ImportWords {
+			return nil
+		}
+		count, err := importWords(txApp, record.Id, entry.Words)
+		words = count
+		return err
+	})
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return record.Id, words, assets, nil
+}
+
+func entryFile(ctx context.Context, entry *archive.Entry, name string) *filesystem.File {
+	if name == "" {
+		return nil
+	}
+	data, err := entry.Media(name)
+	if err == nil {
+		var f *filesystem.File
+		if f, err = filesystem.NewFileFromBytes(data, name); err == nil {
+			return f
+		}
+	}
+	logger.FromContext(ctx).Warn("read archive file error:", "source", entry.Source, "file", name, "err", err)
+	return nil
+}
+
+// importWords 保存文章的单词和复习进度, 单词表不区分用户, 已经有的单词保留原来的进度
+func importWords(txApp core.App, essayId string, words []archive.Word) (int, error) {
+	if len(words) == 0 {
+		return 0, nil
+	}
+
+	collection, err := txApp.FindCollectionByNameOrId("words")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, word := range words {
+		if word.Word == "" {
+			continue
+		}
+		exists, err := txApp.FindRecordsByFilter("words", "word = {:word} && deleted = ''", "", 1, 0, dbx.Params{"word": word.Word})
+		if err != nil {
+			return 0, err
+		}
+		if len(exists) > 0 {
+			continue
+		}
+
+		record := core.NewRecord(collection)
+		record.Set("word", word.Word)
+		record.Set("essays", essayId)
+		record.Set("proficiency", word.Proficiency)
+		record.Set("repetions", word.Repetitions)
+		record.Set("interval", word.Interval)
+		record.Set("eassiness", word.Easiness)
+		if word.Labels != nil {
+			record.Set("labels", types.JSONRaw(word.Labels))
+		}
+		if word.Means != nil {
+			record.Set("means", types.JSONRaw(word.Means))
+		}
+		if !word.NeedReviewAt.IsZero() {
+			record.Set("need_review_at", word.NeedReviewAt)
+		}
+		if err := txApp.Save(record); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/agent"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/llm"
+
+	"github.com/pocketbase/dbx"
+)
+
+const assistantPrompt = `你是一个英语学习助手, 帮助学习者背诵英语短文和记忆单词.
+回答学习者的问题时, 需要用到学习者自己的单词本、文章或复习情况时请调用工具, 不要编造数据.
+请用中文简洁地回答.`
+
+const findEssayLimit = 5
+
+type assistantUsecase struct {
+	agent *agent.Agent
+}
+
+func NewAssistantUsecase() domain.IAssistantUsecase {
+	return &assistantUsecase{
+		agent: agent.New(llm.Default(), assistantPrompt,
+			agent.Tool{
+				Name:        "lookup_word",
+				Description: "在学习者的单词本中查询一个单词的释义、标签、熟练度和下次复习时间",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"word": map[string]any{"type": "string", "description": "要查询的英文单词"},
+					},
+					"required": []string{"word"},
+				},
+				Handler: lookupWord,
+			},
+			agent.Tool{
+				Name:        "find_essay",
+				Description: "按关键词在学习者的文章中查找, 返回匹配文章的标题和开头片段",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"keyword": map[string]any{"type": "string", "description": "标题或正文中的关键词"},
+					},
+					"required": []string{"keyword"},
+				},
+				Handler: findEssay,
+			},
+			agent.Tool{
+				Name:        "review_stats",
+				Description: "查询学习者单词复习的统计: 单词总数、待复习数量以及各熟练度的数量",
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": map[string]any{},
+				},
+				Handler: reviewStats,
+			},
+		),
+	}
+}
+
+func (a *assistantUsecase) Ask(ctx context.Context, question string) (string, error) {
+	return a.agent.Run(ctx, question)
+}
+
+func lookupWord(ctx context.Context, arguments string) (string, error) {
+	args := struct {
+		Word string `json:"word"`
+	}{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", err
+	}
+	if args.Word == "" {
+		return "", errors.New("word is required")
+	}
+
+	records, err := app.Get().FindRecordsByFilter("words", "word = {:word} && deleted = ''", "", 1, 0,
+		dbx.Params{"word": strings.TrimSpace(args.Word)})
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "单词本中没有这个单词", nil
+	}
+
+	record := records[0]
+	rs := map[string]any{
+		"word":           record.GetString("word"),
+		"means":          record.Get("means"),
+		"labels":         record.Get("labels"),
+		"proficiency":    record.GetString("proficiency"),
+		"need_review_at": record.GetString("need_review_at"),
+	}
+	if essayId := record.GetString("essays"); essayId != "" {
+		if essay, err := app.Get().FindRecordById("essay", essayId); err == nil {
+			rs["essay"] = essay.GetString("title")
+		}
+	}
+
+	bts, err := json.Marshal(rs)
+	return string(bts), err
+}
+
+func findEssay(ctx context.Context, arguments string) (string, error) {
+	args := struct {
+		Keyword string `json:"keyword"`
+	}{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", err
+	}
+
+	records, err := app.Get().FindRecordsByFilter("essay", "deleted = '' && (title ~ {:keyword} || content ~ {:keyword})", "-id", findEssayLimit, 0,
+		dbx.Params{"keyword": args.Keyword})
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "没有找到相关文章", nil
+	}
+
+	rs := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		content := []rune(record.GetString("content"))
+		if len(content) > 100 {
+			content = content[:100]
+		}
+		rs = append(rs, map[string]string{
+			"title":   record.GetString("title"),
+			"snippet": string(content),
+		})
+	}
+
+	bts, err := json.Marshal(rs)
+	return string(bts), err
+}
+
+// wordStat 单词复习的统计, 学习助手和 /stats 共用
+type wordStat struct {
+	Total       int64            `json:"total"`
+	Due         int64            `json:"due"`
+	Proficiency map[string]int64 `json:"proficiency"`
+}
+
+// proficiencyLevels 单词熟练度的取值
+var proficiencyLevels = []string{"0", "1", "2", "3", "4", "5"}
+
+func countWords() (*wordStat, error) {
+	total, err := app.Get().CountRecords("words", dbx.HashExp{"deleted": ""})
+	if err != nil {
+		return nil, err
+	}
+
+	due, err := app.Get().CountRecords("words",
+		dbx.HashExp{"deleted": ""},
+		dbx.NewExp("need_review_at != '' AND need_review_at <= strftime('%Y-%m-%d %H:%M:%fZ')"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	proficiency := make(map[string]int64)
+	for _, level := range proficiencyLevels {
+		count, err := app.Get().CountRecords("words", dbx.HashExp{"deleted": "", "proficiency": level})
+		if err != nil {
+			return nil, err
+		}
+		proficiency[level] = count
+	}
+
+	return &wordStat{Total: total, Due: due, Proficiency: proficiency}, nil
+}
+
+func reviewStats(ctx context.Context, arguments string) (string, error) {
+	stat, err := countWords()
+	if err != nil {
+		return "", err
+	}
+
+	bts, err := json.Marshal(stat)
+	return string(bts), err
+}
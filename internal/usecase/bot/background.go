@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"context"
+	"sync"
+
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/metrics"
+)
+
+// background 正在运行的后台任务, 停机时等待它们结束
+var background sync.WaitGroup
+
+// Background 在后台执行任务, 不随 ctx 取消, 但保留 ctx 中的日志关联字段
+func Background(ctx context.Context, job string, fn func(ctx context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer metrics.TrackJob(job)()
+
+		if err := fn(ctx); err != nil {
+			logger.FromContext(ctx).Error("background job error:", "job", job, "err", err)
+			return
+		}
+		logger.FromContext(ctx).Info("background job success", "job", job)
+	}()
+}
+
+// WaitBackground 等待所有后台任务结束, ctx 到期时返回 ctx 的错误
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
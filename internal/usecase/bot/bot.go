@@ -2,120 +2,456 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/usual2970/retell/internal/domain"
-	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/dispatcher"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/metrics"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-const processNum = 10
+const (
+	processNum = 10
+
+	// pollTimeout 长轮询 getUpdates 的超时时间, 单位秒
+	pollTimeout       = 30
+	pollRetryInterval = 3 * time.Second
+	// pollBusyInterval 拉到的都是还在处理的更新时, 等一会儿再拉, 避免空转
+	pollBusyInterval = time.Second
+	pollBuffer       = 100
+	// stopTimeout 停止时等待处理中的更新的最长时间, 超时后不再等待, 未确认的更新下次启动时重新推送
+	stopTimeout = 20 * time.Second
+)
+
+// botRun 一次启动的机器人和发送队列.
+// 工作协程只用自己这次的, 停止超时后仍在运行的旧协程不会读到下一次启动写入的字段.
+type botRun struct {
+	bot        *tgbotapi.BotAPI
+	dispatcher *dispatcher.Dispatcher
+	ch         chan job
+}
+
+// job 投递给工作协程的更新, 处理完后调用 done
+type job struct {
+	update tgbotapi.Update
+	done   func()
+}
+
+// ctxClient 请求随 ctx 取消, 用于在停止时中断长轮询
+type ctxClient struct {
+	ctx    context.Context
+	client tgbotapi.HTTPClient
+}
+
+func (c *ctxClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
 
 var ucOnce sync.Once
 
 var instance domain.IBotUsecase
 
 type usecase struct {
-	ch        tgbotapi.UpdatesChannel
-	bot       *tgbotapi.BotAPI
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
-	isRunning bool
+	ch  chan job
+	bot *tgbotapi.BotAPI
+	// dispatcher 限速并按聊天顺序发送回复
+	dispatcher *dispatcher.Dispatcher
+	cancel     context.CancelFunc
+	// abort 停止超时后中断仍在处理的更新
+	abort context.CancelFunc
+	// wg 本次运行的轮询和工作协程
+	wg *sync.WaitGroup
+	// offset 下一个需要确认的 update id, 小于它的更新都已处理完
+	offset    int
+	state     string
+	startedAt time.Time
+	lastErr   error
+	lastErrAt time.Time
+	// lastPollAt 最近一次成功调用 getUpdates 的时间
+	lastPollAt time.Time
+
+	// op 保证启动和停止串行执行
+	op sync.Mutex
 	sync.RWMutex
 }
 
 func New() (domain.IBotUsecase, error) {
 	ucOnce.Do(func() {
-		instance = &usecase{}
+		uc := &usecase{state: domain.BotStateStopped}
+
+		metrics.GaugeFunc("update_queue_depth", "Updates fetched but not yet handled.", func() float64 {
+			return float64(uc.Status(context.Background()).QueueDepth)
+		})
+		metrics.GaugeFunc("outbound_queue_depth", "Replies waiting to be sent to Telegram.", func() float64 {
+			if d := uc.getDispatcher(); d != nil {
+				return float64(d.Pending())
+			}
+			return 0
+		})
+		metrics.GaugeFunc("active_sessions", "Chat sessions kept in memory.", func() float64 {
+			return float64(GetSessions().Len())
+		})
+
+		instance = uc
 	})
 
 	return instance, nil
 }
 
 func (u *usecase) Process(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case update := <-u.ch:
-
-			session := GetSession(update, u.bot)
-			reply, err := session.Process(ctx, update)
-			if err != nil {
-				app.Get().Logger().Info("process update error: %v", err)
-				continue
-			}
+	u.RLock()
+	run := &botRun{bot: u.bot, dispatcher: u.dispatcher, ch: u.ch}
+	u.RUnlock()
 
-			for _, item := range reply {
-				rs, err := u.bot.Send(item.Chat)
-				if err != nil {
-					app.Get().Logger().Info("send item error:", "err", err, "rs", rs, "item", item.Chat)
-				} else {
-					app.Get().Logger().Info("send item success:", "rs", rs, "item", item.Chat)
-				}
-
-				if item.Callback != nil && err == nil {
-					if err := item.Callback(rs); err != nil {
-						app.Get().Logger().Info("send callback error:", "err", err)
-					}
-				}
-			}
+	return u.process(ctx, run)
+}
+
+func (u *usecase) process(ctx context.Context, run *botRun) error {
+	// ch 由轮询协程在停止时关闭
+	for j := range run.ch {
+		// 停止超时被中断后不再处理, 也不标记完成, 这些更新不会被确认
+		if ctx.Err() != nil {
+			continue
+		}
 
+		u.handleJob(ctx, run, j)
+	}
+	return ctx.Err()
+}
+
+func (u *usecase) handleJob(ctx context.Context, run *botRun, j job) {
+	defer j.done()
+	defer func() {
+		if r := recover(); r != nil {
+			u.setError(fmt.Errorf("panic: %v", r))
+			logger.FromContext(ctx).Error("handle update panic:", "err", r, "update_id", j.update.UpdateID)
 		}
+	}()
+
+	metrics.UpdatesReceived.WithLabelValues(updateType(j.update)).Inc()
+
+	// 只处理消息和按钮回调, 其他类型的更新(编辑消息等)直接忽略
+	if j.update.Message == nil && j.update.CallbackQuery == nil {
+		return
 	}
 
+	u.handle(ctx, run, j.update)
 }
 
-func (u *usecase) Start(ctx context.Context) {
+func (u *usecase) handle(ctx context.Context, run *botRun, update tgbotapi.Update) {
+	start := time.Now()
+	session := GetSession(update, run.bot, run.dispatcher)
+	handler := session.handlerName(update)
 
-	u.RLock()
-	if u.isRunning {
-		u.RUnlock()
+	ctx = logger.With(ctx, "update_id", update.UpdateID, "chat_id", session.ChatID, "handler", handler)
+	log := logger.FromContext(ctx)
+
+	reply, err := session.Process(ctx, update)
+	if update.CallbackQuery != nil {
+		u.answerCallback(ctx, run.bot, update.CallbackQuery, session.localizer(), err)
+	}
+	if err != nil {
+		metrics.HandlerDuration.WithLabelValues(handler, metrics.StatusError).Observe(time.Since(start).Seconds())
+		u.setError(err)
+		log.Error("process update error:", "err", err)
 		return
 	}
-	u.RUnlock()
+
+	// 等回复发完再结束, 停止时已确认的更新不会丢回复
+	if err := run.dispatcher.Dispatch(ctx, session.ChatID, reply); err != nil {
+		u.setError(err)
+	}
+
+	metrics.HandlerDuration.WithLabelValues(handler, metrics.StatusOk).Observe(time.Since(start).Seconds())
+}
+
+// answerCallback 按钮回调都要应答, 否则客户端按钮会一直转圈, 出错时弹出提示
+func (u *usecase) answerCallback(ctx context.Context, bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, l *i18n.Localizer, err error) {
+	text := ""
+	if err != nil {
+		text = callbackToast(l, err)
+	}
+
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		logger.FromContext(ctx).Error("answer callback error:", "err", err)
+	}
+}
+
+func (u *usecase) Start(ctx context.Context) error {
+	u.op.Lock()
+	defer u.op.Unlock()
+
+	return u.start(ctx)
+}
+
+func (u *usecase) Stop(ctx context.Context) error {
+	u.op.Lock()
+	defer u.op.Unlock()
+
+	return u.stop(ctx)
+}
+
+func (u *usecase) Restart(ctx context.Context) error {
+	u.op.Lock()
+	defer u.op.Unlock()
+
+	if err := u.stop(ctx); err != nil {
+		return err
+	}
+	return u.start(ctx)
+}
+
+func (u *usecase) Status(ctx context.Context) *domain.BotStatus {
+	u.RLock()
+	defer u.RUnlock()
+
+	rs := &domain.BotStatus{
+		State:       u.state,
+		Running:     u.state == domain.BotStateRunning,
+		LastErrorAt: u.lastErrAt,
+		LastPollAt:  u.lastPollAt,
+	}
+	if u.lastErr != nil {
+		rs.LastError = u.lastErr.Error()
+	}
+	if rs.Running {
+		rs.Username = u.bot.Self.UserName
+		rs.Uptime = int64(time.Since(u.startedAt).Seconds())
+		rs.QueueDepth = len(u.ch)
+	}
+	return rs
+}
+
+func (u *usecase) start(ctx context.Context) error {
+	if u.getState() == domain.BotStateRunning {
+		return nil
+	}
+	u.setState(domain.BotStateStarting)
 
 	tgToken := os.Getenv("TG_TOKEN")
 
 	bot, err := tgbotapi.NewBotAPI(tgToken)
 	if err != nil {
-		app.Get().Logger().Info("start bot error: %v", err)
-		return
+		u.setError(err)
+		u.setState(domain.BotStateStopped)
+		logger.FromContext(ctx).Error("start bot error:", "err", err)
+		return err
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	// 取消 pollCtx 只停止拉取, 已经投递的更新仍会处理完
+	pollCtx, cancel := context.WithCancel(context.Background())
+	// 工作协程的生命周期与发起启动的请求无关
+	workCtx, abort := context.WithCancel(context.Background())
+
+	run := &botRun{bot: bot, dispatcher: dispatcher.New(bot), ch: make(chan job, pollBuffer)}
+	wg := &sync.WaitGroup{}
 
 	u.Lock()
-	u.isRunning = true
-	u.bot = bot
-	u.ch = bot.GetUpdatesChan(tgbotapi.NewUpdate(0))
+	u.state = domain.BotStateRunning
+	u.bot = run.bot
+	u.dispatcher = run.dispatcher
+	u.ch = run.ch
 	u.cancel = cancel
+	u.abort = abort
+	u.wg = wg
+	u.startedAt = time.Now()
 	u.Unlock()
 
-	u.wg.Add(processNum)
+	wg.Add(processNum + 1)
+	go func() {
+		defer wg.Done()
+		u.poll(pollCtx, bot, run.ch)
+	}()
 	for i := 0; i < processNum; i++ {
 		go func() {
-			defer u.wg.Done()
-			u.Process(ctx)
+			defer wg.Done()
+			u.process(workCtx, run)
 		}()
 	}
 
-	app.Get().Logger().Info("start bot")
+	logger.FromContext(ctx).Info("start bot", "username", bot.Self.UserName)
+
+	// 命令菜单在后台发布, 失败不影响收发消息
+	Background(ctx, "commands", func(ctx context.Context) error {
+		return publishCommands(ctx, bot)
+	})
+	return nil
 }
 
-func (u *usecase) Stop(ctx context.Context) {
+// stop 停止拉取并等待已投递的更新处理完, 然后向 telegram 确认 offset.
+// 最多等待 stopTimeout 或 ctx 的期限, 仍未处理完时不再确认, 未确认的更新下次启动时会重新推送.
+func (u *usecase) stop(ctx context.Context) error {
+	if u.getState() != domain.BotStateRunning {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, stopTimeout)
+	defer cancel()
+	u.setState(domain.BotStateStopping)
 
-	app.Get().Logger().Info("stop bot")
+	log := logger.FromContext(ctx)
+	log.Info("stop bot")
 	u.cancel()
-	u.bot.StopReceivingUpdates()
 
-	u.wg.Wait()
+	drained := make(chan struct{})
+	go func() {
+		u.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		u.abort()
+		u.ack(ctx)
+	case <-ctx.Done():
+		err = ctx.Err()
+		u.abort()
+		log.Warn("drain updates timeout, unacknowledged updates will be redelivered", "queue_depth", len(u.ch))
+	}
 
 	ClearSessions()
 
 	u.Lock()
-	u.isRunning = false
+	u.state = domain.BotStateStopped
+	u.cancel = nil
+	u.abort = nil
+	u.ch = nil
+	u.wg = nil
 	u.Unlock()
+
+	return err
+}
+
+// ack 用已处理完的 offset 调用一次 getUpdates, telegram 会丢弃小于它的更新
+func (u *usecase) ack(ctx context.Context) {
+	offset := u.getOffset()
+	if offset == 0 {
+		return
+	}
+
+	config := tgbotapi.UpdateConfig{Offset: offset, Limit: 1}
+	if _, err := u.bot.GetUpdates(config); err != nil {
+		u.setError(err)
+		logger.FromContext(ctx).Error("ack updates error:", "err", err, "offset", offset)
+		return
+	}
+	logger.FromContext(ctx).Info("ack updates", "offset", offset)
+}
+
+// poll 长轮询拉取更新并投递给工作协程, ctx 取消后关闭 ch.
+// 拉取时的 offset 是最小的未处理完的 update id, 这样 telegram 只会确认已经处理过的更新,
+// 处理中的更新会被重复拉到, 投递过的直接跳过.
+func (u *usecase) poll(ctx context.Context, bot *tgbotapi.BotAPI, ch chan<- job) {
+	defer close(ch)
+
+	// 轮询使用单独的客户端, 停止时不必等长轮询超时
+	pollBot := *bot
+	pollBot.Client = &ctxClient{ctx: ctx, client: bot.Client}
+
+	tracker := newOffsetTracker(u.getOffset())
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = pollTimeout
+	for ctx.Err() == nil {
+		config.Offset = tracker.offset()
+		updates, err := pollBot.GetUpdates(config)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			u.setError(err)
+			logger.FromContext(ctx).Error("get updates error:", "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollRetryInterval):
+			}
+			continue
+		}
+
+		u.Lock()
+		u.lastPollAt = time.Now()
+		u.Unlock()
+
+		dispatched := 0
+		for _, update := range updates {
+			// 停止后不再投递, 没投递的更新不会被确认
+			if ctx.Err() != nil {
+				break
+			}
+			if !tracker.add(update.UpdateID) {
+				continue
+			}
+
+			id := update.UpdateID
+			ch <- job{update: update, done: func() {
+				tracker.done(id)
+				u.setOffset(tracker.offset())
+			}}
+			dispatched++
+		}
+
+		if len(updates) > 0 && dispatched == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollBusyInterval):
+			}
+		}
+	}
+}
+
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback"
+	case update.Message != nil && update.Message.IsCommand():
+		return "command"
+	case update.Message != nil:
+		return "message"
+	}
+	return "other"
+}
+
+func (u *usecase) getDispatcher() *dispatcher.Dispatcher {
+	u.RLock()
+	defer u.RUnlock()
+	return u.dispatcher
+}
+
+func (u *usecase) setOffset(offset int) {
+	u.Lock()
+	defer u.Unlock()
+	u.offset = offset
+}
+
+func (u *usecase) getOffset() int {
+	u.RLock()
+	defer u.RUnlock()
+	return u.offset
+}
+
+func (u *usecase) getState() string {
+	u.RLock()
+	defer u.RUnlock()
+	return u.state
+}
+
+func (u *usecase) setState(state string) {
+	u.Lock()
+	defer u.Unlock()
+	u.state = state
+}
+
+func (u *usecase) setError(err error) {
+	u.Lock()
+	defer u.Unlock()
+	u.lastErr = err
+	u.lastErrAt = time.Now()
 }
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const reviewLimit = 20
+
+// command 机器人命令, 按注册顺序出现在 Telegram 的命令菜单和 /help 中
+type command struct {
+	name string
+	// description 命令说明的文案键, 为空时不出现在命令菜单中
+	description string
+	// admin 只有 TG_ADMIN_IDS 中的用户可以使用, 其他用户当作未知命令
+	admin   bool
+	handler func(s *Session, ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error)
+}
+
+var commands []command
+
+// help 会列出 commands, 所以在 init 中注册
+func init() {
+	commands = []command{
+		{name: "start", handler: (*Session).menu},
+		{name: "menu", description: "command.menu", handler: (*Session).menu},
+		{name: "add", description: "command.add", handler: (*Session).addCommand},
+		{name: "list", description: "command.list", handler: (*Session).listCommand},
+		{name: "search", description: "command.search", handler: (*Session).searchCommand},
+		{name: "ask", description: "command.ask", handler: (*Session).askCommand},
+		{name: "review", description: "command.review", handler: (*Session).review},
+		{name: "stats", description: "command.stats", handler: (*Session).stats},
+		{name: "settings", description: "command.settings", handler: (*Session).settings},
+		{name: "language", description: "command.language", handler: (*Session).languageCommand},
+		{name: "cancel", description: "command.cancel", handler: (*Session).cancel},
+		{name: "help", description: "command.help", handler: (*Session).help},
+		{name: "status", description: "command.status", admin: true, handler: (*Session).status},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// adminIds 管理员的 Telegram 用户 id, 通过 TG_ADMIN_IDS 配置, 多个用逗号分隔
+func adminIds() []int64 {
+	rs := make([]int64, 0)
+	for _, item := range strings.Split(os.Getenv("TG_ADMIN_IDS"), ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64); err == nil {
+			rs = append(rs, id)
+		}
+	}
+	return rs
+}
+
+func isAdmin(id int64) bool {
+	for _, admin := range adminIds() {
+		if admin == id {
+			return true
+		}
+	}
+	return false
+}
+
+// botCommands 某个语言的命令菜单, admin 为 true 时包含管理命令
+func botCommands(l *i18n.Localizer, admin bool) []tgbotapi.BotCommand {
+	rs := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		if cmd.description == "" || (cmd.admin && !admin) {
+			continue
+		}
+		rs = append(rs, tgbotapi.BotCommand{Command: cmd.name, Description: l.T(cmd.description)})
+	}
+	return rs
+}
+
+// publishCommands 按语言发布命令菜单, 管理员的聊天单独发布包含管理命令的菜单.
+// 没有对应语言的客户端看到 Fallback 的菜单, 与界面语言的选择一致.
+// 管理员菜单发布失败只记录日志, 只有默认菜单失败时返回错误.
+func publishCommands(ctx context.Context, bot *tgbotapi.BotAPI) error {
+	type target struct {
+		scope tgbotapi.BotCommandScope
+		admin bool
+	}
+	targets := []target{{scope: tgbotapi.NewBotCommandScopeDefault()}}
+	for _, id := range adminIds() {
+		targets = append(targets, target{scope: tgbotapi.NewBotCommandScopeChat(id), admin: true})
+	}
+
+	var rs error
+	for _, t := range targets {
+		configs := []tgbotapi.SetMyCommandsConfig{
+			tgbotapi.NewSetMyCommandsWithScope(t.scope, botCommands(i18n.New(i18n.Fallback), t.admin)...),
+		}
+		for _, lang := range i18n.Locales {
+			configs = append(configs, tgbotapi.NewSetMyCommandsWithScopeAndLanguage(t.scope, lang, botCommands(i18n.New(lang), t.admin)...))
+		}
+
+		for _, config := range configs {
+			// 管理员还没有和机器人聊过天时会失败, 不影响其他菜单
+			if _, err := bot.Request(config); err != nil {
+				logger.FromContext(ctx).Warn("set commands error:", "err", err, "scope", t.scope.Type, "chat_id", t.scope.ChatID, "language", config.LanguageCode)
+				if !t.admin {
+					rs = err
+				}
+			}
+		}
+	}
+	return rs
+}
+
+func (s *Session) processCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	cmd := findCommand(msg.Command())
+	if cmd == nil || (cmd.admin && !isAdmin(msg.From.ID)) {
+		logger.FromContext(ctx).Info("unknown command", "command", msg.Command())
+		reply := tgbotapi.NewMessage(msg.From.ID, s.T("command.unknown", msg.Command()))
+		reply.ReplyMarkup = getKeyBoards(s.localizer())
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+
+	return cmd.handler(s, ctx, update)
+}
+
+func (s *Session) menu(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	reply := tgbotapi.NewMessage(update.Message.From.ID, s.T("menu.welcome"))
+	reply.ReplyMarkup = getKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func (s *Session) addCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	return s.startAdd(update), nil
+}
+
+func (s *Session) listCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	s.listTrash = false
+	return s.list(ctx, update, "", false)
+}
+
+func (s *Session) searchCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	return s.search(ctx, msg.From.ID, msg.CommandArguments())
+}
+
+func (s *Session) askCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	if strings.TrimSpace(msg.CommandArguments()) == "" {
+		reply := tgbotapi.NewMessage(msg.From.ID, s.T("ask.usage"))
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+	return s.answer(ctx, msg.From.ID, &domain.AskReq{Question: msg.CommandArguments()})
+}
+
+// review 列出已经到期的单词, 最早到期的在前面
+func (s *Session) review(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	stat, err := countWords()
+	if err != nil {
+		return nil, err
+	}
+
+	reply := tgbotapi.NewMessage(update.Message.From.ID, s.T("review.empty"))
+	reply.ReplyMarkup = getReviewKeyBoards(s.localizer())
+	if stat.Due == 0 {
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+
+	words, err := app.Get().FindRecordsByFilter("words", "deleted = '' && need_review_at != '' && need_review_at <= @now", "need_review_at", reviewLimit, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	text := &strings.Builder{}
+	text.WriteString(s.N("review.title", int(stat.Due)) + "\n")
+	for _, word := range words {
+		line := "• " + word.GetString("word")
+		if meaning, _, _ := strings.Cut(meaningText(jsonField(word, "means")), "\n"); meaning != "" {
+			line = s.T("review.word", word.GetString("word"), meaning)
+		}
+		text.WriteString("\n" + line)
+	}
+	if int(stat.Due) > len(words) {
+		text.WriteString("\n\n" + s.N("review.more", int(stat.Due)-len(words)))
+	}
+
+	reply.Text = truncateMessage(text.String())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func (s *Session) stats(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essays, err := s.getessayUc().Page(ctx, &domain.PageessayReq{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	words, err := countWords()
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make([]string, 0, len(proficiencyLevels))
+	for _, level := range proficiencyLevels {
+		levels = append(levels, fmt.Sprintf("%s: %d", level, words.Proficiency[level]))
+	}
+
+	text := strings.Join([]string{
+		s.T("stats.title"),
+		"",
+		s.T("stats.essays", essays.Total),
+		s.T("stats.words", words.Total, words.Due),
+		s.T("stats.proficiency", strings.Join(levels, " · ")),
+	}, "\n")
+	reply := tgbotapi.NewMessage(update.Message.From.ID, text)
+	reply.ReplyMarkup = getReviewKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+// settings 目前只有界面语言一项设置
+func (s *Session) settings(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	reply := tgbotapi.NewMessage(update.Message.From.ID, s.T("settings.title", i18n.Name(s.localizer().Lang())))
+	reply.ReplyMarkup = getLanguageKeyBoards(s.localizer(), s.language)
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+// cancel 退出正在进行的添加、编辑或提问
+func (s *Session) cancel(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	text := s.T("cancel.none")
+	if s.Kind != "" {
+		s.clearState()
+		text = s.T("cancel.done")
+	}
+
+	reply := tgbotapi.NewMessage(update.Message.From.ID, text)
+	reply.ReplyMarkup = getKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func (s *Session) help(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	text := &strings.Builder{}
+	text.WriteString(s.T("help.title") + "\n\n")
+	for _, cmd := range botCommands(s.localizer(), isAdmin(update.Message.From.ID)) {
+		text.WriteString("/" + cmd.Command + " — " + cmd.Description + "\n")
+	}
+	text.WriteString("\n" + s.T("help.tip"))
+
+	reply := tgbotapi.NewMessage(update.Message.From.ID, text.String())
+	reply.ReplyMarkup = getKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+// status 机器人的运行状态, 与 /api/v1/bot/status 相同
+func (s *Session) status(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	uc, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	status := uc.Status(ctx)
+	lastError := "-"
+	if status.LastError != "" {
+		lastError = status.LastError + " (" + status.LastErrorAt.Format(time.DateTime) + ")"
+	}
+	uptime := (time.Duration(status.Uptime) * time.Second).String()
+	text := s.T("status.text", status.State, status.Username, uptime, status.QueueDepth, GetSessions().Len(), lastError)
+
+	reply := tgbotapi.NewMessage(update.Message.From.ID, text)
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func getReviewKeyBoards(l *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("review.essays"), "sort:"+domain.EssaySortStudied),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("menu.anki"), "anki"),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
+		},
+	}...)
+}
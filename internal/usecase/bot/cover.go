@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/cover"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/str"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const (
+	coverRetries       = 3
+	coverRetryInterval = 2 * time.Second
+	coverSummaryLen    = 300
+	coverSummaryCount  = 3
+)
+
+const coverPrompt = `为一篇英语学习文章绘制封面插画, 画面简洁, 不要出现任何文字.
+标题: %s
+内容概要: %s`
+
+// llmCover 调用图片大模型生成封面
+type llmCover struct {
+	llm domain.ILLM
+}
+
+func (c *llmCover) Generate(ctx context.Context, req *domain.CoverReq) (*filesystem.File, error) {
+	url, err := c.llm.GenerateImg(ctx, fmt.Sprintf(coverPrompt, req.Title, req.Summary))
+	if err != nil {
+		return nil, err
+	}
+	return filesystem.NewFileFromURL(ctx, url)
+}
+
+// titleCardCover 本地渲染标题卡片, 不依赖外部服务
+type titleCardCover struct{}
+
+func (titleCardCover) Generate(ctx context.Context, req *domain.CoverReq) (*filesystem.File, error) {
+	data, err := cover.TitleCard(req.Title)
+	if err != nil {
+		return nil, err
+	}
+	return filesystem.NewFileFromBytes(data, "cover.jpg")
+}
+
+// retryCover 失败后按递增间隔重试
+type retryCover struct {
+	generator domain.ICoverGenerator
+	retries   int
+	interval  time.Duration
+}
+
+func (c *retryCover) Generate(ctx context.Context, req *domain.CoverReq) (*filesystem.File, error) {
+	var err error
+	for i := 0; i < c.retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.interval * time.Duration(i)):
+			}
+		}
+
+		var f *filesystem.File
+		if f, err = c.generator.Generate(ctx, req); err == nil {
+			return f, nil
+		}
+		logger.FromContext(ctx).Warn("generate cover error:", "err", err, "attempt", i+1)
+	}
+	return nil, err
+}
+
+// fallbackCover 依次尝试各个生成器, 返回第一个成功的结果
+type fallbackCover struct {
+	generators []domain.ICoverGenerator
+}
+
+func (c *fallbackCover) Generate(ctx context.Context, req *domain.CoverReq) (*filesystem.File, error) {
+	var err error
+	for _, generator := range c.generators {
+		var f *filesystem.File
+		if f, err = generator.Generate(ctx, req); err == nil {
+			return f, nil
+		}
+	}
+	return nil, err
+}
+
+func newCoverGenerator(llm domain.ILLM) domain.ICoverGenerator {
+	return &fallbackCover{
+		generators: []domain.ICoverGenerator{
+			&retryCover{
+				generator: &llmCover{llm: llm},
+				retries:   coverRetries,
+				interval:  coverRetryInterval,
+			},
+			titleCardCover{},
+		},
+	}
+}
+
+// coverSummary 取文章开头几句作为封面提示词的概要
+func coverSummary(content string) string {
+	sentences := str.Sentences(content)
+	if len(sentences) > coverSummaryCount {
+		sentences = sentences[:coverSummaryCount]
+	}
+	return truncateRunes(strings.Join(sentences, " "), coverSummaryLen)
+}
+
+func (e *essayUsecase) GenerateCover(ctx context.Context, id string) error {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	f, err := e.cover.Generate(ctx, &domain.CoverReq{
+		Title:   record.GetString("title"),
+		Summary: coverSummary(record.GetString("content")),
+	})
+	if err != nil {
+		return err
+	}
+
+	// 先重新获取一下record,后面考虑加锁
+	cRecord, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	cRecord.Set("thumb", []*filesystem.File{f})
+
+	return app.Get().Save(cRecord)
+}
+
+func (e *essayUsecase) RegenerateCover(ctx context.Context, id string) error {
+	if err := e.GenerateCover(ctx, id); err != nil {
+		return err
+	}
+
+	// telegraph 页面里引用了封面, 需要重新生成
+	return e.CreateTelegraph(ctx, id)
+}
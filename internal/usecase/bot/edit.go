@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/diff"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/str"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// diffContext 预览改动时每处修改前后保留的句子数
+const diffContext = 1
+
+// editPrompts 开始编辑后提示用户输入的内容, 值是文案的键
+var editPrompts = map[string]string{
+	StateWaitEditTitle:   "edit.prompt.title",
+	StateWaitEditContent: "edit.prompt.content",
+	StateWaitAppend:      "edit.prompt.append",
+}
+
+// editMenu 选择编辑方式
+func (s *Session) editMenu(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	text := s.T("edit.menu", essay.Title)
+	keyboards := getEditKeyBoards(s.localizer(), id)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// startEdit 进入编辑流程, 等待用户发送新的标题或内容
+func (s *Session) startEdit(ctx context.Context, id string, state string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if _, err := s.getessayUc().Detail(ctx, id); err != nil {
+		return nil, err
+	}
+
+	s.clearState()
+	s.Kind = KindEdit
+	s.State = state
+	s.editId = id
+
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.cancel"), "keep:"+id),
+	))
+	return []domain.TgChatItem{s.edit(update, s.T(editPrompts[state]), "", &keyboards)}, nil
+}
+
+// previewEdit 根据用户发送的文字生成修改, 预览改动后等待确认; 再次发送会替换待保存的修改
+func (s *Session) previewEdit(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, s.editId)
+	if err != nil {
+		s.clearState()
+		return nil, err
+	}
+
+	text := update.Message.Text
+	req := &domain.UpdateessayReq{Id: essay.Id}
+	switch s.State {
+	case StateWaitEditTitle:
+		req.Title = strings.TrimSpace(text)
+	case StateWaitEditContent:
+		req.Content = strings.TrimSpace(text)
+	case StateWaitAppend:
+		req.Content = strings.TrimSpace(essay.Content) + "\n\n" + strings.TrimSpace(text)
+	}
+
+	preview := changePreview(s.localizer(), essay.Title, essay.Content, req.Title, req.Content)
+	if preview == "" {
+		reply := tgbotapi.NewMessage(update.Message.From.ID, s.T("edit.unchanged"))
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+	s.editReq = req
+
+	reply := tgbotapi.NewMessage(update.Message.From.ID, truncateMessage(s.T("edit.preview", preview)))
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("edit.save"), "editsave"),
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.discard"), "editdiscard"),
+	))
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+// saveEdit 保存预览过的修改, 只重新生成受影响的资源
+func (s *Session) saveEdit(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if s.Kind != KindEdit || s.editReq == nil {
+		return nil, toastError(s.T("edit.nothing"))
+	}
+
+	essay, err := s.getessayUc().Update(ctx, s.editReq)
+	if err != nil {
+		return nil, err
+	}
+	s.clearState()
+	logger.FromContext(ctx).Info("essay edited", "essay_id", essay.Id)
+
+	text := s.T("edit.saved", essay.Title)
+	keyboards := getEditedKeyBoards(s.localizer(), essay.Id)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+func (s *Session) discardEdit(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	id := s.editId
+	if s.Kind == KindEdit {
+		s.clearState()
+	}
+	if id == "" {
+		return []domain.TgChatItem{s.edit(update, s.T("edit.discarded"), "", nil)}, nil
+	}
+
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.view"), "essay:"+id),
+	))
+	return []domain.TgChatItem{s.edit(update, s.T("edit.discarded"), "", &keyboards)}, nil
+}
+
+// versions 列出文章的历史版本
+func (s *Session) versions(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.getessayUc().Versions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	text := s.N("version.list", len(versions), essay.Title)
+	if len(versions) == 0 {
+		text = s.T("version.none", essay.Title)
+	}
+	keyboards := getVersionsKeyBoards(s.localizer(), id, versions)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// version 预览恢复到某个历史版本会带来的改动
+func (s *Session) version(ctx context.Context, versionId string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	version, err := s.getessayUc().Version(ctx, versionId)
+	if err != nil {
+		return nil, err
+	}
+	essay, err := s.getessayUc().Detail(ctx, version.EssayId)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := changePreview(s.localizer(), essay.Title, essay.Content, version.Title, version.Content)
+	if preview == "" {
+		preview = s.T("version.same") + "\n"
+	}
+	text := s.T("version.preview", version.Created.Local().Format(versionTimeLayout), preview)
+
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(s.T("version.revert"), "revert:"+version.Id)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(s.T("common.back"), "versions:"+version.EssayId)),
+	)
+	return []domain.TgChatItem{s.edit(update, truncateMessage(text), "", &keyboards)}, nil
+}
+
+func (s *Session) revert(ctx context.Context, versionId string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	version, err := s.getessayUc().Version(ctx, versionId)
+	if err != nil {
+		return nil, err
+	}
+	essay, err := s.getessayUc().RestoreVersion(ctx, versionId)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("essay version restored", "essay_id", essay.Id, "version_id", versionId)
+
+	text := s.T("version.reverted", essay.Title, version.Created.Local().Format(versionTimeLayout))
+	keyboards := getEditedKeyBoards(s.localizer(), essay.Id)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// changePreview 标题和内容的改动, 内容按句子比较; 没有改动时为空
+func changePreview(l *i18n.Localizer, fromTitle, fromContent, toTitle, toContent string) string {
+	sb := &strings.Builder{}
+	if toTitle != "" && toTitle != fromTitle {
+		fmt.Fprintf(sb, "%s\n- %s\n+ %s\n\n", l.T("edit.diff.title"), fromTitle, toTitle)
+	}
+
+	if toContent != "" && toContent != fromContent {
+		sb.WriteString(l.T("edit.diff.content") + "\n")
+		edits, err := diff.Lines(str.Sentences(fromContent), str.Sentences(toContent))
+		switch {
+		case errors.Is(err, diff.ErrTooLarge):
+			deleted, inserted := diff.Count(edits)
+			sb.WriteString(l.T("edit.diff.too_large", deleted, inserted) + "\n")
+		case diff.Changed(edits):
+			sb.WriteString(diff.Format(edits, diffContext))
+		default:
+			sb.WriteString(l.T("edit.diff.whitespace") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+const versionTimeLayout = "2006-01-02 15:04"
+
+func getEditKeyBoards(l *i18n.Localizer, id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("edit.retitle"), "retitle:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("edit.rewrite"), "rewrite:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("edit.append"), "append:"+id),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("edit.versions"), "versions:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.back"), "keep:"+id),
+		},
+	}...)
+}
+
+func getEditedKeyBoards(l *i18n.Localizer, id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.view"), "essay:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("edit.versions"), "versions:"+id),
+		},
+	}...)
+}
+
+func getVersionsKeyBoards(l *i18n.Localizer, id string, versions []domain.EssayVersion) tgbotapi.InlineKeyboardMarkup {
+	rs := make([][]tgbotapi.InlineKeyboardButton, 0, len(versions)+1)
+	for _, v := range versions {
+		name := v.Created.Local().Format(versionTimeLayout) + " " + truncateRunes(v.Title, 20)
+		rs = append(rs, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(name, "version:"+v.Id)})
+	}
+
+	rs = append(rs, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.back"), "edit:"+id),
+	})
+	return tgbotapi.NewInlineKeyboardMarkup(rs...)
+}
@@ -2,29 +2,44 @@ package bot
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/usual2970/retell/internal/domain"
 	"github.com/usual2970/retell/internal/util/app"
-	"github.com/usual2970/retell/internal/util/audio"
+	"github.com/usual2970/retell/internal/util/llm"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/metrics"
 	"github.com/usual2970/retell/internal/util/telegraph"
-	"github.com/usual2970/retell/internal/util/zhipu"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tmc/langchaingo/llms"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/filesystem"
 )
 
 type essayUsecase struct {
-	bot *tgbotapi.BotAPI
+	bot   *tgbotapi.BotAPI
+	llm   domain.ILLM
+	cover domain.ICoverGenerator
 }
 
 func NewessayUsecase(bot ...*tgbotapi.BotAPI) domain.IessayUsecase {
+	rs := newEssayUsecase()
 	if len(bot) > 0 {
-		return &essayUsecase{bot: bot[0]}
+		rs.bot = bot[0]
+	}
+	return rs
+}
+
+func newEssayUsecase() *essayUsecase {
+	return &essayUsecase{
+		llm:   llm.Default(),
+		cover: newCoverGenerator(llm.Default()),
 	}
-	return &essayUsecase{}
 }
 
 func (e *essayUsecase) UpdateFileId(ctx context.Context, id string, fileId string) error {
@@ -47,8 +62,9 @@ func (e *essayUsecase) CreateTelegraph(ctx context.Context, id string) error {
 		return err
 	}
 
+	log := logger.FromContext(ctx)
 	if record.GetString("content") == "" {
-		app.Get().Logger().Info("empty content  no need to upload")
+		log.Info("empty content, no need to create telegraph")
 		return nil
 	}
 
@@ -59,15 +75,14 @@ func (e *essayUsecase) CreateTelegraph(ctx context.Context, id string) error {
 		imgUrl = app.Get().Settings().Meta.AppURL + "/api/files/" + record.BaseFilesPath() + "/" + record.GetString("thumb")
 	}
 
+	start := time.Now()
 	page, err := tp.CreatePage(record.GetString("title"), record.GetString("content"), imgUrl)
+	metrics.ObserveProvider("telegraph", "create_page", start, err)
 	if err != nil {
-
-		app.Get().Logger().Error("create telegraph error:", "err", err)
+		log.Error("create telegraph error:", "err", err)
 		return err
 	}
 
-	app.Get().Logger().Info("create telegraph success", "page", page)
-
 	// 先重新获取一下record,后面考虑加锁
 	cRecord, err := app.Get().FindRecordById("essay", id)
 	if err != nil {
@@ -79,7 +94,7 @@ func (e *essayUsecase) CreateTelegraph(ctx context.Context, id string) error {
 	if err := app.Get().Save(cRecord); err != nil {
 		return err
 	}
-	app.Get().Logger().Info("create telegraph success", "page", page)
+	log.Info("create telegraph success", "url", page.URL)
 	return nil
 }
 
@@ -90,11 +105,11 @@ func (e *essayUsecase) text2Speech(ctx context.Context, id string) error {
 	}
 
 	if record.GetString("content") == "" {
-		app.Get().Logger().Info("empty content  no need to upload")
+		logger.FromContext(ctx).Info("empty content, no need to synthesize")
 		return nil
 	}
 
-	resp, err := audio.Azure(ctx, record.GetString("content"))
+	resp, err := NewTtsUsecase().Speech(ctx, record.GetString("content"))
 	if err != nil {
 		return err
 	}
@@ -120,7 +135,7 @@ func (e *essayUsecase) text2Speech(ctx context.Context, id string) error {
 }
 
 func (e *essayUsecase) Notify(ctx context.Context, req *domain.TtsAsyncResp) error {
-	app.Get().Logger().Info("essay notify:", "req", req)
+	logger.FromContext(ctx).Info("essay notify", "task_id", req.Data.TaskId, "status", req.Status)
 
 	record, err := app.Get().FindFirstRecordByData("essay", "task_id", req.Data.TaskId)
 	if err != nil {
@@ -141,58 +156,203 @@ func (e *essayUsecase) Notify(ctx context.Context, req *domain.TtsAsyncResp) err
 	return nil
 }
 
-func (e *essayUsecase) Add(ctx context.Context, req *domain.AddessayReq) error {
+func (e *essayUsecase) Add(ctx context.Context, req *domain.AddessayReq) (*domain.Essay, error) {
 
 	collection, err := app.Get().FindCollectionByNameOrId("essay")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	record := core.NewRecord(collection)
 
 	record.Set("title", req.Title)
 	record.Set("content", req.Content)
+	record.Set("user", req.User)
+
+	// 保存到数据库
+	if err := app.Get().Save(record); err != nil {
+		logger.FromContext(ctx).Error("save essay error:", "err", err)
+		return nil, err
+	}
+
+	e.postProcess(ctx, record.Id)
+
+	return toEssay(record), nil
+}
+
+func (e *essayUsecase) Update(ctx context.Context, req *domain.UpdateessayReq) (*domain.Essay, error) {
+	record, err := app.Get().FindRecordById("essay", req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	title, content := record.GetString("title"), record.GetString("content")
+
+	var assets asset
+	if req.Title != "" && req.Title != title {
+		record.Set("title", req.Title)
+		assets |= titleAssets
+	}
+	if req.Content != "" && req.Content != content {
+		record.Set("content", req.Content)
+		assets |= contentAssets
+	}
+	if assets == 0 {
+		return toEssay(record), nil
+	}
 
-	apiKey := os.Getenv("ZHIPU_API_KEY")
-	zp := zhipu.NewZhipu(apiKey)
+	// 旧音频的 file_id 带着旧标题, 内容变化时音频本身也要重新合成
+	record.Set("file_id", "")
+	if assets&assetAudio != 0 {
+		record.Set("sentences", nil)
+	}
 
-	url, err := zp.GenerateImg(ctx, req.Title)
+	err = app.Get().RunInTransaction(func(txApp core.App) error {
+		if err := saveVersion(txApp, record.Id, title, content); err != nil {
+			return err
+		}
+		return txApp.Save(record)
+	})
 	if err != nil {
+		return nil, err
+	}
+
+	e.regenerate(ctx, record.Id, assets)
+
+	return toEssay(record), nil
+}
+
+func (e *essayUsecase) RegenerateAssets(ctx context.Context, id string) error {
+	if _, err := app.Get().FindRecordById("essay", id); err != nil {
 		return err
 	}
-	f, _ := filesystem.NewFileFromURL(ctx, url)
 
-	record.Set("thumb", []*filesystem.File{f})
+	if err := e.UpdateFileId(ctx, id, ""); err != nil {
+		return err
+	}
 
-	// 保存到数据库
-	if err := app.Get().Save(record); err != nil {
-		app.Get().Logger().Error("save essay error:", "err", err)
+	e.postProcess(ctx, id)
+	return nil
+}
+
+// asset 文章的衍生资源
+type asset int
+
+const (
+	assetCover asset = 1 << iota
+	assetTelegraph
+	assetVectors
+	assetAudio
+
+	assetAll = assetCover | assetTelegraph | assetVectors | assetAudio
+
+	// titleAssets 标题变化时需要更新的资源, 封面保留, 需要时可以单独重新生成
+	titleAssets = assetTelegraph | assetVectors
+	// contentAssets 内容变化时需要更新的资源
+	contentAssets = assetTelegraph | assetVectors | assetAudio
+)
+
+// postProcess 异步生成文章的封面、telegraph 页面、向量和语音
+func (e *essayUsecase) postProcess(ctx context.Context, id string) {
+	e.regenerate(ctx, id, assetAll)
+}
+
+// regenerate 异步重新生成指定的资源
+func (e *essayUsecase) regenerate(ctx context.Context, id string, assets asset) {
+	ctx = logger.With(ctx, "essay_id", id)
+
+	// 封面生成后再创建 telegraph 页面, 页面里才能带上封面
+	if assets&assetCover != 0 {
+		Background(ctx, "cover", func(ctx context.Context) error {
+			if err := e.GenerateCover(ctx, id); err != nil {
+				logger.FromContext(ctx).Error("generate cover error:", "err", err)
+			}
+			return e.CreateTelegraph(ctx, id)
+		})
+	} else if assets&assetTelegraph != 0 {
+		Background(ctx, "telegraph", func(ctx context.Context) error {
+			return e.CreateTelegraph(ctx, id)
+		})
+	}
+
+	if assets&assetVectors != 0 {
+		Background(ctx, "embed", func(ctx context.Context) error {
+			return e.Embed(ctx, id)
+		})
+	}
+
+	// 文字转换成语音
+	if assets&assetAudio != 0 {
+		Background(ctx, "tts", func(ctx context.Context) error {
+			return e.text2Speech(ctx, id)
+		})
+	}
+}
+
+// generate 在当前协程依次生成指定的资源, 用于需要限制并发的批量任务
+func (e *essayUsecase) generate(ctx context.Context, id string, assets asset) error {
+	errs := make([]error, 0)
+	if assets&assetCover != 0 {
+		if err := e.GenerateCover(ctx, id); err != nil {
+			logger.FromContext(ctx).Error("generate cover error:", "err", err)
+		}
+	}
+	if assets&(assetCover|assetTelegraph) != 0 {
+		errs = append(errs, e.CreateTelegraph(ctx, id))
+	}
+	if assets&assetVectors != 0 {
+		errs = append(errs, e.Embed(ctx, id))
+	}
+	if assets&assetAudio != 0 {
+		errs = append(errs, e.text2Speech(ctx, id))
+	}
+	return errors.Join(errs...)
+}
+
+const resumeLimit = 100
+
+// ResumePending 补做上次停机时没完成的后台任务, 只补缺失的部分
+func (e *essayUsecase) ResumePending(ctx context.Context) error {
+	records, err := app.Get().FindRecordsByFilter("essay", "content != '' && deleted = '' && (file = '' || thumb = '' || telegraph = '')", "-id", resumeLimit, 0)
+	if err != nil {
 		return err
 	}
 
-	go func() {
-		if err := e.CreateTelegraph(context.Background(), record.Id); err != nil {
-			app.Get().Logger().Error("createTelegraph error:", "err", err)
-		} else {
-			app.Get().Logger().Info("success createTelegraph", "id", record.Id)
+	for _, record := range records {
+		id := record.Id
+		ctx := logger.With(ctx, "essay_id", id)
+
+		if record.GetString("thumb") == "" || record.GetString("telegraph") == "" {
+			Background(ctx, "cover", func(ctx context.Context) error {
+				if record.GetString("thumb") == "" {
+					if err := e.GenerateCover(ctx, id); err != nil {
+						logger.FromContext(ctx).Error("generate cover error:", "err", err)
+					}
+				}
+				return e.CreateTelegraph(ctx, id)
+			})
 		}
-	}()
 
-	// 文字转换成语音
-	go func() {
-		if err := e.text2Speech(context.Background(), record.Id); err != nil {
-			app.Get().Logger().Error("text2speech error:", "err", err)
-		} else {
-			app.Get().Logger().Info("success text2speech", "id", record.Id)
+		if record.GetString("file") == "" {
+			Background(ctx, "tts", func(ctx context.Context) error {
+				return e.text2Speech(ctx, id)
+			})
 		}
-	}()
 
+		if count, err := app.Get().CountRecords("essay_vectors", dbx.HashExp{"essay": id}); err == nil && count == 0 {
+			Background(ctx, "embed", func(ctx context.Context) error {
+				return e.Embed(ctx, id)
+			})
+		}
+	}
+
+	logger.FromContext(ctx).Info("resume pending essays", "count", len(records))
 	return nil
 }
 
 func (e *essayUsecase) List(ctx context.Context, req *domain.ListessayReq) ([]domain.Essay, error) {
 
-	records, err := app.Get().FindRecordsByFilter("essay", req.Filter, "-id", req.Limit, req.Offset)
+	records, err := app.Get().FindRecordsByFilter("essay", req.Filter, "-id", req.Limit, req.Offset, req.Params)
 	if err != nil {
 		return nil, err
 	}
@@ -206,26 +366,22 @@ func (e *essayUsecase) List(ctx context.Context, req *domain.ListessayReq) ([]do
 				Updated: record.GetDateTime("updated").Time(),
 			},
 			Title: record.GetString("title"),
+			User:  record.GetString("user"),
 		})
 	}
 
 	return rs, nil
 }
 
-func (e *essayUsecase) Delete(ctx context.Context, id string) error {
-	record, err := app.Get().FindRecordById("essay", id)
-	if err != nil {
-		return err
-	}
-
-	return app.Get().Delete(record)
-}
-
 func (e *essayUsecase) Detail(ctx context.Context, id string) (*domain.Essay, error) {
 	record, err := app.Get().FindRecordById("essay", id)
 	if err != nil {
 		return nil, err
 	}
+	return toEssay(record), nil
+}
+
+func toEssay(record *core.Record) *domain.Essay {
 	file := ""
 	if record.GetString("file") != "" {
 		file = app.Get().Settings().Meta.AppURL + "/api/files/" + record.BaseFilesPath() + "/" + record.GetString("file")
@@ -235,7 +391,7 @@ func (e *essayUsecase) Detail(ctx context.Context, id string) (*domain.Essay, er
 	if record.GetString("thumb") != "" {
 		thumb = app.Get().Settings().Meta.AppURL + "/api/files/" + record.BaseFilesPath() + "/" + record.GetString("thumb")
 	}
-	rs := &domain.Essay{
+	return &domain.Essay{
 		Meta: domain.Meta{
 			Id:      record.Id,
 			Created: record.GetDateTime("created").Time(),
@@ -247,6 +403,25 @@ func (e *essayUsecase) Detail(ctx context.Context, id string) (*domain.Essay, er
 		FileId:    record.GetString("file_id"),
 		Thumb:     thumb,
 		Telegraph: record.GetString("telegraph"),
+		User:      record.GetString("user"),
+		Deleted:   record.GetDateTime("deleted").Time(),
 	}
-	return rs, nil
+}
+
+const explainPrompt = `请用中文讲解下面这篇英语文章中值得学习的语法点和句型, 每个要点附上原文例句:
+
+%s`
+
+func (e *essayUsecase) Explain(ctx context.Context, id string, onChunk func(ctx context.Context, chunk []byte) error) (string, error) {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return "", err
+	}
+
+	options := make([]llms.CallOption, 0)
+	if onChunk != nil {
+		options = append(options, llms.WithStreamingFunc(onChunk))
+	}
+
+	return e.llm.Call(ctx, fmt.Sprintf(explainPrompt, record.GetString("content")), options...)
 }
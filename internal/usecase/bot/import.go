@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/extract"
+	xhttp "github.com/usual2970/retell/internal/util/http"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// maxTitleRunes 添加文章时不超过这个长度的单行文字当作标题
+	maxTitleRunes = 100
+	// maxEssayRunes 一篇文章最多的字数, 太长的文章合成音频很慢
+	maxEssayRunes = 100000
+	// maxDocumentSize 机器人能下载的最大文件
+	maxDocumentSize = 20 << 20
+	documentTimeout = 60 * time.Second
+)
+
+var (
+	errTooLarge = errors.New("document too large")
+	errTooLong  = errors.New("essay too long")
+)
+
+// isImport 不需要先输入标题、可以直接导入的消息: 文档、图片、转发的消息和网址
+func isImport(msg *tgbotapi.Message) bool {
+	return msg.Document != nil || len(msg.Photo) > 0 || msg.ForwardOrigin != nil || extract.IsURL(msg.Text)
+}
+
+// isTitle 添加文章时第一条简短的单行文字是标题
+func isTitle(msg *tgbotapi.Message) bool {
+	text := strings.TrimSpace(msg.Text)
+	return !isImport(msg) && text != "" && !strings.Contains(text, "\n") && utf8.RuneCountInString(text) <= maxTitleRunes
+}
+
+// startImport 不在添加流程中收到文档、转发或网址时直接开始添加文章
+func (s *Session) startImport() {
+	s.clearState()
+	s.Kind = KindAddessay
+	s.State = SteteWaitContent
+	s.essay = &domain.AddessayReq{}
+}
+
+// collectPart 收集文章的一段内容, 可以连续发送多条, 点击完成后再保存
+func (s *Session) collectPart(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	log := logger.FromContext(ctx)
+
+	doc, err := s.importMessage(ctx, msg)
+	if err == nil {
+		err = s.appendPart(doc)
+	}
+	if err != nil {
+		log.Error("import essay error:", "err", err)
+		return []domain.TgChatItem{s.importFailed(msg, err)}, nil
+	}
+
+	reply := tgbotapi.NewMessage(msg.From.ID, s.partsReceived())
+	reply.ReplyMarkup = getImportKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+// appendPart 把一段内容接到文章末尾
+func (s *Session) appendPart(doc *extract.Doc) error {
+	if utf8.RuneCountInString(s.essay.Content)+utf8.RuneCountInString(doc.Content) > maxEssayRunes {
+		return errTooLong
+	}
+
+	if s.essay.Content != "" {
+		s.essay.Content += "\n\n"
+	}
+	s.essay.Content += doc.Content
+	if s.importTitle == "" {
+		s.importTitle = doc.Title
+	}
+	s.essayParts++
+	return nil
+}
+
+func (s *Session) partsReceived() string {
+	return s.T("add.parts", s.essayParts, utf8.RuneCountInString(s.essay.Content))
+}
+
+// importFailed 提示失败原因, 已经收到内容时仍然可以点击完成
+func (s *Session) importFailed(msg *tgbotapi.Message, err error) domain.TgChatItem {
+	reply := tgbotapi.NewMessage(msg.From.ID, s.importFailure(err))
+	if s.essayParts > 0 {
+		reply.ReplyMarkup = getImportKeyBoards(s.localizer())
+	}
+	return *domain.NewTgChatItem(reply)
+}
+
+// importMessage 从文档、网址或者消息文字中提取内容
+func (s *Session) importMessage(ctx context.Context, msg *tgbotapi.Message) (*extract.Doc, error) {
+	if msg.Document != nil {
+		return s.importDocument(msg.Document)
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		// 转发的图片等消息只有说明文字
+		text = strings.TrimSpace(msg.Caption)
+	}
+	if text == "" {
+		return nil, extract.ErrEmpty
+	}
+	if extract.IsURL(text) {
+		return extract.URL(ctx, text)
+	}
+	return &extract.Doc{Content: text}, nil
+}
+
+func (s *Session) importDocument(document *tgbotapi.Document) (*extract.Doc, error) {
+	if !slices.Contains(extract.Extensions, strings.ToLower(path.Ext(document.FileName))) {
+		return nil, extract.ErrUnsupported
+	}
+	data, err := s.download(document.FileID, document.FileSize)
+	if err != nil {
+		return nil, err
+	}
+	return extract.File(document.FileName, data)
+}
+
+// download 下载用户发送的文件
+func (s *Session) download(fileID string, size int64) ([]byte, error) {
+	if size > maxDocumentSize {
+		return nil, errTooLarge
+	}
+
+	url, err := s.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return xhttp.Req(url, http.MethodGet, nil, map[string]string{}, xhttp.WithTimeout(documentTimeout))
+}
+
+// importFailure 导入失败时给用户的提示
+func (s *Session) importFailure(err error) string {
+	switch {
+	case errors.Is(err, extract.ErrUnsupported):
+		return s.T("import.unsupported", strings.Join(extract.Extensions, " "))
+	case errors.Is(err, extract.ErrEmpty):
+		return s.T("import.empty")
+	case errors.Is(err, errTooLarge):
+		return s.T("import.too_large")
+	case errors.Is(err, errOcrEmpty):
+		return s.T("import.ocr_empty")
+	case errors.Is(err, errTooLong), errors.Is(err, extract.ErrTooLarge):
+		return s.T("import.too_long", maxEssayRunes)
+	}
+	return s.T("import.failed")
+}
+
+// finishImport 把收到的内容保存为一篇文章, 没有标题时用原文标题或者第一句话
+func (s *Session) finishImport(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if s.Kind != KindAddessay || s.essay == nil {
+		return nil, toastError(s.T("add.empty"))
+	}
+	// 还没确认的识别结果直接当作最后一段
+	if err := s.keepOcr(); err != nil {
+		return nil, toastError(s.importFailure(err))
+	}
+	if s.essay.Content == "" {
+		return nil, toastError(s.T("add.empty"))
+	}
+
+	req := s.essay
+	if req.Title == "" {
+		req.Title = s.importTitle
+	}
+	if req.Title == "" {
+		req.Title = extract.InferTitle(req.Content)
+	}
+
+	essay, err := s.getessayUc().Add(ctx, req)
+	if err != nil {
+		logger.FromContext(ctx).Error("add essay error:", "err", err)
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("essay added", "essay_id", essay.Id, "parts", s.essayParts)
+	s.clearState()
+
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.view"), "essay:"+essay.Id),
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.menu"), "return2menu"),
+	))
+	return []domain.TgChatItem{s.edit(update, s.T("add.saved", essay.Title), "", &keyboards)}, nil
+}
+
+func (s *Session) cancelImport(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if s.Kind == KindAddessay {
+		s.clearState()
+	}
+	keyboards := getReturnKeyBoards(s.localizer())
+	return []domain.TgChatItem{s.edit(update, s.T("add.canceled"), "", &keyboards)}, nil
+}
+
+func getImportKeyBoards(l *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(l.T("add.done"), "adddone"),
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.cancel"), "addcancel"),
+	))
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/repository/tguser"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// languageAuto 清除用户选择的语言, 改为跟随 Telegram
+const languageAuto = "auto"
+
+// localize 优先使用用户选择的语言, 否则使用 Telegram 客户端的语言
+func (s *Session) localize(ctx context.Context, update tgbotapi.Update) {
+	if !s.languageLoaded {
+		user, err := tguser.NewRepository().Get(ctx, s.ChatID)
+		if err != nil {
+			// 读取失败时这次先跟随 Telegram, 下次更新再读
+			logger.FromContext(ctx).Warn("get tg user error:", "err", err)
+		} else {
+			s.languageLoaded = true
+			if user != nil {
+				s.language = user.Language
+			}
+		}
+	}
+
+	lang := s.language
+	if from := update.SentFrom(); lang == "" && from != nil {
+		lang = from.LanguageCode
+	}
+	s.tr = i18n.New(lang)
+}
+
+func (s *Session) localizer() *i18n.Localizer {
+	if s.tr == nil {
+		return i18n.New("")
+	}
+	return s.tr
+}
+
+func (s *Session) T(key string, args ...any) string {
+	return s.localizer().T(key, args...)
+}
+
+func (s *Session) N(key string, n int, args ...any) string {
+	return s.localizer().N(key, n, args...)
+}
+
+// languageCommand /language 不带参数时列出可选的语言, 带参数时直接切换
+func (s *Session) languageCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	lang := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+	if lang == "" {
+		reply := tgbotapi.NewMessage(msg.From.ID, s.T("language.prompt", i18n.Name(s.localizer().Lang())))
+		reply.ReplyMarkup = getLanguageKeyBoards(s.localizer(), s.language)
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+	if lang != languageAuto && !i18n.Supported(lang) {
+		usage := s.T("language.usage", strings.Join(i18n.Locales, "|")+"|"+languageAuto)
+		return []domain.TgChatItem{*domain.NewTgChatItem(tgbotapi.NewMessage(msg.From.ID, usage))}, nil
+	}
+
+	text, err := s.setLanguage(ctx, lang, update)
+	if err != nil {
+		return nil, err
+	}
+	reply := tgbotapi.NewMessage(msg.From.ID, text)
+	reply.ReplyMarkup = getKeyBoards(s.localizer())
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func (s *Session) chooseLanguage(ctx context.Context, lang string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if lang != languageAuto && !i18n.Supported(lang) {
+		return nil, toastError(s.T("common.expired"))
+	}
+
+	text, err := s.setLanguage(ctx, lang, update)
+	if err != nil {
+		return nil, err
+	}
+	keyboards := getKeyBoards(s.localizer())
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// setLanguage 保存用户选择的语言, 返回用新语言写的提示
+func (s *Session) setLanguage(ctx context.Context, lang string, update tgbotapi.Update) (string, error) {
+	if lang == languageAuto {
+		lang = ""
+	}
+	if err := tguser.NewRepository().SaveLanguage(ctx, s.ChatID, lang); err != nil {
+		return "", err
+	}
+	logger.FromContext(ctx).Info("language changed", "language", lang)
+
+	s.language = lang
+	s.languageLoaded = true
+	s.localize(ctx, update)
+	if lang == "" {
+		return s.T("language.auto_saved"), nil
+	}
+	return s.T("language.saved"), nil
+}
+
+func getLanguageKeyBoards(l *i18n.Localizer, current string) tgbotapi.InlineKeyboardMarkup {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, len(i18n.Locales))
+	for _, lang := range i18n.Locales {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(checked(i18n.Name(lang), lang == current), "lang:"+lang))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(checked(l.T("language.auto"), current == ""), "lang:"+languageAuto),
+		),
+	)
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/extract"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/ocr"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// imageTypes 作为文件发送时可以识别的图片
+var imageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+var errOcrEmpty = errors.New("no text recognized")
+
+// isImage 照片或者以文件发送的图片
+func isImage(msg *tgbotapi.Message) bool {
+	if len(msg.Photo) > 0 {
+		return true
+	}
+	if msg.Document == nil {
+		return false
+	}
+	_, ok := imageTypes[strings.ToLower(path.Ext(msg.Document.FileName))]
+	return ok
+}
+
+func (s *Session) getOcr() domain.IOcr {
+	if s.ocr != nil {
+		return s.ocr
+	}
+	return ocr.Default()
+}
+
+// recognize 识别图片中的文字, 等用户确认或者发送修改后的文字
+func (s *Session) recognize(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	msg := update.Message
+	if s.bot != nil {
+		s.bot.Request(tgbotapi.NewChatAction(msg.Chat.ID, tgbotapi.ChatTyping))
+	}
+
+	text, err := s.recognizeImage(ctx, msg)
+	if err != nil {
+		logger.FromContext(ctx).Error("recognize image error:", "err", err)
+		return []domain.TgChatItem{s.importFailed(msg, err)}, nil
+	}
+
+	s.ocrText = text
+	s.State = StateWaitOcrConfirm
+
+	reply := tgbotapi.NewMessage(msg.From.ID, truncateMessage(s.T("ocr.result", text)))
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("ocr.use"), "ocrok"),
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.discard"), "ocrdrop"),
+	))
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+}
+
+func (s *Session) recognizeImage(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+	var (
+		fileID   string
+		size     int64
+		mimeType = "image/jpeg"
+	)
+	if len(msg.Photo) > 0 {
+		// 最后一张尺寸最大
+		photo := msg.Photo[len(msg.Photo)-1]
+		fileID, size = photo.FileID, int64(photo.FileSize)
+	} else {
+		fileID, size = msg.Document.FileID, msg.Document.FileSize
+		mimeType = imageTypes[strings.ToLower(path.Ext(msg.Document.FileName))]
+	}
+
+	data, err := s.download(fileID, size)
+	if err != nil {
+		return "", err
+	}
+	text, err := s.getOcr().Recognize(ctx, data, mimeType)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", errOcrEmpty
+	}
+	return text, nil
+}
+
+// confirmOcr 使用识别结果作为文章的一段
+func (s *Session) confirmOcr(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if s.Kind != KindAddessay || s.ocrText == "" {
+		return nil, toastError(s.T("ocr.expired"))
+	}
+
+	if err := s.keepOcr(); err != nil {
+		return nil, toastError(s.importFailure(err))
+	}
+
+	keyboards := getImportKeyBoards(s.localizer())
+	return []domain.TgChatItem{s.edit(update, s.partsReceived(), "", &keyboards)}, nil
+}
+
+// keepOcr 把等待确认的识别结果加入文章
+func (s *Session) keepOcr() error {
+	if s.ocrText != "" {
+		if err := s.appendPart(&extract.Doc{Content: s.ocrText}); err != nil {
+			return err
+		}
+	}
+	s.ocrText = ""
+	s.State = SteteWaitContent
+	return nil
+}
+
+func (s *Session) dropOcr(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	if s.Kind != KindAddessay {
+		return []domain.TgChatItem{s.edit(update, s.T("ocr.dropped"), "", nil)}, nil
+	}
+
+	s.ocrText = ""
+	s.State = SteteWaitContent
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.cancel"), "addcancel"),
+	))
+	if s.essayParts > 0 {
+		keyboards = getImportKeyBoards(s.localizer())
+	}
+	return []domain.TgChatItem{s.edit(update, s.T("ocr.dropped_retry"), "", &keyboards)}, nil
+}
@@ -0,0 +1,47 @@
+package bot
+
+import "sync"
+
+// offsetTracker 记录已投递还未处理完的更新.
+// 最小的未完成 update id 之前的更新都已处理完, 可以向 telegram 确认, 慢的更新不会阻塞其他更新.
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending map[int]bool
+	// next 已投递的最大 update id + 1
+	next int
+}
+
+func newOffsetTracker(offset int) *offsetTracker {
+	return &offsetTracker{pending: make(map[int]bool), next: offset}
+}
+
+// add 投递前调用, 返回 false 表示这个更新已经投递过
+func (t *offsetTracker) add(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id < t.next {
+		return false
+	}
+	t.pending[id] = true
+	t.next = id + 1
+	return true
+}
+
+func (t *offsetTracker) done(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, id)
+}
+
+// offset 可以确认的 offset, 即最小的未完成 update id, 都完成时为 next
+func (t *offsetTracker) offset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rs := t.next
+	for id := range t.pending {
+		rs = min(rs, id)
+	}
+	return rs
+}
@@ -0,0 +1,38 @@
+package bot
+
+import "testing"
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		start int
+		add   []int
+		done  []int
+		want  int
+	}{
+		{name: "empty", start: 5, want: 5},
+		{name: "all done", add: []int{10, 11, 12}, done: []int{10, 11, 12}, want: 13},
+		{name: "slow first update", add: []int{10, 11, 12}, done: []int{11, 12}, want: 10},
+		{name: "slow middle update", add: []int{10, 11, 12}, done: []int{10, 12}, want: 11},
+		{name: "redelivered updates are skipped", start: 11, add: []int{10, 11, 11}, want: 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker(tt.start)
+			for _, id := range tt.add {
+				tracker.add(id)
+			}
+			for _, id := range tt.done {
+				tracker.done(id)
+			}
+			if got := tracker.offset(); got != tt.want {
+				t.Errorf("offset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	tracker := newOffsetTracker(0)
+	if !tracker.add(3) || tracker.add(3) || tracker.add(2) {
+		t.Errorf("add() should only accept updates after the last dispatched one")
+	}
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// essayTypeLimit 列表中最多展示的文章类型数
+	essayTypeLimit = 8
+	pageLimit      = 10
+)
+
+// essaySort 排序字段, 相同时再按 id 排序保证顺序稳定
+type essaySort struct {
+	field string
+	desc  bool
+}
+
+var essaySorts = map[string]essaySort{
+	domain.EssaySortNewest:  {field: "id", desc: true},
+	domain.EssaySortTitle:   {field: "title"},
+	domain.EssaySortStudied: {field: "studied_at"},
+}
+
+// order 翻页方向对应的排序, 向前翻页时反向排序
+func (s essaySort) order(backward bool) string {
+	if s.desc != backward {
+		return "-" + s.field + ",-id"
+	}
+	return s.field + ",id"
+}
+
+// after 排在 cursor 之后(backward 时为之前)的记录
+func (s essaySort) after(cursor *core.Record, backward bool, params dbx.Params) string {
+	op := ">"
+	if s.desc != backward {
+		op = "<"
+	}
+	// 过滤参数为空字符串时会被替换成 `""`, 未学习过的文章 studied_at 为空, 只能直接写空字符串
+	value := "''"
+	if v := cursor.GetString(s.field); v != "" {
+		value = "{:cursor_value}"
+		params["cursor_value"] = v
+	}
+	params["cursor_id"] = cursor.Id
+	return "(" + s.field + " " + op + " " + value + " || (" + s.field + " = " + value + " && id " + op + " {:cursor_id}))"
+}
+
+func (e *essayUsecase) Page(ctx context.Context, req *domain.PageessayReq) (*domain.PageessayResp, error) {
+	if req.Limit <= 0 {
+		req.Limit = pageLimit
+	}
+
+	sort, ok := essaySorts[req.Sort]
+	if !ok {
+		sort = essaySorts[domain.EssaySortNewest]
+	}
+
+	filter := "deleted = ''"
+	if req.Trash {
+		filter = "deleted != ''"
+	}
+	params := dbx.Params{}
+	if req.EssayType != "" {
+		filter += " && essay_type = {:essay_type}"
+		params["essay_type"] = req.EssayType
+	}
+
+	total, err := countEssays(filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := e.pageRecords(req, sort, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &domain.PageessayResp{
+		Items: make([]domain.Essay, 0, len(records)),
+		Total: total,
+	}
+	for _, record := range records {
+		rs.Items = append(rs.Items, *toEssay(record))
+	}
+
+	// 当前页之前的记录数决定页码
+	before := 0
+	if len(records) > 0 {
+		beforeParams := maps.Clone(params)
+		if before, err = countEssays(filter+" && "+sort.after(records[0], true, beforeParams), beforeParams); err != nil {
+			return nil, err
+		}
+	}
+	setPageNumbers(rs, before, len(records), req.Limit)
+
+	if rs.Types, err = essayTypes(); err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// pageRecords 游标对应的文章不存在或者前面不足一页时退回第一页
+func (e *essayUsecase) pageRecords(req *domain.PageessayReq, sort essaySort, filter string, params dbx.Params) ([]*core.Record, error) {
+	if req.Cursor != "" {
+		cursor, err := app.Get().FindRecordById("essay", req.Cursor)
+		if err == nil {
+			pageParams := maps.Clone(params)
+			records, err := app.Get().FindRecordsByFilter("essay", filter+" && "+sort.after(cursor, req.Backward, pageParams),
+				sort.order(req.Backward), req.Limit, 0, pageParams)
+			if err != nil {
+				return nil, err
+			}
+			if req.Backward {
+				slices.Reverse(records)
+			}
+			if cursorPageFull(len(records), req.Limit, req.Backward) {
+				return records, nil
+			}
+		}
+	}
+
+	return app.Get().FindRecordsByFilter("essay", filter, sort.order(false), req.Limit, 0, params)
+}
+
+// cursorPageFull 游标翻到的页是否可以直接使用.
+// 向前翻页不足一页说明前面的记录被删除了, 退回第一页, 否则第一页会不满.
+func cursorPageFull(count, limit int, backward bool) bool {
+	if backward {
+		return count == limit
+	}
+	return count > 0
+}
+
+// setPageNumbers 根据当前页之前的记录数 before 和当前页的记录数 count 计算页码
+func setPageNumbers(rs *domain.PageessayResp, before, count, limit int) {
+	rs.Pages = max(1, (rs.Total+limit-1)/limit)
+	rs.Page = min(rs.Pages, before/limit+1)
+	rs.HasPrev = before > 0
+	rs.HasNext = before+count < rs.Total
+}
+
+func countEssays(filter string, params dbx.Params) (int, error) {
+	collection, err := app.Get().FindCachedCollectionByNameOrId("essay")
+	if err != nil {
+		return 0, err
+	}
+
+	resolver := core.NewRecordFieldResolver(app.Get(), collection, nil, true)
+	expr, err := search.FilterData(filter).BuildExpr(resolver, params)
+	if err != nil {
+		return 0, err
+	}
+
+	total, err := app.Get().CountRecords(collection, expr)
+	return int(total), err
+}
+
+func essayTypes() ([]string, error) {
+	rs := make([]string, 0)
+	err := app.Get().DB().Select("essay_type").Distinct(true).From("essay").
+		Where(dbx.NewExp("essay_type != '' AND deleted = ''")).
+		OrderBy("essay_type").
+		Limit(essayTypeLimit).
+		Column(&rs)
+	return rs, err
+}
+
+func (e *essayUsecase) MarkStudied(ctx context.Context, id string) error {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	record.Set("studied_at", types.NowDateTime())
+	return app.Get().Save(record)
+}
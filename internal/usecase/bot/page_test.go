@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/usual2970/retell/internal/domain"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestEssaySortOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		backward bool
+		want     string
+	}{
+		{name: "newest forward", sort: domain.EssaySortNewest, want: "-id,-id"},
+		{name: "newest backward", sort: domain.EssaySortNewest, backward: true, want: "id,id"},
+		{name: "title forward", sort: domain.EssaySortTitle, want: "title,id"},
+		{name: "title backward", sort: domain.EssaySortTitle, backward: true, want: "-title,-id"},
+		{name: "studied forward", sort: domain.EssaySortStudied, want: "studied_at,id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := essaySorts[tt.sort].order(tt.backward); got != tt.want {
+				t.Errorf("order() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEssaySortAfter(t *testing.T) {
+	collection := core.NewBaseCollection("essay")
+	collection.Fields.Add(&core.TextField{Name: "title"}, &core.TextField{Name: "studied_at"})
+	cursor := func(title, studied string) *core.Record {
+		record := core.NewRecord(collection)
+		record.Id = "e2"
+		record.Set("title", title)
+		record.Set("studied_at", studied)
+		return record
+	}
+
+	tests := []struct {
+		name       string
+		sort       string
+		cursor     *core.Record
+		backward   bool
+		want       string
+		wantParams dbx.Params
+	}{
+		{
+			name:       "newest forward",
+			sort:       domain.EssaySortNewest,
+			cursor:     cursor("Fox", ""),
+			want:       "(id < {:cursor_value} || (id = {:cursor_value} && id < {:cursor_id}))",
+			wantParams: dbx.Params{"cursor_value": "e2", "cursor_id": "e2"},
+		},
+		{
+			name:       "title backward",
+			sort:       domain.EssaySortTitle,
+			cursor:     cursor("Fox", ""),
+			backward:   true,
+			want:       "(title < {:cursor_value} || (title = {:cursor_value} && id < {:cursor_id}))",
+			wantParams: dbx.Params{"cursor_value": "Fox", "cursor_id": "e2"},
+		},
+		{
+			name:       "never studied",
+			sort:       domain.EssaySortStudied,
+			cursor:     cursor("Fox", ""),
+			want:       "(studied_at > '' || (studied_at = '' && id > {:cursor_id}))",
+			wantParams: dbx.Params{"cursor_id": "e2"},
+		},
+		{
+			name:       "studied",
+			sort:       domain.EssaySortStudied,
+			cursor:     cursor("Fox", "2026-01-02 03:04:05.000Z"),
+			want:       "(studied_at > {:cursor_value} || (studied_at = {:cursor_value} && id > {:cursor_id}))",
+			wantParams: dbx.Params{"cursor_value": "2026-01-02 03:04:05.000Z", "cursor_id": "e2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := dbx.Params{}
+			if got := essaySorts[tt.sort].after(tt.cursor, tt.backward, params); got != tt.want {
+				t.Errorf("after() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("after() params = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestCursorPageFull(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		backward bool
+		want     bool
+	}{
+		{name: "forward full", count: 10, want: true},
+		{name: "forward last page", count: 3, want: true},
+		{name: "forward past the end", count: 0, want: false},
+		{name: "backward full", count: 10, backward: true, want: true},
+		{name: "backward short falls back to first page", count: 7, backward: true, want: false},
+		{name: "backward empty", count: 0, backward: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cursorPageFull(tt.count, 10, tt.backward); got != tt.want {
+				t.Errorf("cursorPageFull() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPageNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  int
+		before int
+		count  int
+		want   domain.PageessayResp
+	}{
+		{name: "empty", want: domain.PageessayResp{Page: 1, Pages: 1}},
+		{name: "single page", total: 4, count: 4, want: domain.PageessayResp{Total: 4, Page: 1, Pages: 1}},
+		{name: "first page", total: 25, count: 10, want: domain.PageessayResp{Total: 25, Page: 1, Pages: 3, HasNext: true}},
+		{name: "middle page", total: 25, before: 10, count: 10, want: domain.PageessayResp{Total: 25, Page: 2, Pages: 3, HasPrev: true, HasNext: true}},
+		{name: "last page", total: 25, before: 20, count: 5, want: domain.PageessayResp{Total: 25, Page: 3, Pages: 3, HasPrev: true}},
+		// 删除记录后游标不再对齐页边界, 页码按之前的记录数向下取整
+		{name: "unaligned cursor", total: 25, before: 13, count: 10, want: domain.PageessayResp{Total: 25, Page: 2, Pages: 3, HasPrev: true, HasNext: true}},
+		{name: "page capped at pages", total: 20, before: 20, count: 0, want: domain.PageessayResp{Total: 20, Page: 2, Pages: 2, HasPrev: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := domain.PageessayResp{Total: tt.total}
+			setPageNumbers(&got, tt.before, tt.count, 10)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setPageNumbers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
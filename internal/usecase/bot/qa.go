@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/llm"
+	"github.com/usual2970/retell/internal/util/zhipu"
+
+	"github.com/pocketbase/dbx"
+)
+
+const (
+	QaBackendLocal           = "local"
+	QaBackendZhipuKnowledge  = "zhipu_knowledge"
+	defaultQaPassageLimit    = 6
+	qaPassageNeighbourRadius = 1
+)
+
+const qaPrompt = `你是一个英语学习助手. 下面是从学习者自己的文章中检索到的资料, 每条资料前有编号和文章标题.
+请优先根据资料回答问题; 资料不足以回答时, 可以结合英语语法知识作答, 但要说明哪些内容不是来自资料.
+引用资料时在相应句子后用 [编号] 标注. 请用中文回答.
+
+资料:
+%s
+问题: %s`
+
+var citationReg = regexp.MustCompile(`\[(\d+)\]`)
+
+type qaUsecase struct {
+	essay   *essayUsecase
+	llm     domain.ILLM
+	backend string
+	appId   string
+}
+
+// NewQaUsecase 默认使用本地检索增强问答, QA_BACKEND=zhipu_knowledge 时改用智谱知识库应用
+func NewQaUsecase() domain.IQaUsecase {
+	backend := os.Getenv("QA_BACKEND")
+	if backend == "" {
+		backend = QaBackendLocal
+	}
+	return &qaUsecase{
+		essay:   &essayUsecase{llm: llm.Default()},
+		llm:     llm.Default(),
+		backend: backend,
+		appId:   os.Getenv("ZHIPU_KNOWLEDGE_APP_ID"),
+	}
+}
+
+func (q *qaUsecase) Ask(ctx context.Context, req *domain.AskReq) (*domain.AskResp, error) {
+	if strings.TrimSpace(req.Question) == "" {
+		return nil, errors.New("empty question")
+	}
+
+	switch q.backend {
+	case QaBackendLocal:
+		return q.askLocal(ctx, req)
+	case QaBackendZhipuKnowledge:
+		return q.askKnowledge(ctx, req)
+	}
+	return nil, fmt.Errorf("unsupported qa backend: %s", q.backend)
+}
+
+func (q *qaUsecase) askKnowledge(ctx context.Context, req *domain.AskReq) (*domain.AskResp, error) {
+	rs, err := zhipu.NewKnowledge(os.Getenv("ZHIPU_API_KEY"), q.appId).Invoke(ctx, req.Question)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AskResp{
+		Answer:    rs.Data.Content,
+		Citations: []domain.Citation{},
+	}, nil
+}
+
+func (q *qaUsecase) askLocal(ctx context.Context, req *domain.AskReq) (*domain.AskResp, error) {
+	passages, err := q.retrieve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := q.llm.Call(ctx, fmt.Sprintf(qaPrompt, qaMaterial(passages), req.Question))
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AskResp{
+		Answer:    answer,
+		Citations: citedPassages(answer, passages),
+	}, nil
+}
+
+// retrieve 取得分最高的句子, 并带上前后相邻的句子作为上下文
+func (q *qaUsecase) retrieve(ctx context.Context, req *domain.AskReq) ([]domain.Citation, error) {
+	// 问答只在机器人中使用, 检索全部文章
+	scored, err := q.essay.scoreVectors(ctx, req.Question, req.EssayId, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	sentences := make([]scoredVector, 0, len(scored))
+	for _, v := range scored {
+		if v.kind == vectorKindSentence {
+			sentences = append(sentences, v)
+		}
+	}
+	sort.SliceStable(sentences, func(i, j int) bool {
+		return sentences[i].score > sentences[j].score
+	})
+	if len(sentences) > defaultQaPassageLimit {
+		sentences = sentences[:defaultQaPassageLimit]
+	}
+
+	hits := make([]domain.SentenceHit, 0, len(sentences))
+	for _, v := range sentences {
+		hits = append(hits, domain.SentenceHit{EssayId: v.essayId})
+	}
+	titles, err := essayTitles(nil, hits)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]domain.Citation, 0, len(sentences))
+	for i, v := range sentences {
+		rs = append(rs, domain.Citation{
+			Index:   i + 1,
+			EssayId: v.essayId,
+			Title:   titles[v.essayId],
+			Text:    q.passage(v),
+		})
+	}
+	return rs, nil
+}
+
+func (q *qaUsecase) passage(v scoredVector) string {
+	records, err := app.Get().FindRecordsByFilter(vectorCollection,
+		"essay = {:essay} && kind = {:kind} && position >= {:from} && position <= {:to}", "position", 0, 0,
+		dbx.Params{
+			"essay": v.essayId,
+			"kind":  vectorKindSentence,
+			"from":  v.position - qaPassageNeighbourRadius,
+			"to":    v.position + qaPassageNeighbourRadius,
+		})
+	if err != nil || len(records) == 0 {
+		return v.text
+	}
+
+	texts := make([]string, 0, len(records))
+	for _, record := range records {
+		texts = append(texts, record.GetString("text"))
+	}
+	return strings.Join(texts, " ")
+}
+
+// qaMaterial 提示词中的资料, 每条前面是编号和文章标题
+func qaMaterial(passages []domain.Citation) string {
+	material := &strings.Builder{}
+	for _, p := range passages {
+		fmt.Fprintf(material, "[%d]《%s》%s\n", p.Index, p.Title, p.Text)
+	}
+	if len(passages) == 0 {
+		material.WriteString("(没有检索到相关资料)\n")
+	}
+	return material.String()
+}
+
+// citedIndexes 回答中 [编号] 形式引用的资料编号
+func citedIndexes(answer string) map[int]bool {
+	cited := make(map[int]bool)
+	for _, matches := range citationReg.FindAllStringSubmatch(answer, -1) {
+		if index, err := strconv.Atoi(matches[1]); err == nil {
+			cited[index] = true
+		}
+	}
+	return cited
+}
+
+// citedPassages 只保留回答中实际引用到的资料
+func citedPassages(answer string, passages []domain.Citation) []domain.Citation {
+	cited := citedIndexes(answer)
+	rs := make([]domain.Citation, 0, len(cited))
+	for _, p := range passages {
+		if cited[p.Index] {
+			rs = append(rs, p)
+		}
+	}
+	return rs
+}
@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/usual2970/retell/internal/domain"
+)
+
+func TestCitedIndexes(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   map[int]bool
+	}{
+		{name: "none", answer: "No references here.", want: map[int]bool{}},
+		{name: "single", answer: "The fox is quick [2].", want: map[int]bool{2: true}},
+		{name: "repeated", answer: "A [1]. B [3][1].", want: map[int]bool{1: true, 3: true}},
+		{name: "not a number", answer: "See [a] and [ 1 ] and [12].", want: map[int]bool{12: true}},
+		{name: "overflow", answer: "[99999999999999999999]", want: map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := citedIndexes(tt.answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("citedIndexes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCitedPassages(t *testing.T) {
+	passages := []domain.Citation{
+		{Index: 1, EssayId: "a", Title: "Fox", Text: "The quick brown fox."},
+		{Index: 2, EssayId: "a", Title: "Fox", Text: "It jumps over the dog."},
+		{Index: 3, EssayId: "b", Title: "Cat", Text: "The cat sleeps."},
+	}
+	tests := []struct {
+		name   string
+		answer string
+		want   []domain.Citation
+	}{
+		{name: "none", answer: "I don't know.", want: []domain.Citation{}},
+		{name: "keeps passage order", answer: "Cats sleep [3], foxes jump [2].", want: []domain.Citation{passages[1], passages[2]}},
+		{name: "unknown index", answer: "Something [7].", want: []domain.Citation{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := citedPassages(tt.answer, passages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("citedPassages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQaMaterial(t *testing.T) {
+	tests := []struct {
+		name     string
+		passages []domain.Citation
+		want     string
+	}{
+		{name: "empty", want: "(没有检索到相关资料)\n"},
+		{
+			name: "numbered",
+			passages: []domain.Citation{
+				{Index: 1, Title: "Fox", Text: "The quick brown fox."},
+				{Index: 2, Title: "Cat", Text: "The cat sleeps."},
+			},
+			want: "[1]《Fox》The quick brown fox.\n[2]《Cat》The cat sleeps.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := qaMaterial(tt.passages); got != tt.want {
+				t.Errorf("qaMaterial() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
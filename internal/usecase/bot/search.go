@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/str"
+	"github.com/usual2970/retell/internal/util/vector"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	vectorCollection   = "essay_vectors"
+	vectorKindEssay    = "essay"
+	vectorKindSentence = "sentence"
+)
+
+const (
+	// maxEmbeddingRunes 整篇文章向量化时截取的最大长度
+	maxEmbeddingRunes  = 2000
+	defaultSearchLimit = 5
+	// keywordBoost 文本中直接包含查询词时额外加的分数
+	keywordBoost = 0.2
+)
+
+func (e *essayUsecase) Embed(ctx context.Context, id string) error {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	content := record.GetString("content")
+	if content == "" {
+		return nil
+	}
+
+	texts := []string{truncateRunes(record.GetString("title")+"\n"+content, maxEmbeddingRunes)}
+	texts = append(texts, str.Sentences(content)...)
+
+	// 文章和所有句子合并成一次批量请求
+	vectors, err := e.llm.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("embedding count mismatch: want %d, got %d", len(texts), len(vectors))
+	}
+
+	collection, err := app.Get().FindCollectionByNameOrId(vectorCollection)
+	if err != nil {
+		return err
+	}
+
+	return app.Get().RunInTransaction(func(txApp core.App) error {
+		old, err := txApp.FindAllRecords(vectorCollection, dbx.HashExp{"essay": id})
+		if err != nil {
+			return err
+		}
+		for _, r := range old {
+			if err := txApp.Delete(r); err != nil {
+				return err
+			}
+		}
+
+		for i, text := range texts {
+			r := core.NewRecord(collection)
+			r.Set("essay", id)
+			r.Set("kind", vectorKindSentence)
+			r.Set("position", i-1)
+			if i == 0 {
+				r.Set("kind", vectorKindEssay)
+				r.Set("position", 0)
+			}
+			r.Set("text", text)
+			r.Set("vector", vectors[i])
+			if err := txApp.Save(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *essayUsecase) Search(ctx context.Context, req *domain.SearchEssayReq) (*domain.SearchEssayResp, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, errors.New("empty query")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	scored, err := e.scoreVectors(ctx, query, "", req.User, req.All)
+	if err != nil {
+		return nil, err
+	}
+
+	essayScores := make(map[string]float64)
+	sentences := make([]domain.SentenceHit, 0)
+	for _, v := range scored {
+		switch v.kind {
+		case vectorKindEssay:
+			essayScores[v.essayId] = max(essayScores[v.essayId], v.score)
+		case vectorKindSentence:
+			sentences = append(sentences, domain.SentenceHit{
+				EssayId: v.essayId,
+				Text:    v.text,
+				Score:   v.score,
+			})
+		}
+	}
+
+	// 还没有向量的文章按关键词补充
+	filter := "deleted = '' && (title ~ {:query} || content ~ {:query})"
+	params := dbx.Params{"query": query}
+	if !req.All {
+		filter += " && " + ownerFilter(req.User, params)
+	}
+	keywordRecords, err := app.Get().FindRecordsByFilter("essay", filter, "-id", limit, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range keywordRecords {
+		essayScores[record.Id] = max(essayScores[record.Id], keywordBoost)
+	}
+
+	sort.SliceStable(sentences, func(i, j int) bool {
+		return sentences[i].Score > sentences[j].Score
+	})
+	if len(sentences) > limit {
+		sentences = sentences[:limit]
+	}
+
+	essays := make([]domain.EssayHit, 0, len(essayScores))
+	for id, score := range essayScores {
+		essays = append(essays, domain.EssayHit{Id: id, Score: score})
+	}
+	sort.SliceStable(essays, func(i, j int) bool {
+		return essays[i].Score > essays[j].Score
+	})
+	if len(essays) > limit {
+		essays = essays[:limit]
+	}
+
+	titles, err := essayTitles(essays, sentences)
+	if err != nil {
+		return nil, err
+	}
+	for i := range essays {
+		essays[i].Title = titles[essays[i].Id]
+	}
+	for i := range sentences {
+		sentences[i].EssayTitle = titles[sentences[i].EssayId]
+	}
+
+	return &domain.SearchEssayResp{
+		Essays:    essays,
+		Sentences: sentences,
+	}, nil
+}
+
+type scoredVector struct {
+	essayId  string
+	kind     string
+	position int
+	text     string
+	score    float64
+}
+
+// scoreVectors 计算查询与已存储向量的得分(余弦相似度+关键词加分), 只返回得分为正的结果.
+// essayId 不为空时只在该文章内检索, all 为 false 时只检索 user 的文章.
+func (e *essayUsecase) scoreVectors(ctx context.Context, query string, essayId string, user string, all bool) ([]scoredVector, error) {
+	// 向量化失败时退化为只按关键词匹配
+	var queryVector []float32
+	if vectors, err := e.llm.CreateEmbedding(ctx, []string{query}); err != nil || len(vectors) == 0 {
+		logger.FromContext(ctx).Warn("embed search query error:", "err", err)
+	} else {
+		queryVector = vectors[0]
+	}
+
+	// 回收站里的文章不参与检索
+	essays := "SELECT id FROM essay WHERE deleted = ''"
+	params := dbx.Params{}
+	if !all {
+		essays += " AND " + ownerFilter(user, params)
+	}
+	exprs := []dbx.Expression{dbx.NewExp("essay IN ("+essays+")", params)}
+	if essayId != "" {
+		exprs = append(exprs, dbx.HashExp{"essay": essayId})
+	}
+	records, err := app.Get().FindAllRecords(vectorCollection, exprs...)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]scoredVector, 0)
+	for _, record := range records {
+		text := record.GetString("text")
+		score := keywordScore(text, query)
+		if queryVector != nil {
+			stored := make([]float32, 0)
+			if err := record.UnmarshalJSONField("vector", &stored); err == nil {
+				score += vector.Cosine(queryVector, stored)
+			}
+		}
+		if score <= 0 {
+			continue
+		}
+
+		rs = append(rs, scoredVector{
+			essayId:  record.GetString("essay"),
+			kind:     record.GetString("kind"),
+			position: record.GetInt("position"),
+			text:     text,
+			score:    score,
+		})
+	}
+	return rs, nil
+}
+
+func essayTitles(essays []domain.EssayHit, sentences []domain.SentenceHit) (map[string]string, error) {
+	ids := make([]string, 0, len(essays)+len(sentences))
+	for _, hit := range essays {
+		ids = append(ids, hit.Id)
+	}
+	for _, hit := range sentences {
+		ids = append(ids, hit.EssayId)
+	}
+
+	rs := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return rs, nil
+	}
+
+	records, err := app.Get().FindRecordsByIds("essay", ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		rs[record.Id] = record.GetString("title")
+	}
+	return rs, nil
+}
+
+func keywordScore(text, query string) float64 {
+	if strings.Contains(strings.ToLower(text), strings.ToLower(query)) {
+		return keywordBoost
+	}
+	return 0
+}
+
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n])
+}
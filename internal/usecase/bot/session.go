@@ -6,48 +6,172 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/usual2970/retell/internal/domain"
-	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/dispatcher"
+	"github.com/usual2970/retell/internal/util/extract"
 	xhttp "github.com/usual2970/retell/internal/util/http"
+	"github.com/usual2970/retell/internal/util/i18n"
+	"github.com/usual2970/retell/internal/util/logger"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
 	KindAddessay = "essay"
+	KindAsk      = "ask"
+	KindEdit     = "edit"
 )
 
 const (
-	StateWaitTitle   = "wait_title"
-	SteteWaitContent = "wait_content"
+	StateWaitTitle       = "wait_title"
+	SteteWaitContent     = "wait_content"
+	StateWaitQuestion    = "wait_question"
+	StateWaitOcrConfirm  = "wait_ocr_confirm"
+	StateWaitEditTitle   = "wait_edit_title"
+	StateWaitEditContent = "wait_edit_content"
+	StateWaitAppend      = "wait_append"
 )
 
 const perPageSize = 10
 
+// maxCallbackData 按钮回调数据的最大字节数
+const maxCallbackData = 64
+
+// callbacks 按钮回调数据中冒号前的部分
+var callbacks = map[string]bool{
+	"add":         true,
+	"list":        true,
+	"return2menu": true,
+	"next":        true,
+	"prev":        true,
+	"sort":        true,
+	"type":        true,
+	"noop":        true,
+	"essay":       true,
+	"delete":      true,
+	"confirm":     true,
+	"keep":        true,
+	"undo":        true,
+	"trash":       true,
+	"restore":     true,
+	"edit":        true,
+	"retitle":     true,
+	"rewrite":     true,
+	"append":      true,
+	"adddone":     true,
+	"addcancel":   true,
+	"ocrok":       true,
+	"ocrdrop":     true,
+	"editsave":    true,
+	"editdiscard": true,
+	"versions":    true,
+	"version":     true,
+	"revert":      true,
+	"explain":     true,
+	"ask":         true,
+	"cover":       true,
+	"anki":        true,
+	"ankinew":     true,
+	"ankireview":  true,
+	"lang":        true,
+}
+
+// toastError 需要告诉用户的错误, 按钮回调出错时作为提示文字
+type toastError string
+
+func (e toastError) Error() string {
+	return string(e)
+}
+
+// callbackToast 按钮回调出错时的提示文字
+func callbackToast(l *i18n.Localizer, err error) string {
+	var toast toastError
+	if errors.As(err, &toast) {
+		return string(toast)
+	}
+	return l.T("common.failed")
+}
+
 type Session struct {
 	ChatID int64
 	Kind   string
 	State  string // 添加文章
 
 	bot *tgbotapi.BotAPI
+	// dispatcher 回调中的后续消息和流式编辑也经过它发送
+	dispatcher *dispatcher.Dispatcher
+
+	essay       *domain.AddessayReq
+	essayParts  int    // 已经收到的内容条数
+	importTitle string // 导入的网页或文档自带的标题
+	ocrText     string // 等待确认的图片识别结果
+
+	ocr domain.IOcr // 为空时使用默认的识别服务
 
-	essay *domain.AddessayReq
+	askEssayId string // 针对某篇文章提问
+
+	listSort  string // 文章列表的排序方式
+	listType  string // 文章列表按类型筛选
+	listTrash bool   // 当前列表是否为回收站
+
+	editId  string                 // 正在编辑的文章
+	editReq *domain.UpdateessayReq // 预览过、等待保存的修改
+
+	tr             *i18n.Localizer // 当前更新使用的语言
+	language       string          // 用户用 /language 选择的语言, 为空时跟随 Telegram
+	languageLoaded bool
 }
 
-func NewSession(chatID int64, bot *tgbotapi.BotAPI) *Session {
+func NewSession(chatID int64, bot *tgbotapi.BotAPI, d *dispatcher.Dispatcher) *Session {
 	return &Session{
-		ChatID: chatID,
-		bot:    bot,
+		ChatID:     chatID,
+		bot:        bot,
+		dispatcher: d,
 	}
 }
 
-func (s *Session) Process(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+// send 在回调中发送后续消息, 与回复一样经过 dispatcher 的限速和重试
+func (s *Session) send(ctx context.Context, items ...domain.TgChatItem) error {
+	return s.dispatcher.Dispatch(ctx, s.ChatID, items)
+}
 
+func (s *Session) Process(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	s.localize(ctx, update)
 	return s.processUpdate(ctx, update)
 }
 
+// handlerName 更新对应的处理器名称, 取值有限, 用作指标标签
+func (s *Session) handlerName(update tgbotapi.Update) string {
+	if update.CallbackQuery != nil {
+		name, _, _ := strings.Cut(update.CallbackData(), ":")
+		if !callbacks[name] {
+			name = "unknown"
+		}
+		return "callback:" + name
+	}
+
+	if update.Message.IsCommand() {
+		// 其他命令统一记为 unknown
+		name := update.Message.Command()
+		if findCommand(name) == nil {
+			name = "unknown"
+		}
+		return "command:" + name
+	}
+
+	if s.Kind == "" && !isImport(update.Message) {
+		return "text:assistant"
+	}
+	if s.Kind == "" {
+		return "text:" + KindAddessay
+	}
+	return "text:" + s.Kind
+}
+
 func (s *Session) processUpdate(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
 	// 处理命令
 	if update.CallbackQuery != nil {
@@ -61,114 +185,421 @@ func (s *Session) processUpdate(ctx context.Context, update tgbotapi.Update) ([]
 	return s.processText(ctx, update)
 }
 
-func (s *Session) processCommand(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+// startAdd 开始添加文章, 先等待标题
+func (s *Session) startAdd(update tgbotapi.Update) []domain.TgChatItem {
+	s.clearState()
+	s.Kind = KindAddessay
+	s.State = StateWaitTitle
+	s.essay = &domain.AddessayReq{}
+
+	text := s.T("add.prompt", strings.Join(extract.Extensions, " "))
+	keyboards := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.T("common.cancel"), "addcancel"),
+	))
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}
+}
 
-	msg := update.Message
-	switch update.Message.Command() {
-	case "start", "menu":
-		// 发送欢迎消息
-		reply := tgbotapi.NewMessage(msg.From.ID, "欢迎使用英语文章背诵机器人")
-		reply.ReplyMarkup = getKeyBoards()
+func (s *Session) search(ctx context.Context, chatID int64, query string) ([]domain.TgChatItem, error) {
+	if strings.TrimSpace(query) == "" {
+		reply := tgbotapi.NewMessage(chatID, s.T("search.usage"))
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
 
+	rs, err := s.getessayUc().Search(ctx, &domain.SearchEssayReq{Query: query, All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs.Essays) == 0 && len(rs.Sentences) == 0 {
+		reply := tgbotapi.NewMessage(chatID, s.T("search.empty"))
+		reply.ReplyMarkup = getReturnKeyBoards(s.localizer())
 		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
 
+	text := &strings.Builder{}
+	text.WriteString(s.T("search.title", query) + "\n")
+	if len(rs.Sentences) > 0 {
+		text.WriteString("\n" + s.T("search.sentences") + "\n")
+		for _, hit := range rs.Sentences {
+			text.WriteString(s.T("search.hit", hit.Text, hit.EssayTitle) + "\n")
+		}
 	}
 
-	return nil, errors.New("unknown command")
+	reply := tgbotapi.NewMessage(chatID, truncateMessage(text.String()))
+	reply.ReplyMarkup = getSearchKeyBoards(s.localizer(), rs.Essays)
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
 }
 
-var detailReg = regexp.MustCompile(`essay:(.+)$`)
-var deleteReg = regexp.MustCompile(`delete:(.+)$`)
-var nextReg = regexp.MustCompile(`next:(.*)$`)
+var detailReg = regexp.MustCompile(`^essay:(.+)$`)
+var deleteReg = regexp.MustCompile(`^delete:(.+)$`)
+var confirmReg = regexp.MustCompile(`^confirm:(.+)$`)
+var keepReg = regexp.MustCompile(`^keep:(.+)$`)
+var undoReg = regexp.MustCompile(`^undo:(.+)$`)
+var restoreReg = regexp.MustCompile(`^restore:(.+)$`)
+var editReg = regexp.MustCompile(`^edit:(.+)$`)
+var retitleReg = regexp.MustCompile(`^retitle:(.+)$`)
+var rewriteReg = regexp.MustCompile(`^rewrite:(.+)$`)
+var appendReg = regexp.MustCompile(`^append:(.+)$`)
+var versionsReg = regexp.MustCompile(`^versions:(.+)$`)
+var versionReg = regexp.MustCompile(`^version:(.+)$`)
+var revertReg = regexp.MustCompile(`^revert:(.+)$`)
+var nextReg = regexp.MustCompile(`^next:(.+)$`)
+var prevReg = regexp.MustCompile(`^prev:(.+)$`)
+var sortReg = regexp.MustCompile(`^sort:(.+)$`)
+var typeReg = regexp.MustCompile(`^type:(.*)$`)
+var explainReg = regexp.MustCompile(`^explain:(.+)$`)
+var askReg = regexp.MustCompile(`^ask:(.+)$`)
+var coverReg = regexp.MustCompile(`^cover:(.+)$`)
+var langReg = regexp.MustCompile(`^lang:(.+)$`)
 
 func (s *Session) processCallback(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
 
 	data := update.CallbackData()
 	switch data {
 	case "add":
-		// 开始添加文章
-		s.Kind = KindAddessay
-		s.State = StateWaitTitle
+		return s.startAdd(update), nil
+	case "adddone":
+		return s.finishImport(ctx, update)
+	case "addcancel":
+		return s.cancelImport(ctx, update)
+	case "ocrok":
+		return s.confirmOcr(ctx, update)
+	case "ocrdrop":
+		return s.dropOcr(ctx, update)
+	case "list":
+		s.listTrash = false
+		return s.list(ctx, update, "", false)
+	case "trash":
+		s.listTrash = true
+		return s.list(ctx, update, "", false)
+	case "editsave":
+		return s.saveEdit(ctx, update)
+	case "editdiscard":
+		return s.discardEdit(ctx, update)
+	case "anki":
+		return s.ankiMenu(update)
+	case "ankinew":
+		return s.exportAnki(ctx, update, false)
+	case "ankireview":
+		return s.exportAnki(ctx, update, true)
+	case "noop":
+		// 页码等只用于展示的按钮
+		return nil, nil
 
-		reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, "请输入文章标题")
+	case "return2menu":
+		keyboards := getKeyBoards(s.localizer())
+		return []domain.TgChatItem{s.edit(update, s.T("menu.welcome"), "", &keyboards)}, nil
 
-		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
-	case "list":
-		essays, err := s.getessayUc().List(ctx, &domain.ListessayReq{
-			Filter: "1=1",
-			Limit:  perPageSize,
-		})
-		if err != nil {
-			return nil, err
-		}
+	}
 
-		reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, "*文章列表*")
-		reply.ParseMode = "MarkdownV2"
-		reply.ReplyMarkup = getessayListKeyBoards(essays)
-		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	if matches := nextReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.turnPage(ctx, update, matches[1], false)
+	}
 
-	case "return2menu":
-		reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, "欢迎使用英语文章背诵机器人")
-		reply.ReplyMarkup = getKeyBoards()
+	if matches := prevReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.turnPage(ctx, update, matches[1], true)
+	}
 
-		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	if matches := sortReg.FindStringSubmatch(data); len(matches) == 2 {
+		s.listTrash = false
+		s.listSort = matches[1]
+		return s.list(ctx, update, "", false)
+	}
 
+	if matches := typeReg.FindStringSubmatch(data); len(matches) == 2 {
+		s.listTrash = false
+		s.listType = matches[1]
+		return s.list(ctx, update, "", false)
 	}
 
-	if matches := nextReg.FindStringSubmatch(data); len(matches) == 2 {
+	if matches := detailReg.FindStringSubmatch(data); len(matches) == 2 {
 		id := matches[1]
+		return s.detail(ctx, id, update)
+	}
 
-		req := &domain.ListessayReq{
-			Limit: perPageSize,
-		}
-		req.Filter = "1=1"
-		if id != "" {
-			req.Filter = "id < '" + id + "'"
+	if matches := deleteReg.FindStringSubmatch(data); len(matches) == 2 {
+		id := matches[1]
+		return s.delete(ctx, id, update)
+	}
+
+	if matches := confirmReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.confirmDelete(ctx, matches[1], update)
+	}
+
+	if matches := editReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.editMenu(ctx, matches[1], update)
+	}
+
+	if matches := retitleReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.startEdit(ctx, matches[1], StateWaitEditTitle, update)
+	}
+
+	if matches := rewriteReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.startEdit(ctx, matches[1], StateWaitEditContent, update)
+	}
+
+	if matches := appendReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.startEdit(ctx, matches[1], StateWaitAppend, update)
+	}
+
+	if matches := versionsReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.versions(ctx, matches[1], update)
+	}
+
+	if matches := versionReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.version(ctx, matches[1], update)
+	}
+
+	if matches := revertReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.revert(ctx, matches[1], update)
+	}
+
+	if matches := keepReg.FindStringSubmatch(data); len(matches) == 2 {
+		// 编辑时点取消也会回到详情
+		if s.Kind == KindEdit {
+			s.clearState()
 		}
-		essays, err := s.getessayUc().List(ctx, req)
+		essay, err := s.getessayUc().Detail(ctx, matches[1])
 		if err != nil {
 			return nil, err
 		}
+		return s.showDetail(essay, update), nil
+	}
 
-		reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, "*文章列表*")
-		reply.ParseMode = "MarkdownV2"
-		reply.ReplyMarkup = getessayListKeyBoards(essays)
+	if matches := undoReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.undo(ctx, matches[1], update)
+	}
 
-		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	if matches := restoreReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.restore(ctx, matches[1], update)
 	}
 
-	if matches := detailReg.FindStringSubmatch(data); len(matches) == 2 {
+	if matches := explainReg.FindStringSubmatch(data); len(matches) == 2 {
 		id := matches[1]
-		return s.detail(ctx, id, update)
+		return s.explain(ctx, id, update)
 	}
 
-	if matches := deleteReg.FindStringSubmatch(data); len(matches) == 2 {
+	if matches := askReg.FindStringSubmatch(data); len(matches) == 2 {
+		s.Kind = KindAsk
+		s.State = StateWaitQuestion
+		s.askEssayId = matches[1]
+
+		reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, s.T("ask.prompt"))
+		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	}
+
+	if matches := coverReg.FindStringSubmatch(data); len(matches) == 2 {
 		id := matches[1]
-		return s.delete(ctx, id, update)
+		return s.regenerateCover(ctx, id, update)
 	}
 
-	app.Get().Logger().Info("process callback", "data", update.CallbackData(), "query", *update.CallbackQuery)
+	if matches := langReg.FindStringSubmatch(data); len(matches) == 2 {
+		return s.chooseLanguage(ctx, matches[1], update)
+	}
 
-	return nil, errors.New("unknown command")
+	logger.FromContext(ctx).Warn("unknown callback", "data", update.CallbackData())
+
+	return nil, toastError(s.T("common.expired"))
 }
 
+// delete 删除前先确认
 func (s *Session) delete(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	text := s.T("delete.prompt", essay.Title)
+	keyboards := getConfirmKeyBoards(s.localizer(), id)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// confirmDelete 移入回收站, 撤销时限内可以直接撤销
+func (s *Session) confirmDelete(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if err := s.getessayUc().Delete(ctx, id); err != nil {
 		return nil, err
 	}
+	logger.FromContext(ctx).Info("essay deleted", "essay_id", id)
 
-	essays, err := s.getessayUc().List(ctx, &domain.ListessayReq{
-		Filter: "1=1",
-		Limit:  perPageSize,
+	text := s.T("delete.done", essay.Title, s.localizer().Duration(UndoWindow()))
+	keyboards := getDeletedKeyBoards(s.localizer(), id)
+	return []domain.TgChatItem{s.edit(update, text, "", &keyboards)}, nil
+}
+
+// undo 撤销删除, 超过时限后只能到回收站恢复
+func (s *Session) undo(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !essay.Deleted.IsZero() {
+		if undoExpired(essay.Deleted, time.Now(), UndoWindow()) {
+			return nil, toastError(s.T("delete.expired"))
+		}
+		if err := s.getessayUc().Restore(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.showDetail(essay, update), nil
+}
+
+// showDetail 把按钮所在的消息恢复成文章详情
+func (s *Session) showDetail(essay *domain.Essay, update tgbotapi.Update) []domain.TgChatItem {
+	text, parseMode := detailText(essay)
+	keyboards := getDetailKeyBoards(s.localizer(), *essay)
+	return []domain.TgChatItem{s.edit(update, text, parseMode, &keyboards)}
+}
+
+// restore 从回收站恢复后回到回收站列表
+func (s *Session) restore(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	essay, err := s.getessayUc().Detail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.getessayUc().Restore(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.page(ctx, update, "", false, s.T("trash.restored", essay.Title))
+}
+
+// list 按会话中的排序和类型展示 cursor 前后一页文章, cursor 为空时展示第一页
+func (s *Session) list(ctx context.Context, update tgbotapi.Update, cursor string, backward bool) ([]domain.TgChatItem, error) {
+	return s.page(ctx, update, cursor, backward, "")
+}
+
+// turnPage 翻页按钮带着列表状态时先恢复, 重启或清空会话后仍按原来的排序和筛选翻页
+func (s *Session) turnPage(ctx context.Context, update tgbotapi.Update, data string, backward bool) ([]domain.TgChatItem, error) {
+	cursor, ok := parsePageCursor(data)
+	if ok {
+		s.listSort, s.listType, s.listTrash = cursor.sort, cursor.essayType, cursor.trash
+	}
+	return s.list(ctx, update, cursor.id, backward)
+}
+
+// page 展示文章列表或回收站的一页, notice 不为空时显示在标题前面
+func (s *Session) page(ctx context.Context, update tgbotapi.Update, cursor string, backward bool, notice string) ([]domain.TgChatItem, error) {
+	rs, err := s.getessayUc().Page(ctx, &domain.PageessayReq{
+		Sort:      s.listSort,
+		EssayType: s.listType,
+		Cursor:    cursor,
+		Backward:  backward,
+		Trash:     s.listTrash,
+		Limit:     perPageSize,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, "*文章列表*")
-	reply.ParseMode = "MarkdownV2"
-	reply.ReplyMarkup = getessayListKeyBoards(essays)
-	return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	text := &strings.Builder{}
+	if notice != "" {
+		text.WriteString(tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, notice) + "\n\n")
+	}
+
+	var keyboards tgbotapi.InlineKeyboardMarkup
+	if s.listTrash {
+		text.WriteString(markdownTitle(s.T("trash.title"), s.N("list.total", rs.Total)) + "\n")
+		text.WriteString(tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s.N("trash.purge", TrashDays())))
+		keyboards = getTrashKeyBoards(s.localizer(), rs, s.listSort, s.listType)
+	} else {
+		text.WriteString(markdownTitle(s.T("list.title"), s.N("list.total", rs.Total)))
+		if s.listType != "" {
+			text.WriteString("\n" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s.T("list.type", s.listType)))
+		}
+		keyboards = getessayListKeyBoards(s.localizer(), rs, s.listSort, s.listType)
+	}
+
+	return []domain.TgChatItem{s.edit(update, text.String(), "MarkdownV2", &keyboards)}, nil
+}
+
+// markdownTitle 加粗的标题和后面的说明, 都需要转义
+func markdownTitle(title, suffix string) string {
+	return "*" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, title) + "* " + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, suffix)
+}
+
+// edit 按钮回调时把按钮所在的消息编辑成新内容, 消息无法编辑时发送新消息
+func (s *Session) edit(update tgbotapi.Update, text, parseMode string, keyboards *tgbotapi.InlineKeyboardMarkup) domain.TgChatItem {
+	reply := tgbotapi.NewMessage(s.ChatID, text)
+	reply.ParseMode = parseMode
+	if keyboards != nil {
+		reply.ReplyMarkup = *keyboards
+	}
+
+	// 音频、图片等消息没有正文, 只能发送新消息
+	query := update.CallbackQuery
+	if query == nil || query.Message == nil || query.Message.Text == "" {
+		return *domain.NewTgChatItem(reply)
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ParseMode = parseMode
+	edit.ReplyMarkup = keyboards
+
+	item := domain.NewTgChatItem(edit)
+	item.Fallback = reply
+	return *item
+}
+
+// explain 先发送占位消息, 发送成功后把流式生成的讲解逐步编辑到这条消息上
+func (s *Session) explain(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	l := s.localizer()
+	reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, l.T("explain.loading"))
+
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply, func(message tgbotapi.Message) error {
+		editor := newStreamEditor(ctx, s.dispatcher, message)
+		if _, err := s.getessayUc().Explain(ctx, id, editor.Write); err != nil {
+			editor.Fail(l.T("explain.failed"))
+			return err
+		}
+		return editor.Close()
+	})}, nil
+}
+
+// regenerateCover 先发送占位消息, 封面生成后发送新封面
+func (s *Session) regenerateCover(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	ctx = logger.With(ctx, "essay_id", id)
+	chatID := update.CallbackQuery.From.ID
+	l := s.localizer()
+	reply := tgbotapi.NewMessage(chatID, l.T("cover.loading"))
+
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply, func(message tgbotapi.Message) error {
+		editor := newStreamEditor(ctx, s.dispatcher, message)
+		if err := s.getessayUc().RegenerateCover(ctx, id); err != nil {
+			editor.Fail(l.T("cover.failed"))
+			return err
+		}
+
+		// 音频的 file_id 带着旧封面, 清空后下次查看时重新上传
+		if err := s.getessayUc().UpdateFileId(ctx, id, ""); err != nil {
+			return err
+		}
+
+		essay, err := s.getessayUc().Detail(ctx, id)
+		if err != nil {
+			return err
+		}
+		editor.Write(ctx, []byte(l.T("cover.done")))
+		if err := editor.Close(); err != nil {
+			return err
+		}
+
+		thumbBytes, err := xhttp.Req(essay.Thumb, http.MethodGet, nil, map[string]string{})
+		if err != nil {
+			return err
+		}
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
+			Name:  essay.Title,
+			Bytes: thumbBytes,
+		})
+		photo.Caption = essay.Title
+		return s.send(ctx, *domain.NewTgChatItem(photo))
+	})}, nil
 }
 
 func (s *Session) detail(ctx context.Context, id string, update tgbotapi.Update) ([]domain.TgChatItem, error) {
@@ -176,6 +607,14 @@ func (s *Session) detail(ctx context.Context, id string, update tgbotapi.Update)
 	if err != nil {
 		return nil, err
 	}
+	if !essay.Deleted.IsZero() {
+		return nil, toastError(s.T("detail.trashed"))
+	}
+
+	// 查看文章视为学习了一次, 用于按最久未学习排序
+	if err := s.getessayUc().MarkStudied(ctx, id); err != nil {
+		logger.FromContext(ctx).Warn("mark essay studied error:", "err", err, "essay_id", id)
+	}
 
 	rs := make([]domain.TgChatItem, 0)
 	callbacks := make([]domain.TgCallback, 0)
@@ -199,7 +638,7 @@ func (s *Session) detail(ctx context.Context, id string, update tgbotapi.Update)
 			}
 		}
 
-		app.Get().Logger().Info("download file", "url", essay.File)
+		logger.FromContext(ctx).Debug("download file", "essay_id", essay.Id)
 		callbacks = append(callbacks, func(message tgbotapi.Message) error {
 
 			return s.getessayUc().UpdateFileId(ctx, essay.Id, message.Audio.FileID)
@@ -213,79 +652,152 @@ func (s *Session) detail(ctx context.Context, id string, update tgbotapi.Update)
 		rs = append(rs, *domain.NewTgChatItem(audio, callbacks...))
 	}
 
+	text, parseMode := detailText(essay)
+	reply := tgbotapi.NewMessage(update.CallbackQuery.From.ID, text)
+	reply.ParseMode = parseMode
+	reply.ReplyMarkup = getDetailKeyBoards(s.localizer(), *essay)
+	rs = append(rs, *domain.NewTgChatItem(reply))
+
+	return rs, nil
+}
+
+// detailText 文章详情的文字部分, 有 telegraph 页面时只发链接
+func detailText(essay *domain.Essay) (string, string) {
 	tpl := `
 *%s*
 
 %s
 		`
 
-	var reply tgbotapi.MessageConfig
 	if essay.Telegraph != "" {
-		reply = tgbotapi.NewMessage(update.CallbackQuery.From.ID, essay.Telegraph)
-
-	} else {
-		reply = tgbotapi.NewMessage(update.CallbackQuery.From.ID, fmt.Sprintf(tpl, essay.Title, essay.Content))
-
-		reply.ParseMode = "Markdown"
-
+		return essay.Telegraph, ""
 	}
-
-	reply.ReplyMarkup = getDetailKeyBoards(*essay)
-	rs = append(rs, *domain.NewTgChatItem(reply))
-
-	return rs, nil
+	return fmt.Sprintf(tpl, essay.Title, essay.Content), "Markdown"
 }
 
 func (s *Session) processText(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
 	switch s.Kind {
 	case KindAddessay:
 		return s.processessay(ctx, update)
+	case KindEdit:
+		return s.previewEdit(ctx, update)
+	case KindAsk:
+		req := &domain.AskReq{Question: update.Message.Text, EssayId: s.askEssayId}
+		s.clearState()
+		return s.answer(ctx, update.Message.From.ID, req)
+	case "":
+		if isImport(update.Message) {
+			s.startImport()
+			return s.processessay(ctx, update)
+		}
+		return s.ask(ctx, update)
 	}
 
 	return nil, errors.New("unknown command")
 
 }
 
-func (s *Session) processessay(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+// ask 不在任何流程中的文字消息当作提问, 交给学习助手回答
+func (s *Session) ask(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+	question := update.Message.Text
+	if question == "" {
+		return nil, errors.New("empty question")
+	}
 
-	switch s.State {
-	case StateWaitTitle:
-		s.essay = &domain.AddessayReq{
-			Title: update.Message.Text,
+	l := s.localizer()
+	reply := tgbotapi.NewMessage(update.Message.From.ID, l.T("ask.thinking"))
+
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply, func(message tgbotapi.Message) error {
+		editor := newStreamEditor(ctx, s.dispatcher, message)
+		answer, err := NewAssistantUsecase().Ask(ctx, question)
+		if err != nil {
+			editor.Fail(l.T("ask.failed"))
+			return err
 		}
-		s.State = SteteWaitContent
-		reply := tgbotapi.NewMessage(update.Message.From.ID, "请输入文章内容")
-		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
-	case SteteWaitContent:
-		s.essay.Content = update.Message.Text
-		reply := tgbotapi.NewMessage(update.Message.From.ID, "文章已保存")
+		editor.Write(ctx, []byte(answer))
+		return editor.Close()
+	})}, nil
+}
 
-		reply.ReplyMarkup = getReturnKeyBoards()
+// answer 先发送占位消息, 再把带引用的回答编辑到这条消息上
+func (s *Session) answer(ctx context.Context, chatID int64, req *domain.AskReq) ([]domain.TgChatItem, error) {
+	l := s.localizer()
+	reply := tgbotapi.NewMessage(chatID, l.T("ask.searching"))
 
-		if err := s.getessayUc().Add(ctx, s.essay); err != nil {
-			app.Get().Logger().Info("Addessay error", "error", err)
-			return nil, err
+	return []domain.TgChatItem{*domain.NewTgChatItem(reply, func(message tgbotapi.Message) error {
+		editor := newStreamEditor(ctx, s.dispatcher, message)
+		rs, err := NewQaUsecase().Ask(ctx, req)
+		if err != nil {
+			editor.Fail(l.T("ask.failed"))
+			return err
 		}
 
-		app.Get().Logger().Info("essay", "essay", *s.essay)
-		s.clearState()
+		text := &strings.Builder{}
+		text.WriteString(rs.Answer)
+		if len(rs.Citations) > 0 {
+			text.WriteString("\n\n" + l.T("ask.citations") + "\n")
+			for _, c := range rs.Citations {
+				text.WriteString(l.T("ask.citation", c.Index, c.Title, c.Text) + "\n")
+			}
+		}
+		editor.Write(ctx, []byte(text.String()))
+		return editor.Close()
+	})}, nil
+}
+
+func (s *Session) processessay(ctx context.Context, update tgbotapi.Update) ([]domain.TgChatItem, error) {
+
+	// 等待确认时收到新的图片或文档, 之前的识别结果直接加入文章
+	if s.State == StateWaitOcrConfirm && isImport(update.Message) {
+		if err := s.keepOcr(); err != nil {
+			return []domain.TgChatItem{s.importFailed(update.Message, err)}, nil
+		}
+	}
+
+	// 图片先识别文字, 确认后再加入文章
+	if isImage(update.Message) {
+		s.State = SteteWaitContent
+		return s.recognize(ctx, update)
+	}
+
+	switch s.State {
+	case StateWaitTitle:
+		// 直接发送内容时跳过标题, 保存时再推断
+		if !isTitle(update.Message) {
+			s.State = SteteWaitContent
+			return s.collectPart(ctx, update)
+		}
 
+		s.essay.Title = strings.TrimSpace(update.Message.Text)
+		s.State = SteteWaitContent
+		reply := tgbotapi.NewMessage(update.Message.From.ID, s.T("add.content"))
 		return []domain.TgChatItem{*domain.NewTgChatItem(reply)}, nil
+	case SteteWaitContent:
+		return s.collectPart(ctx, update)
+	case StateWaitOcrConfirm:
+		// 发送的文字是修改后的识别结果
+		s.ocrText = ""
+		s.State = SteteWaitContent
+		return s.collectPart(ctx, update)
 	}
 
 	return nil, errors.New("unknown command")
 }
 
 func (s *Session) getessayUc() domain.IessayUsecase {
-	return &essayUsecase{
-		bot: s.bot,
-	}
+	return NewessayUsecase(s.bot)
 }
 
 func (s *Session) clearState() {
 	s.State = ""
 	s.Kind = ""
 	s.essay = nil
+	s.essayParts = 0
+	s.importTitle = ""
+	s.ocrText = ""
+	s.askEssayId = ""
+	s.editId = ""
+	s.editReq = nil
 }
 
 var sessionMap *sessionList
@@ -303,7 +815,7 @@ func ClearSessions() {
 	GetSessions().Clear()
 }
 
-func GetSession(update tgbotapi.Update, bot *tgbotapi.BotAPI) *Session {
+func GetSession(update tgbotapi.Update, bot *tgbotapi.BotAPI, d *dispatcher.Dispatcher) *Session {
 	var chatID int64
 	if update.CallbackQuery != nil {
 		chatID = update.CallbackQuery.From.ID
@@ -312,10 +824,7 @@ func GetSession(update tgbotapi.Update, bot *tgbotapi.BotAPI) *Session {
 	}
 	session, ok := GetSessions().GetSession(chatID)
 	if !ok {
-		session = &Session{
-			ChatID: chatID,
-			bot:    bot,
-		}
+		session = NewSession(chatID, bot, d)
 		AddSession(session)
 	}
 
@@ -351,58 +860,227 @@ func (s *sessionList) GetSession(chatID int64) (*Session, bool) {
 	return rs, ok
 }
 
+func (s *sessionList) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.sessions)
+}
+
 func (s *sessionList) Clear() {
 	s.Lock()
 	defer s.Unlock()
 	s.sessions = make(map[int64]*Session)
 }
 
-func getKeyBoards() tgbotapi.InlineKeyboardMarkup {
+func getKeyBoards(l *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
 
 	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
 		{
-			tgbotapi.NewInlineKeyboardButtonData("添加文章", "add"),
-			tgbotapi.NewInlineKeyboardButtonData("文章列表", "list"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("menu.add"), "add"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("menu.list"), "list"),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("menu.anki"), "anki"),
 		},
 	}...)
 
 }
 
 // 将文章列表组织成keyboards
-func getessayListKeyBoards(essays []domain.Essay) tgbotapi.InlineKeyboardMarkup {
+func getessayListKeyBoards(l *i18n.Localizer, page *domain.PageessayResp, sort, essayType string) tgbotapi.InlineKeyboardMarkup {
 	rs := make([][]tgbotapi.InlineKeyboardButton, 0)
-	for _, e := range essays {
+	for _, e := range page.Items {
 		rs = append(rs, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(e.Title, "essay:"+e.Id)})
 	}
 
-	buttons := []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("返回到菜单", "return2menu"),
+	if buttons := getPageButtons(l, page, pageCursor{sort: sort, essayType: essayType}); len(buttons) > 0 {
+		rs = append(rs, buttons)
 	}
 
-	if len(essays) == perPageSize {
-		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("下一页", "next:"+essays[len(essays)-1].Id))
+	if sort == "" {
+		sort = domain.EssaySortNewest
+	}
+	sorts := make([]tgbotapi.InlineKeyboardButton, 0, len(sortNames))
+	for _, item := range sortNames {
+		sorts = append(sorts, tgbotapi.NewInlineKeyboardButtonData(checked(l.T(item.name), item.sort == sort), "sort:"+item.sort))
+	}
+	rs = append(rs, sorts)
+
+	if len(page.Types) > 0 {
+		types := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(checked(l.T("common.all"), essayType == ""), "type:")}
+		for _, t := range page.Types {
+			// 过长的类型无法放进按钮
+			if len("type:"+t) > maxCallbackData {
+				continue
+			}
+			if len(types) == typesPerRow {
+				rs = append(rs, types)
+				types = make([]tgbotapi.InlineKeyboardButton, 0, typesPerRow)
+			}
+			types = append(types, tgbotapi.NewInlineKeyboardButtonData(checked(t, essayType == t), "type:"+t))
+		}
+		rs = append(rs, types)
 	}
 
-	rs = append(rs, buttons)
+	rs = append(rs, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(l.T("trash.title"), "trash"),
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
+	})
 	return tgbotapi.NewInlineKeyboardMarkup(rs...)
 }
 
-func getReturnKeyBoards() tgbotapi.InlineKeyboardMarkup {
+// getPageButtons 翻页按钮和页码, 只有一页时为空, state 是当前列表的排序和筛选
+func getPageButtons(l *i18n.Localizer, page *domain.PageessayResp, state pageCursor) []tgbotapi.InlineKeyboardButton {
+	if !page.HasPrev && !page.HasNext {
+		return nil
+	}
+
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, 3)
+	if page.HasPrev {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(l.T("list.prev"), state.at(page.Items[0].Id).data("prev")))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page.Page, page.Pages), "noop"))
+	if page.HasNext {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(l.T("list.next"), state.at(page.Items[len(page.Items)-1].Id).data("next")))
+	}
+	return buttons
+}
+
+// pageCursor 翻页按钮的回调数据 next:<id>:<sort>:<trash>:<type>.
+// 带上列表状态, 重启或清空会话后旧按钮仍然可用.
+type pageCursor struct {
+	id        string
+	sort      string
+	essayType string
+	trash     bool
+}
+
+func (c pageCursor) at(id string) pageCursor {
+	c.id = id
+	return c
+}
+
+// data 放不下时只带游标, 翻页时使用会话中的状态
+func (c pageCursor) data(action string) string {
+	trash := ""
+	if c.trash {
+		trash = "1"
+	}
+	rs := strings.Join([]string{action, c.id, c.sort, trash, c.essayType}, ":")
+	if len(rs) > maxCallbackData {
+		return action + ":" + c.id
+	}
+	return rs
+}
+
+// parsePageCursor 解析冒号后的部分, 只有游标时 ok 为 false.
+// 类型在最后, 可以包含冒号.
+func parsePageCursor(data string) (cursor pageCursor, ok bool) {
+	parts := strings.SplitN(data, ":", 4)
+	cursor.id = parts[0]
+	if len(parts) < 4 {
+		return cursor, false
+	}
+	cursor.sort, cursor.trash, cursor.essayType = parts[1], parts[2] == "1", parts[3]
+	return cursor, true
+}
+
+// 回收站中的文章组织成keyboards, 点击即恢复
+func getTrashKeyBoards(l *i18n.Localizer, page *domain.PageessayResp, sort, essayType string) tgbotapi.InlineKeyboardMarkup {
+	rs := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, e := range page.Items {
+		rs = append(rs, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(l.T("trash.restore", e.Title), "restore:"+e.Id)})
+	}
+
+	if buttons := getPageButtons(l, page, pageCursor{sort: sort, essayType: essayType, trash: true}); len(buttons) > 0 {
+		rs = append(rs, buttons)
+	}
+
+	rs = append(rs, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.list"), "list"),
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
+	})
+	return tgbotapi.NewInlineKeyboardMarkup(rs...)
+}
+
+func getConfirmKeyBoards(l *i18n.Localizer, id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("delete.confirm"), "confirm:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.cancel"), "keep:"+id),
+		},
+	}...)
+}
+
+func getDeletedKeyBoards(l *i18n.Localizer, id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("delete.undo"), "undo:"+id),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("trash.title"), "trash"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.list"), "list"),
+		},
+	}...)
+}
+
+// sortNames 列表排序按钮, name 是文案的键
+var sortNames = []struct {
+	sort string
+	name string
+}{
+	{sort: domain.EssaySortNewest, name: "list.sort.newest"},
+	{sort: domain.EssaySortTitle, name: "list.sort.title"},
+	{sort: domain.EssaySortStudied, name: "list.sort.studied"},
+}
+
+const typesPerRow = 4
+
+// checked 当前选中的选项前面加上对勾
+func checked(name string, ok bool) string {
+	if ok {
+		return "✓ " + name
+	}
+	return name
+}
+
+// 搜索到的文章组织成keyboards
+func getSearchKeyBoards(l *i18n.Localizer, essays []domain.EssayHit) tgbotapi.InlineKeyboardMarkup {
+	rs := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, e := range essays {
+		rs = append(rs, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(e.Title, "essay:"+e.Id)})
+	}
+
+	rs = append(rs, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
+	})
+	return tgbotapi.NewInlineKeyboardMarkup(rs...)
+}
+
+func getReturnKeyBoards(l *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
 
 	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
 		{
-			tgbotapi.NewInlineKeyboardButtonData("返回到菜单", "return2menu"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
 		},
 	}...)
 
 }
 
-func getDetailKeyBoards(essay domain.Essay) tgbotapi.InlineKeyboardMarkup {
+func getDetailKeyBoards(l *i18n.Localizer, essay domain.Essay) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup([][]tgbotapi.InlineKeyboardButton{
 		{
-			tgbotapi.NewInlineKeyboardButtonData("删除文章", "delete:"+essay.Id),
-			tgbotapi.NewInlineKeyboardButtonData("返回到列表", "list"),
-			tgbotapi.NewInlineKeyboardButtonData("返回到菜单", "return2menu"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("detail.explain"), "explain:"+essay.Id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("detail.ask"), "ask:"+essay.Id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("detail.delete"), "delete:"+essay.Id),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("detail.edit"), "edit:"+essay.Id),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("detail.cover"), "cover:"+essay.Id),
+		},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.list"), "list"),
+			tgbotapi.NewInlineKeyboardButtonData(l.T("common.menu"), "return2menu"),
 		},
 	}...)
 }
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/usual2970/retell/internal/domain"
+)
+
+func TestPageCursor(t *testing.T) {
+	longType := strings.Repeat("t", 40)
+	tests := []struct {
+		name   string
+		cursor pageCursor
+		action string
+		want   string
+		full   bool
+	}{
+		{name: "default list", cursor: pageCursor{id: "abcdefghijklmno"}, action: "next", want: "next:abcdefghijklmno:::", full: true},
+		{
+			name:   "sort and type",
+			cursor: pageCursor{id: "abcdefghijklmno", sort: domain.EssaySortStudied, essayType: "news:tech"},
+			action: "prev",
+			want:   "prev:abcdefghijklmno:studied::news:tech",
+			full:   true,
+		},
+		{
+			name:   "trash",
+			cursor: pageCursor{id: "abcdefghijklmno", sort: domain.EssaySortTitle, trash: true},
+			action: "next",
+			want:   "next:abcdefghijklmno:title:1:",
+			full:   true,
+		},
+		{
+			name:   "too long keeps only the cursor",
+			cursor: pageCursor{id: "abcdefghijklmno", sort: domain.EssaySortNewest, essayType: longType},
+			action: "next",
+			want:   "next:abcdefghijklmno",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.cursor.data(tt.action)
+			if data != tt.want {
+				t.Fatalf("data() = %q, want %q", data, tt.want)
+			}
+			if len(data) > maxCallbackData {
+				t.Fatalf("data() is %d bytes, want at most %d", len(data), maxCallbackData)
+			}
+
+			got, full := parsePageCursor(strings.TrimPrefix(data, tt.action+":"))
+			if full != tt.full {
+				t.Fatalf("parsePageCursor() full = %v, want %v", full, tt.full)
+			}
+			want := tt.cursor
+			if !tt.full {
+				want = pageCursor{id: tt.cursor.id}
+			}
+			if got != want {
+				t.Errorf("parsePageCursor() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCallbackRegs(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		match *regexp.Regexp
+		miss  []*regexp.Regexp
+	}{
+		{name: "type containing sort", data: "type:resort:x", match: typeReg, miss: []*regexp.Regexp{sortReg}},
+		{name: "type containing next", data: "type:x next:y", match: typeReg, miss: []*regexp.Regexp{nextReg}},
+		{name: "page cursor with a type", data: "next:abcdefghijklmno:::essay:x", match: nextReg, miss: []*regexp.Regexp{detailReg, typeReg}},
+		{name: "versions", data: "versions:abc", match: versionsReg, miss: []*regexp.Regexp{versionReg}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.match.MatchString(tt.data) {
+				t.Errorf("%v does not match %q", tt.match, tt.data)
+			}
+			for _, reg := range tt.miss {
+				if reg.MatchString(tt.data) {
+					t.Errorf("%v matches %q", reg, tt.data)
+				}
+			}
+		})
+	}
+}
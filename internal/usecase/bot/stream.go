@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/dispatcher"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 同一条消息的编辑间隔, Telegram 对同一聊天大约每秒一条的频率限制
+const streamEditInterval = time.Second
+
+const maxMessageLength = 4096
+
+// streamEditor 把流式生成的内容逐步编辑到同一条消息上, 按 interval 节流.
+// 编辑经过 dispatcher 发送, 与其他回复共享限速和重试.
+type streamEditor struct {
+	ctx        context.Context
+	dispatcher *dispatcher.Dispatcher
+	chatID     int64
+	messageID  int
+	interval   time.Duration
+
+	text     strings.Builder
+	sent     string
+	lastEdit time.Time
+}
+
+func newStreamEditor(ctx context.Context, d *dispatcher.Dispatcher, message tgbotapi.Message) *streamEditor {
+	return &streamEditor{
+		ctx:        ctx,
+		dispatcher: d,
+		chatID:     message.Chat.ID,
+		messageID:  message.MessageID,
+		interval:   streamEditInterval,
+		lastEdit:   time.Now(),
+	}
+}
+
+// Write 可直接作为 llms.WithStreamingFunc 的回调
+func (s *streamEditor) Write(ctx context.Context, chunk []byte) error {
+	s.text.Write(chunk)
+	if time.Since(s.lastEdit) < s.interval {
+		return nil
+	}
+	s.flush()
+	return nil
+}
+
+// Close 把剩余内容编辑到消息上
+func (s *streamEditor) Close() error {
+	s.flush()
+	return nil
+}
+
+// Fail 生成失败时把错误信息追加到已输出的内容后
+func (s *streamEditor) Fail(msg string) {
+	if s.text.Len() > 0 {
+		s.text.WriteString("\n\n")
+	}
+	s.text.WriteString(msg)
+	s.flush()
+}
+
+func (s *streamEditor) flush() {
+	text := truncateMessage(s.text.String())
+	if strings.TrimSpace(text) == "" || text == s.sent {
+		return
+	}
+
+	s.lastEdit = time.Now()
+	edit := tgbotapi.NewEditMessageText(s.chatID, s.messageID, text)
+	if err := s.dispatcher.Dispatch(s.ctx, s.chatID, []domain.TgChatItem{*domain.NewTgChatItem(edit)}); err != nil {
+		// 重试后仍然失败不中断生成, 结束时会再编辑一次
+		logger.FromContext(s.ctx).Warn("edit stream message error:", "err", err, "message_id", s.messageID)
+		return
+	}
+	s.sent = text
+}
+
+func truncateMessage(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxMessageLength {
+		return text
+	}
+	return string(runes[:maxMessageLength-1]) + "…"
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	defaultUndoWindow = 5 * time.Minute
+	defaultTrashDays  = 30
+	purgeBatch        = 100
+)
+
+// UndoWindow 删除后可以直接撤销的时间, 通过 ESSAY_UNDO_WINDOW 配置, 如 10m
+func UndoWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ESSAY_UNDO_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return defaultUndoWindow
+}
+
+// TrashDays 回收站中的文章保留的天数, 通过 ESSAY_TRASH_DAYS 配置
+func TrashDays() int {
+	if days, err := strconv.Atoi(os.Getenv("ESSAY_TRASH_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return defaultTrashDays
+}
+
+// undoExpired 删除时间 deleted 到 now 是否已超过撤销时限
+func undoExpired(deleted, now time.Time, window time.Duration) bool {
+	return now.Sub(deleted) > window
+}
+
+// purgeFilter 查询 before 之前删除的文章, 时间按 pocketbase 存储的 UTC 格式比较
+func purgeFilter(before time.Time) (string, dbx.Params) {
+	return "deleted != '' && deleted < {:before}", dbx.Params{"before": before.UTC().Format(types.DefaultDateLayout)}
+}
+
+func (e *essayUsecase) Delete(ctx context.Context, id string) error {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	record.Set("deleted", types.NowDateTime())
+	return app.Get().Save(record)
+}
+
+func (e *essayUsecase) Restore(ctx context.Context, id string) error {
+	record, err := app.Get().FindRecordById("essay", id)
+	if err != nil {
+		return err
+	}
+
+	record.Set("deleted", "")
+	return app.Get().Save(record)
+}
+
+func (e *essayUsecase) Purge(ctx context.Context, before time.Time) (int, error) {
+	rs := 0
+	for {
+		filter, params := purgeFilter(before)
+		records, err := app.Get().FindRecordsByFilter("essay", filter, "deleted", purgeBatch, 0, params)
+		if err != nil {
+			return rs, err
+		}
+		if len(records) == 0 {
+			return rs, nil
+		}
+
+		// 音频和封面文件、向量随记录一起删除
+		err = app.Get().RunInTransaction(func(txApp core.App) error {
+			for _, record := range records {
+				if err := txApp.Delete(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return rs, err
+		}
+
+		rs += len(records)
+		logger.FromContext(ctx).Info("purge deleted essays", "count", len(records))
+	}
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestUndoWindow(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want time.Duration
+	}{
+		{name: "default", env: "", want: defaultUndoWindow},
+		{name: "configured", env: "10m", want: 10 * time.Minute},
+		{name: "zero falls back", env: "0s", want: defaultUndoWindow},
+		{name: "negative falls back", env: "-1m", want: defaultUndoWindow},
+		{name: "invalid falls back", env: "ten minutes", want: defaultUndoWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ESSAY_UNDO_WINDOW", tt.env)
+			if got := UndoWindow(); got != tt.want {
+				t.Errorf("UndoWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrashDays(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{name: "default", env: "", want: defaultTrashDays},
+		{name: "configured", env: "7", want: 7},
+		{name: "zero falls back", env: "0", want: defaultTrashDays},
+		{name: "negative falls back", env: "-3", want: defaultTrashDays},
+		{name: "invalid falls back", env: "7d", want: defaultTrashDays},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ESSAY_TRASH_DAYS", tt.env)
+			if got := TrashDays(); got != tt.want {
+				t.Errorf("TrashDays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUndoExpired(t *testing.T) {
+	deleted := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "just deleted", elapsed: 0, want: false},
+		{name: "within window", elapsed: 4 * time.Minute, want: false},
+		{name: "at the limit", elapsed: 5 * time.Minute, want: false},
+		{name: "expired", elapsed: 5*time.Minute + time.Second, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := undoExpired(deleted, deleted.Add(tt.elapsed), 5*time.Minute); got != tt.want {
+				t.Errorf("undoExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPurgeFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		before time.Time
+		want   dbx.Params
+	}{
+		{name: "utc", before: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), want: dbx.Params{"before": "2026-01-02 03:04:05.000Z"}},
+		{
+			name:   "local time is converted to utc",
+			before: time.Date(2026, 1, 2, 8, 4, 5, 6_000_000, time.FixedZone("CST", 8*60*60)),
+			want:   dbx.Params{"before": "2026-01-02 00:04:05.006Z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, params := purgeFilter(tt.before)
+			if filter != "deleted != '' && deleted < {:before}" {
+				t.Errorf("purgeFilter() filter = %q", filter)
+			}
+			if !reflect.DeepEqual(params, tt.want) {
+				t.Errorf("purgeFilter() params = %v, want %v", params, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/repository/ttscache"
+	"github.com/usual2970/retell/internal/util/audio"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/metrics"
+)
+
+var ttsOnce sync.Once
+
+var ttsInstance domain.ITtsUsecase
+
+type ttsUsecase struct {
+	repo  domain.ITtsCacheRepository
+	voice string
+	rate  string
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewTtsUsecase() domain.ITtsUsecase {
+	ttsOnce.Do(func() {
+		ttsInstance = &ttsUsecase{
+			repo:  ttscache.NewRepository(),
+			voice: audio.NewOptions(audio.WithVoice(os.Getenv("AZURE_SPEECH_VOICE"))).Voice,
+			rate:  os.Getenv("AZURE_SPEECH_RATE"),
+		}
+	})
+	return ttsInstance
+}
+
+// Speech 整篇文章一次合成, 保留句间停顿, 按全文缓存
+func (t *ttsUsecase) Speech(ctx context.Context, text string) ([]byte, error) {
+	return t.cached(ctx, text, func() ([]byte, error) {
+		return t.synthesize(ctx, text)
+	})
+}
+
+func (t *ttsUsecase) SentenceSpeech(ctx context.Context, text string) ([]byte, error) {
+	return t.cached(ctx, text, func() ([]byte, error) {
+		return t.synthesize(ctx, text)
+	})
+}
+
+func (t *ttsUsecase) Stats(ctx context.Context) *domain.TtsCacheStats {
+	return &domain.TtsCacheStats{
+		Hits:   t.hits.Load(),
+		Misses: t.misses.Load(),
+	}
+}
+
+func (t *ttsUsecase) cached(ctx context.Context, text string, synthesize func() ([]byte, error)) ([]byte, error) {
+	key := audio.CacheKey(audio.ProviderAzure, t.voice, t.rate, text)
+
+	if data, err := t.repo.Get(ctx, key); err == nil && len(data) > 0 {
+		t.hits.Add(1)
+		return data, nil
+	}
+	t.misses.Add(1)
+
+	data, err := synthesize()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.repo.Save(ctx, &domain.TtsCache{
+		Key:      key,
+		Provider: audio.ProviderAzure,
+		Voice:    t.voice,
+		Rate:     t.rate,
+	}, data); err != nil {
+		// 并发合成同一文本时唯一索引会冲突, 不影响本次结果
+		logger.FromContext(ctx).Warn("save tts cache error:", "err", err, "key", key)
+	}
+
+	return data, nil
+}
+
+func (t *ttsUsecase) synthesize(ctx context.Context, text string) (rs []byte, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(audio.ProviderAzure, "tts", start, err) }(time.Now())
+	return audio.Azure(ctx, text, audio.WithVoice(t.voice), audio.WithRate(t.rate))
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	versionCollection = "essay_versions"
+	// maxVersions 每篇文章最多保留的历史版本数, 更早的版本会被删除
+	maxVersions = 20
+)
+
+// saveVersion 保存修改前的标题和内容, 并删除超出数量的旧版本
+func saveVersion(txApp core.App, essayId, title, content string) error {
+	collection, err := txApp.FindCollectionByNameOrId(versionCollection)
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("essay", essayId)
+	record.Set("title", title)
+	record.Set("content", content)
+	if err := txApp.Save(record); err != nil {
+		return err
+	}
+
+	old, err := txApp.FindRecordsByFilter(versionCollection, "essay = {:essay}", "-created,-id", 0, maxVersions,
+		dbx.Params{"essay": essayId})
+	if err != nil {
+		return err
+	}
+	for _, r := range old {
+		if err := txApp.Delete(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *essayUsecase) Versions(ctx context.Context, id string) ([]domain.EssayVersion, error) {
+	records, err := app.Get().FindRecordsByFilter(versionCollection, "essay = {:essay}", "-created,-id", maxVersions, 0,
+		dbx.Params{"essay": id})
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]domain.EssayVersion, 0, len(records))
+	for _, record := range records {
+		rs = append(rs, *toVersion(record))
+	}
+	return rs, nil
+}
+
+func (e *essayUsecase) Version(ctx context.Context, versionId string) (*domain.EssayVersion, error) {
+	record, err := app.Get().FindRecordById(versionCollection, versionId)
+	if err != nil {
+		return nil, err
+	}
+	return toVersion(record), nil
+}
+
+func (e *essayUsecase) RestoreVersion(ctx context.Context, versionId string) (*domain.Essay, error) {
+	version, err := e.Version(ctx, versionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Update(ctx, &domain.UpdateessayReq{
+		Id:      version.EssayId,
+		Title:   version.Title,
+		Content: version.Content,
+	})
+}
+
+func toVersion(record *core.Record) *domain.EssayVersion {
+	return &domain.EssayVersion{
+		Meta: domain.Meta{
+			Id:      record.Id,
+			Created: record.GetDateTime("created").Time(),
+		},
+		EssayId: record.GetString("essay"),
+		Title:   record.GetString("title"),
+		Content: record.GetString("content"),
+	}
+}
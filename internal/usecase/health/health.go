@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/audio"
+	"github.com/usual2970/retell/internal/util/llm"
+	"github.com/usual2970/retell/internal/util/telegraph"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// pollStaleAfter 超过这个时间没有成功拉取更新认为轮询已经卡住
+	pollStaleAfter = 2 * time.Minute
+	probeTimeout   = 10 * time.Second
+)
+
+var errNotConfigured = errors.New("not configured")
+
+type probe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type usecase struct {
+	bot    domain.IBotUsecase
+	probes []probe
+}
+
+func New(bot domain.IBotUsecase) domain.IHealthUsecase {
+	conf := llm.ConfigFromEnv()
+
+	return &usecase{
+		bot: bot,
+		probes: []probe{
+			{
+				name: "azure",
+				check: func(ctx context.Context) error {
+					if os.Getenv("AZURE_SPEECH_KEY") == "" {
+						return errNotConfigured
+					}
+					return audio.Ping(ctx)
+				},
+			},
+			{
+				name: conf.Provider,
+				check: func(ctx context.Context) error {
+					if conf.ApiKey == "" && conf.BaseUrl == "" {
+						return errNotConfigured
+					}
+					// 只生成一个 token, 花费可以忽略
+					_, err := llm.Default().Call(ctx, "ping", llms.WithMaxTokens(1))
+					return err
+				},
+			},
+			{
+				name: "telegraph",
+				check: func(ctx context.Context) error {
+					return telegraph.New().Ping()
+				},
+			},
+		},
+	}
+}
+
+func (u *usecase) Ready(ctx context.Context) *domain.ReadyResp {
+	status := u.bot.Status(ctx)
+
+	rs := &domain.ReadyResp{
+		Ready:      true,
+		LastPollAt: status.LastPollAt,
+		Checks: []domain.CheckResult{
+			run(ctx, "database", func(ctx context.Context) error {
+				_, err := app.Get().DB().NewQuery("SELECT 1").WithContext(ctx).Execute()
+				return err
+			}),
+			run(ctx, "bot", func(ctx context.Context) error {
+				if !status.Running {
+					return errors.New("bot is " + status.State)
+				}
+				if time.Since(status.LastPollAt) > pollStaleAfter {
+					return errors.New("no successful getUpdates since " + status.LastPollAt.Format(time.RFC3339))
+				}
+				return nil
+			}),
+		},
+	}
+
+	for _, check := range rs.Checks {
+		if check.Status != domain.CheckStatusOk {
+			rs.Ready = false
+		}
+	}
+	return rs
+}
+
+func (u *usecase) Diagnostics(ctx context.Context) *domain.DiagnosticsResp {
+	rs := &domain.DiagnosticsResp{
+		Providers: make([]domain.CheckResult, len(u.probes)),
+	}
+
+	wg := sync.WaitGroup{}
+	for i, p := range u.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			rs.Providers[i] = run(ctx, p.name, p.check)
+		}()
+	}
+	wg.Wait()
+
+	return rs
+}
+
+func run(ctx context.Context, name string, check func(ctx context.Context) error) domain.CheckResult {
+	start := time.Now()
+	err := check(ctx)
+
+	rs := domain.CheckResult{
+		Name:    name,
+		Status:  domain.CheckStatusOk,
+		Latency: time.Since(start).Milliseconds(),
+	}
+	switch {
+	case errors.Is(err, errNotConfigured):
+		rs.Status = domain.CheckStatusSkipped
+		rs.Error = err.Error()
+	case err != nil:
+		rs.Status = domain.CheckStatusError
+		rs.Error = err.Error()
+	}
+	return rs
+}
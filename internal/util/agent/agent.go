@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const defaultMaxSteps = 5
+
+var ErrTooManySteps = errors.New("agent: too many steps")
+
+// Tool 可供模型调用的工具, Handler 接收模型给出的 JSON 参数并返回文本结果
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  any
+	Handler     func(ctx context.Context, arguments string) (string, error)
+}
+
+// Agent 一个简单的工具调用循环: 模型请求调用工具时执行并回传结果, 直到模型给出最终回答
+type Agent struct {
+	model    llms.Model
+	system   string
+	tools    map[string]Tool
+	defs     []llms.Tool
+	maxSteps int
+}
+
+func New(model llms.Model, system string, tools ...Tool) *Agent {
+	a := &Agent{
+		model:    model,
+		system:   system,
+		tools:    make(map[string]Tool, len(tools)),
+		defs:     make([]llms.Tool, 0, len(tools)),
+		maxSteps: defaultMaxSteps,
+	}
+	for _, tool := range tools {
+		a.tools[tool.Name] = tool
+		a.defs = append(a.defs, llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return a
+}
+
+func (a *Agent) Run(ctx context.Context, question string) (string, error) {
+	messages := make([]llms.MessageContent, 0)
+	if a.system != "" {
+		messages = append(messages, llms.TextParts(llms.ChatMessageTypeSystem, a.system))
+	}
+	messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, question))
+
+	for step := 0; step < a.maxSteps; step++ {
+		resp, err := a.model.GenerateContent(ctx, messages, llms.WithTools(a.defs))
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("agent: empty choices")
+		}
+
+		choice := resp.Choices[0]
+		if len(choice.ToolCalls) == 0 {
+			return choice.Content, nil
+		}
+
+		assistant := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		if choice.Content != "" {
+			assistant.Parts = append(assistant.Parts, llms.TextPart(choice.Content))
+		}
+		results := llms.MessageContent{Role: llms.ChatMessageTypeTool}
+		for _, call := range choice.ToolCalls {
+			name := ""
+			if call.FunctionCall != nil {
+				name = call.FunctionCall.Name
+			}
+			assistant.Parts = append(assistant.Parts, call)
+			results.Parts = append(results.Parts, llms.ToolCallResponse{
+				ToolCallID: call.ID,
+				Name:       name,
+				Content:    a.call(ctx, call),
+			})
+		}
+		messages = append(messages, assistant, results)
+	}
+
+	return "", ErrTooManySteps
+}
+
+// call 执行工具, 错误也作为结果交给模型, 由模型决定如何回答
+func (a *Agent) call(ctx context.Context, call llms.ToolCall) string {
+	if call.FunctionCall == nil {
+		return "error: empty function call"
+	}
+
+	tool, ok := a.tools[call.FunctionCall.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %s", call.FunctionCall.Name)
+	}
+
+	rs, err := tool.Handler(ctx, call.FunctionCall.Arguments)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return rs
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// fakeModel 按顺序返回预设的结果, 并记录每次收到的消息
+type fakeModel struct {
+	responses []*llms.ContentChoice
+	received  [][]llms.MessageContent
+}
+
+func (f *fakeModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	f.received = append(f.received, messages)
+	if len(f.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	rs := f.responses[0]
+	f.responses = f.responses[1:]
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{rs}}, nil
+}
+
+func (f *fakeModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
+
+func toolCall(id, name, arguments string) llms.ToolCall {
+	return llms.ToolCall{
+		ID:           id,
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+func TestAgent_Run(t *testing.T) {
+	model := &fakeModel{
+		responses: []*llms.ContentChoice{
+			{ToolCalls: []llms.ToolCall{
+				toolCall("call_1", "lookup_word", `{"word":"apple"}`),
+				toolCall("call_2", "missing", `{}`),
+			}},
+			{Content: "apple 的意思是苹果"},
+		},
+	}
+
+	a := New(model, "system", Tool{
+		Name: "lookup_word",
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			return "苹果", nil
+		},
+	})
+
+	got, err := a.Run(context.Background(), "apple 是什么意思")
+	if err != nil {
+		t.Fatalf("Agent.Run() error = %v", err)
+	}
+	if got != "apple 的意思是苹果" {
+		t.Errorf("Agent.Run() = %v", got)
+	}
+
+	if len(model.received) != 2 {
+		t.Fatalf("model called %d times, want 2", len(model.received))
+	}
+	second := model.received[1]
+	if len(second) != 4 {
+		t.Fatalf("second call messages = %d, want 4", len(second))
+	}
+	results := second[3]
+	if results.Role != llms.ChatMessageTypeTool || len(results.Parts) != 2 {
+		t.Fatalf("tool results = %+v", results)
+	}
+	want := []llms.ToolCallResponse{
+		{ToolCallID: "call_1", Name: "lookup_word", Content: "苹果"},
+		{ToolCallID: "call_2", Name: "missing", Content: "error: unknown tool missing"},
+	}
+	for i, part := range results.Parts {
+		if part.(llms.ToolCallResponse) != want[i] {
+			t.Errorf("tool result %d = %+v, want %+v", i, part, want[i])
+		}
+	}
+}
+
+func TestAgent_Run_tooManySteps(t *testing.T) {
+	model := &fakeModel{}
+	for i := 0; i < defaultMaxSteps; i++ {
+		model.responses = append(model.responses, &llms.ContentChoice{
+			ToolCalls: []llms.ToolCall{toolCall("call", "loop", `{}`)},
+		})
+	}
+
+	a := New(model, "", Tool{
+		Name: "loop",
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			return "again", nil
+		},
+	})
+
+	if _, err := a.Run(context.Background(), "q"); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("Agent.Run() error = %v, want %v", err, ErrTooManySteps)
+	}
+}
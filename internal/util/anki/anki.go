@@ -0,0 +1,410 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// 生成 Anki 2.1 可以导入的 .apkg: zip 中包含 sqlite 格式的 collection.anki2、
+// 记录媒体文件名的 media 和按序号命名的媒体文件
+
+const (
+	// fieldSeparator 笔记各字段之间的分隔符
+	fieldSeparator = "\x1f"
+	// defaultFactor 新卡片的难度系数, 对应 SM-2 的 2.5
+	defaultFactor = 2500
+	// minFactor Anki 允许的最小难度系数
+	minFactor = 1300
+	// deckIDBase 卡组 id 的起点, 同名卡组的 id 不变, 重复导入时进入同一个卡组
+	deckIDBase = 1_500_000_000_000
+)
+
+// Model 笔记类型, 同一个 ID 重复导入时 Anki 会复用已有的笔记类型
+type Model struct {
+	ID     int64
+	Name   string
+	Cloze  bool
+	Fields []string
+	// Front 和 Back 是卡片正反面的模板, 如 {{Word}}、{{cloze:Text}}
+	Front string
+	Back  string
+	CSS   string
+}
+
+// Schedule 卡片的复习进度, 为空时是新卡片
+type Schedule struct {
+	Due time.Time
+	// Interval 复习间隔, 单位天
+	Interval int
+	// Ease SM-2 的难度系数, 如 2.5
+	Ease float64
+	Reps int
+}
+
+type Note struct {
+	Model *Model
+	// Deck 卡组名称, 用 :: 分隔子卡组, 为空时使用 Package 的默认卡组
+	Deck   string
+	Fields []string
+	Tags   []string
+	// GUID 为空时由笔记类型和第一个字段生成, 重复导入时更新而不是新增
+	GUID     string
+	Schedule *Schedule
+}
+
+type media struct {
+	name string
+	data []byte
+}
+
+// Package 一个 .apkg 文件
+type Package struct {
+	deck  string
+	notes []*Note
+	media []media
+	now   time.Time
+}
+
+func New(deck string) *Package {
+	return &Package{deck: deck, now: time.Now()}
+}
+
+func (p *Package) Add(note *Note) {
+	p.notes = append(p.notes, note)
+}
+
+// AddMedia 添加音频或图片, 字段中用 [sound:name] 或 <img src="name"> 引用
+func (p *Package) AddMedia(name string, data []byte) {
+	p.media = append(p.media, media{name: name, data: data})
+}
+
+func (p *Package) Len() int {
+	return len(p.notes)
+}
+
+var clozeReg = regexp.MustCompile(`\{\{c(\d+)::`)
+
+// Cloze 用 {{cN::text}} 挖空, text 需要已经转义过
+func Cloze(n int, text string) string {
+	return "{{c" + strconv.Itoa(n) + "::" + text + "}}"
+}
+
+// Escape 把纯文本转义成字段中的 HTML
+func Escape(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+// ords 笔记生成的卡片序号, 挖空笔记每个挖空生成一张
+func (n *Note) ords() []int {
+	if !n.Model.Cloze {
+		return []int{0}
+	}
+	rs := make([]int, 0)
+	for _, field := range n.Fields {
+		for _, m := range clozeReg.FindAllStringSubmatch(field, -1) {
+			if ord, err := strconv.Atoi(m[1]); err == nil && ord > 0 && !slices.Contains(rs, ord-1) {
+				rs = append(rs, ord-1)
+			}
+		}
+	}
+	slices.Sort(rs)
+	return rs
+}
+
+// Write 生成 .apkg 写入 w
+func (p *Package) Write(w io.Writer) error {
+	dir, err := os.MkdirTemp("", "anki-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	collection := filepath.Join(dir, "collection.anki2")
+	if err := p.writeCollection(collection); err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := addFile(zw, "collection.anki2", collection); err != nil {
+		return err
+	}
+
+	names := make(map[string]string, len(p.media))
+	for i, m := range p.media {
+		key := strconv.Itoa(i)
+		names[key] = m.name
+		f, err := zw.Create(key)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(m.data); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	f, err := zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func addFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (p *Package) writeCollection(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+
+	crt := p.created()
+	models, decks, err := p.config()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		crt.Unix(), p.now.UnixMilli(), p.now.UnixMilli(), colConf, models, decks, deckConf); err != nil {
+		return err
+	}
+
+	// id 用毫秒时间戳递增, 和 Anki 自己生成的 id 格式一致
+	id := p.now.UnixMilli()
+	mod := p.now.Unix()
+	for i, note := range p.notes {
+		id++
+		noteID := id
+		sortField := stripHTML(note.Fields[0])
+		if _, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			noteID, note.guid(), note.Model.ID, mod, tags(note.Tags), strings.Join(note.Fields, fieldSeparator),
+			sortField, checksum(sortField)); err != nil {
+			return err
+		}
+
+		deckID := deckID(p.deckName(note))
+		for _, ord := range note.ords() {
+			id++
+			// 新卡片的 due 是学习顺序, 复习卡片的 due 是距离 crt 的天数
+			cardType, queue, due, ivl, factor, reps := 0, 0, i+1, 0, 0, 0
+			if s := note.Schedule; s != nil && s.Interval > 0 {
+				cardType, queue = 2, 2
+				due = int(p.due(s).Sub(crt).Hours() / 24)
+				ivl = s.Interval
+				factor = max(int(math.Round(s.Ease*1000)), minFactor)
+				if s.Ease == 0 {
+					factor = defaultFactor
+				}
+				reps = s.Reps
+			}
+			if _, err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, 0, '')`,
+				id, noteID, deckID, ord, mod, cardType, queue, due, ivl, factor, reps); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// created 集合的创建时间, 复习卡片的 due 按它计算, 取最早的到期日和今天中较早的一天
+func (p *Package) created() time.Time {
+	crt := p.now
+	for _, note := range p.notes {
+		if note.Schedule != nil && !note.Schedule.Due.IsZero() && note.Schedule.Due.Before(crt) {
+			crt = note.Schedule.Due
+		}
+	}
+	y, m, d := crt.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, crt.Location())
+}
+
+// due 没有到期时间时今天到期
+func (p *Package) due(s *Schedule) time.Time {
+	if s.Due.IsZero() {
+		return p.now
+	}
+	return s.Due
+}
+
+func (p *Package) deckName(note *Note) string {
+	if note.Deck != "" {
+		return note.Deck
+	}
+	return p.deck
+}
+
+// config 集合中的笔记类型和卡组配置
+func (p *Package) config() (string, string, error) {
+	mod := p.now.Unix()
+	models := map[string]any{}
+	decks := map[string]any{"1": deck(1, "Default", mod)}
+	for _, note := range p.notes {
+		name := p.deckName(note)
+		decks[strconv.FormatInt(deckID(name), 10)] = deck(deckID(name), name, mod)
+		if _, ok := models[strconv.FormatInt(note.Model.ID, 10)]; !ok {
+			models[strconv.FormatInt(note.Model.ID, 10)] = note.Model.config(deckID(name), mod)
+		}
+	}
+
+	m, err := json.Marshal(models)
+	if err != nil {
+		return "", "", err
+	}
+	d, err := json.Marshal(decks)
+	if err != nil {
+		return "", "", err
+	}
+	return string(m), string(d), nil
+}
+
+func (m *Model) config(did int64, mod int64) map[string]any {
+	fields := make([]map[string]any, 0, len(m.Fields))
+	for i, name := range m.Fields {
+		fields = append(fields, map[string]any{
+			"name": name, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{},
+		})
+	}
+
+	templateName, modelType := "Card 1", 0
+	if m.Cloze {
+		templateName, modelType = "Cloze", 1
+	}
+	rs := map[string]any{
+		"id":    m.ID,
+		"name":  m.Name,
+		"type":  modelType,
+		"mod":   mod,
+		"usn":   -1,
+		"sortf": 0,
+		"did":   did,
+		"tmpls": []map[string]any{{
+			"name": templateName, "ord": 0, "qfmt": m.Front, "afmt": m.Back, "did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      fields,
+		"css":       m.CSS,
+		"latexPre":  latexPre,
+		"latexPost": `\end{document}`,
+		"latexsvg":  false,
+		"tags":      []string{},
+		"vers":      []any{},
+	}
+	// 第一个字段不为空时生成卡片
+	if !m.Cloze {
+		rs["req"] = []any{[]any{0, "any", []int{0}}}
+	}
+	return rs
+}
+
+func deck(id int64, name string, mod int64) map[string]any {
+	return map[string]any{
+		"id": id, "name": name, "desc": "", "mod": mod, "usn": -1, "conf": 1, "dyn": 0,
+		"collapsed": false, "browserCollapsed": false, "extendNew": 10, "extendRev": 50,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+	}
+}
+
+func deckID(name string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return deckIDBase + int64(h.Sum32())
+}
+
+func (n *Note) guid() string {
+	if n.GUID != "" {
+		return n.GUID
+	}
+	return GUID(n.Model.Name, n.Fields[0])
+}
+
+const base91 = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+
+// GUID 由内容生成的笔记 guid, 和 genanki 一样用 base91 编码
+func GUID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, fieldSeparator)))
+	n := binary.BigEndian.Uint64(sum[:8])
+	rs := make([]byte, 0, 10)
+	for n > 0 {
+		rs = append(rs, base91[n%91])
+		n /= 91
+	}
+	slices.Reverse(rs)
+	return string(rs)
+}
+
+var (
+	tagReg   = regexp.MustCompile(`<[^>]*>`)
+	soundReg = regexp.MustCompile(`\[sound:[^\]]*\]`)
+)
+
+// stripHTML 排序字段和校验和使用去掉标签的文字
+func stripHTML(field string) string {
+	field = soundReg.ReplaceAllString(field, "")
+	return strings.TrimSpace(html.UnescapeString(tagReg.ReplaceAllString(field, "")))
+}
+
+// checksum 第一个字段 sha1 的前 8 位, Anki 用来查找重复笔记
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(field))
+	n, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	return n
+}
+
+// tags 标签中不能有空格, 前后各带一个空格
+func tags(items []string) string {
+	rs := make([]string, 0, len(items))
+	for _, tag := range items {
+		if tag = strings.Join(strings.Fields(tag), "_"); tag != "" && !slices.Contains(rs, tag) {
+			rs = append(rs, tag)
+		}
+	}
+	if len(rs) == 0 {
+		return ""
+	}
+	return " " + strings.Join(rs, " ") + " "
+}
@@ -0,0 +1,141 @@
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	basic = &Model{ID: 1001, Name: "Basic", Fields: []string{"Front", "Back"}, Front: "{{Front}}", Back: "{{FrontSide}}<hr id=answer>{{Back}}"}
+	cloze = &Model{ID: 1002, Name: "Cloze", Cloze: true, Fields: []string{"Text"}, Front: "{{cloze:Text}}", Back: "{{cloze:Text}}"}
+)
+
+func TestPackage_Write(t *testing.T) {
+	p := New("Retell")
+	p.now = time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)
+	p.Add(&Note{Model: basic, Fields: []string{"fox [sound:fox.mp3]", "狐狸"}, Tags: []string{"retell", "animal words"}})
+	p.Add(&Note{Model: basic, Deck: "Retell::Words", Fields: []string{"<b>dog</b>", "狗"}, Schedule: &Schedule{
+		Due: time.Date(2024, 5, 8, 9, 0, 0, 0, time.UTC), Interval: 6, Ease: 2.36, Reps: 3,
+	}})
+	p.Add(&Note{Model: cloze, Fields: []string{"The " + Cloze(1, "quick") + " brown " + Cloze(2, "fox") + " jumps " + Cloze(1, "over") + "."}})
+	p.AddMedia("fox.mp3", []byte("ID3 fox"))
+
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	if string(files["media"]) != `{"0":"fox.mp3"}` || string(files["0"]) != "ID3 fox" {
+		t.Errorf("media = %s, 0 = %s", files["media"], files["0"])
+	}
+
+	path := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(path, files["collection.anki2"], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var crt int64
+	var models, decks string
+	if err := db.QueryRow("SELECT crt, models, decks FROM col").Scan(&crt, &models, &decks); err != nil {
+		t.Fatal(err)
+	}
+	// 复习卡片的到期日早于今天, crt 取到期那天
+	if want := time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC).Unix(); crt != want {
+		t.Errorf("crt = %d, want %d", crt, want)
+	}
+	m := map[string]map[string]any{}
+	if err := json.Unmarshal([]byte(models), &m); err != nil || m["1001"]["name"] != "Basic" || m["1002"]["type"] != float64(1) {
+		t.Errorf("models = %s, %v", models, err)
+	}
+	d := map[string]map[string]any{}
+	if err := json.Unmarshal([]byte(decks), &d); err != nil || len(d) != 3 {
+		t.Errorf("decks = %s, %v", decks, err)
+	}
+
+	rows, err := db.Query("SELECT n.sfld, n.tags, n.csum, c.ord, c.type, c.queue, c.due, c.ivl, c.factor, c.reps FROM cards c JOIN notes n ON n.id = c.nid ORDER BY c.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type card struct {
+		sfld, tags                           string
+		csum                                 int64
+		ord, typ, queue, due, ivl, fac, reps int
+	}
+	text := "The {{c1::quick}} brown {{c2::fox}} jumps {{c1::over}}."
+	want := []card{
+		{sfld: "fox", tags: " retell animal_words ", csum: checksum("fox"), due: 1},
+		{sfld: "dog", csum: checksum("dog"), typ: 2, queue: 2, due: 0, ivl: 6, fac: 2360, reps: 3},
+		{sfld: text, csum: checksum(text), due: 3},
+		{sfld: text, csum: checksum(text), ord: 1, due: 3},
+	}
+	got := make([]card, 0)
+	for rows.Next() {
+		c := card{}
+		if err := rows.Scan(&c.sfld, &c.tags, &c.csum, &c.ord, &c.typ, &c.queue, &c.due, &c.ivl, &c.fac, &c.reps); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("cards = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("card %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGUID(t *testing.T) {
+	if GUID("Basic", "fox") != GUID("Basic", "fox") {
+		t.Error("GUID() should be stable")
+	}
+	if GUID("Basic", "fox") == GUID("Basic", "dog") {
+		t.Error("GUID() should differ")
+	}
+	for _, r := range GUID("Basic", "fox") {
+		if !bytes.ContainsRune([]byte(base91), r) {
+			t.Errorf("GUID() contains %q", r)
+		}
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := map[string]string{
+		"fox [sound:fox.mp3]":        "fox",
+		"<b>Tom &amp; Jerry</b><br>": "Tom & Jerry",
+		"plain":                      "plain",
+	}
+	for field, want := range tests {
+		if got := stripHTML(field); got != want {
+			t.Errorf("stripHTML(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
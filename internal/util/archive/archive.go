@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/usual2970/retell/internal/util/hash"
+)
+
+// 归档是一个 zip 文件:
+//
+//	manifest.json
+//	essays/0001-the-jumping-fox/essay.json  标题、内容、句子、单词和复习进度
+//	essays/0001-the-jumping-fox/essay.md    方便直接阅读, 也可以单独导入
+//	essays/0001-the-jumping-fox/audio.mp3
+//	essays/0001-the-jumping-fox/cover.jpg
+
+// Version 归档格式的版本, 格式不兼容时加一
+const Version = 1
+
+const (
+	manifestName = "manifest.json"
+	essayDir     = "essays"
+	essayJSON    = "essay.json"
+	essayMD      = "essay.md"
+	// maxFileSize 归档中单个文件的最大大小, 防止解压出超大文件
+	maxFileSize = 100 << 20
+	// slugMaxRunes 目录名中标题部分最多保留的字数
+	slugMaxRunes = 40
+)
+
+var (
+	// ErrVersion 归档由更新的版本导出, 当前版本无法识别
+	ErrVersion = errors.New("unsupported archive version")
+	// ErrTooLarge 归档中的文件超过 maxFileSize
+	ErrTooLarge = errors.New("file in archive too large")
+)
+
+type Manifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Essays     int       `json:"essays"`
+	Words      int       `json:"words"`
+}
+
+// Essay 一篇文章和它的学习数据, Audio 和 Cover 是同一目录下的文件名
+type Essay struct {
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	Type      string          `json:"type,omitempty"`
+	VideoLink string          `json:"videoLink,omitempty"`
+	Sentences json.RawMessage `json:"sentences,omitempty"`
+	StudiedAt time.Time       `json:"studiedAt,omitzero"`
+	// Hash 内容的哈希, 导入时用来去重
+	Hash  string `json:"hash"`
+	Audio string `json:"audio,omitempty"`
+	Cover string `json:"cover,omitempty"`
+	Words []Word `json:"words,omitempty"`
+}
+
+// Word 生词和它的复习进度
+type Word struct {
+	Word         string          `json:"word"`
+	Labels       json.RawMessage `json:"labels,omitempty"`
+	Means        json.RawMessage `json:"means,omitempty"`
+	Proficiency  string          `json:"proficiency,omitempty"`
+	NeedReviewAt time.Time       `json:"needReviewAt,omitzero"`
+	Repetitions  float64         `json:"repetitions"`
+	Interval     float64         `json:"interval"`
+	Easiness     float64         `json:"easiness"`
+}
+
+// Hash 忽略空白差异的内容哈希
+func Hash(content string) string {
+	return hash.Sha1(strings.Join(strings.Fields(content), " "))
+}
+
+// Writer 把文章逐篇写入 zip, Close 时写入 manifest
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		zw:       zip.NewWriter(w),
+		manifest: Manifest{Version: Version, ExportedAt: time.Now().UTC()},
+	}
+}
+
+// Add 写入一篇文章, media 的 key 是 Audio、Cover 中的文件名
+func (w *Writer) Add(essay *Essay, media map[string][]byte) error {
+	w.manifest.Essays++
+	w.manifest.Words += len(essay.Words)
+	if essay.Hash == "" {
+		essay.Hash = Hash(essay.Content)
+	}
+
+	dir := path.Join(essayDir, fmt.Sprintf("%04d-%s", w.manifest.Essays, slug(essay.Title)))
+
+	data, err := json.MarshalIndent(essay, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.write(path.Join(dir, essayJSON), data, zip.Deflate); err != nil {
+		return err
+	}
+	if err := w.write(path.Join(dir, essayMD), Markdown(essay), zip.Deflate); err != nil {
+		return err
+	}
+
+	for _, name := range []string{essay.Audio, essay.Cover} {
+		if name == "" {
+			continue
+		}
+		// 音频和图片本身已经压缩过
+		if err := w.write(path.Join(dir, name), media[name], zip.Store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) write(name string, data []byte, method uint16) error {
+	f, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: w.manifest.ExportedAt})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func (w *Writer) Close() error {
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.write(manifestName, data, zip.Deflate); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// slug 文章目录名, 只保留字母、数字和连字符
+func slug(title string) string {
+	sb := &strings.Builder{}
+	count := 0
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if count >= slugMaxRunes {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			count++
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteRune('-')
+			dash = true
+		}
+	}
+	if rs := strings.Trim(sb.String(), "-"); rs != "" {
+		return rs
+	}
+	return "essay"
+}
+
+// Entry 从归档或文件夹中读出的一篇文章
+type Entry struct {
+	Essay
+	// Source 文章在归档中的路径, 用于提示导入失败的文件
+	Source string
+	Err    error
+
+	fsys fs.FS
+	dir  string
+}
+
+// Media 读取文章的音频或封面
+func (e *Entry) Media(name string) ([]byte, error) {
+	return readFile(e.fsys, path.Join(e.dir, path.Base(name)))
+}
+
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
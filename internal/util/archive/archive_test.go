@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWriter_Read(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	essay := &Essay{
+		Title:     "The Jumping Fox",
+		Content:   "The quick brown fox jumps over the lazy dog.",
+		Type:      "news",
+		Sentences: json.RawMessage(`[{"text":"The quick brown fox jumps over the lazy dog.","begin_time":"0","end_time":"2100"}]`),
+		StudiedAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		Audio:     "audio.mp3",
+		Cover:     "cover.jpg",
+		Words: []Word{
+			{Word: "quick", Means: json.RawMessage(`["快的"]`), Proficiency: "2", Repetitions: 3, Interval: 6, Easiness: 2.5},
+		},
+	}
+	media := map[string][]byte{"audio.mp3": []byte("ID3 audio"), "cover.jpg": []byte("jpeg")}
+	if err := w.Add(essay, media); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(&Essay{Title: "第二篇", Content: "敏捷的棕色狐狸。"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Read(zr)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Read() = %d entries, want 2", len(entries))
+	}
+
+	got := entries[0]
+	if got.Err != nil || got.Source != "essays/0001-the-jumping-fox/essay.json" {
+		t.Fatalf("Read() entry = %q, %v", got.Source, got.Err)
+	}
+	if got.Title != essay.Title || got.Content != essay.Content || got.Type != "news" || !got.StudiedAt.Equal(essay.StudiedAt) {
+		t.Errorf("Read() essay = %+v", got.Essay)
+	}
+	if got.Hash != Hash(essay.Content) || compact(got.Sentences) != string(essay.Sentences) {
+		t.Errorf("Read() hash = %q sentences = %s", got.Hash, got.Sentences)
+	}
+	if len(got.Words) != 1 || got.Words[0].Word != "quick" || got.Words[0].Interval != 6 || compact(got.Words[0].Means) != `["快的"]` {
+		t.Errorf("Read() words = %+v", got.Words)
+	}
+	if data, err := got.Media(got.Audio); err != nil || string(data) != "ID3 audio" {
+		t.Errorf("Media() = %q, %v", data, err)
+	}
+	if entries[1].Source != "essays/0002-第二篇/essay.json" || entries[1].Title != "第二篇" {
+		t.Errorf("Read() entry = %q %q", entries[1].Source, entries[1].Title)
+	}
+}
+
+func compact(data json.RawMessage) string {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+func TestRead_Folder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"notes/lesson-01.md":                        {Data: []byte("# Morning Routine\n\nI get up at **seven**.\n")},
+		"notes/lesson-02.txt":                       {Data: []byte("I walk to school.\n")},
+		"notes/empty.md":                            {Data: []byte("---\ntitle: Empty\n---\n")},
+		"notes/.draft.md":                           {Data: []byte("draft")},
+		"__MACOSX/notes/._lesson-01.md":             {Data: []byte("junk")},
+		"backup/essays/0001-fox/essay.json":         {Data: []byte(`{"title":"Fox","content":"The fox jumps."}`)},
+		"backup/essays/0001-fox/essay.md":           {Data: []byte("---\ntitle: \"Fox\"\n---\n\nThe fox jumps.\n")},
+		"backup/essays/0002-broken/essay.json":      {Data: []byte(`{"title":`)},
+		"backup/essays/0003-markdown-only/essay.md": {Data: []byte("---\ntitle: 'It''s fine'\ntype: story\n---\n\nStill imported.")},
+		"readme.pdf":                                {Data: []byte("%PDF")},
+	}
+
+	entries, err := Read(fsys)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := []struct {
+		source string
+		title  string
+		typ    string
+		err    bool
+	}{
+		{source: "backup/essays/0001-fox/essay.json", title: "Fox"},
+		{source: "backup/essays/0002-broken/essay.json", err: true},
+		{source: "backup/essays/0003-markdown-only/essay.md", title: "It's fine", typ: "story"},
+		{source: "notes/empty.md", err: true},
+		{source: "notes/lesson-01.md", title: "Morning Routine"},
+		{source: "notes/lesson-02.txt", title: "lesson-02"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Read() = %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		got := entries[i]
+		if got.Source != w.source || (got.Err != nil) != w.err {
+			t.Errorf("entry %d = %q err %v, want %q err %v", i, got.Source, got.Err, w.source, w.err)
+			continue
+		}
+		if !w.err && (got.Title != w.title || got.Type != w.typ || got.Hash == "") {
+			t.Errorf("entry %d = %q %q %q", i, got.Title, got.Type, got.Hash)
+		}
+	}
+	if entries[4].Content != "I get up at seven." {
+		t.Errorf("markdown content = %q", entries[4].Content)
+	}
+}
+
+func TestRead_Version(t *testing.T) {
+	fsys := fstest.MapFS{manifestName: {Data: []byte(`{"version":99}`)}}
+	if _, err := Read(fsys); !errors.Is(err, ErrVersion) {
+		t.Errorf("Read() error = %v, want %v", err, ErrVersion)
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		title   string
+		content string
+	}{
+		{name: "front matter", file: "a.md", data: "---\ntitle: \"Say \\\"hi\\\"\"\n---\n\n# Heading\n\nBody.", title: `Say "hi"`, content: "Heading\n\nBody."},
+		{name: "heading", file: "a.md", data: "# Heading\n\nBody.", title: "Heading", content: "Body."},
+		{name: "file name", file: "dir/My Notes.md", data: "Body.", title: "My Notes", content: "Body."},
+		{name: "unclosed front matter", file: "a.txt", data: "---\ntitle: x\nBody.", title: "a", content: "---\ntitle: x\nBody."},
+		{name: "round trip", file: "essay.md", data: string(Markdown(&Essay{Title: "狐狸: 第一课", Content: "Line one.\n\nLine two."})), title: "狐狸: 第一课", content: "Line one.\n\nLine two."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			essay, err := ParseMarkdown(tt.file, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseMarkdown() error = %v", err)
+			}
+			if essay.Title != tt.title || essay.Content != tt.content {
+				t.Errorf("ParseMarkdown() = %q %q, want %q %q", essay.Title, essay.Content, tt.title, tt.content)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	if Hash("The fox\n\njumps.") != Hash("  The fox jumps. ") {
+		t.Error("Hash() should ignore whitespace")
+	}
+	if Hash("The fox jumps.") == Hash("The fox jumped.") {
+		t.Error("Hash() should differ for different content")
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"The Jumping Fox!":  "the-jumping-fox",
+		"  --- ":            "essay",
+		"狐狸 & the Dog":      "狐狸-the-dog",
+		"Unit 3: A/B tests": "unit-3-a-b-tests",
+	}
+	for title, want := range tests {
+		if got := slug(title); got != want {
+			t.Errorf("slug(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
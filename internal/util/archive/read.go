@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/usual2970/retell/internal/util/extract"
+)
+
+// documents 文件夹中可以直接导入的文本文件
+var documents = []string{".md", ".markdown", ".txt"}
+
+// Read 读取导出的归档或者 Markdown 文件夹, 读取失败的文章 Err 不为空
+func Read(fsys fs.FS) ([]*Entry, error) {
+	if data, err := readFile(fsys, manifestName); err == nil {
+		manifest := Manifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		if manifest.Version > Version {
+			return nil, ErrVersion
+		}
+	}
+
+	entries := make([]*Entry, 0)
+	texts := make([]string, 0)
+	// 有 essay.json 的目录, 其中的 essay.md 不再单独导入
+	essays := map[string]bool{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && hidden(d.Name()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+		case d.Name() == essayJSON:
+			essays[path.Dir(name)] = true
+			entries = append(entries, readEssay(fsys, name))
+		case slices.Contains(documents, strings.ToLower(path.Ext(name))):
+			texts = append(texts, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range texts {
+		if essays[path.Dir(name)] {
+			continue
+		}
+		entries = append(entries, readText(fsys, name))
+	}
+	return entries, nil
+}
+
+// hidden 隐藏文件和 macOS 压缩时带上的 __MACOSX 目录
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "__MACOSX"
+}
+
+func readEssay(fsys fs.FS, name string) *Entry {
+	entry := &Entry{Source: name, fsys: fsys, dir: path.Dir(name)}
+
+	data, err := readFile(fsys, name)
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+	if err := json.Unmarshal(data, &entry.Essay); err != nil {
+		entry.Err = err
+		return entry
+	}
+	if strings.TrimSpace(entry.Content) == "" {
+		entry.Err = extract.ErrEmpty
+		return entry
+	}
+	if entry.Title == "" {
+		entry.Title = extract.InferTitle(entry.Content)
+	}
+	// 哈希以内容为准, 不相信归档中记录的值
+	entry.Hash = Hash(entry.Content)
+	return entry
+}
+
+func readText(fsys fs.FS, name string) *Entry {
+	entry := &Entry{Source: name, fsys: fsys, dir: path.Dir(name)}
+
+	data, err := readFile(fsys, name)
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+	essay, err := ParseMarkdown(name, data)
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+	entry.Essay = *essay
+	return entry
+}
+
+// ParseMarkdown 解析 Markdown 或纯文本文章, 标题依次取 front matter、一级标题、文件名
+func ParseMarkdown(name string, data []byte) (*Essay, error) {
+	meta, body := frontMatter(data)
+
+	doc, err := extract.File(name, body)
+	if err != nil {
+		return nil, err
+	}
+
+	essay := &Essay{
+		Title:   meta["title"],
+		Content: doc.Content,
+		Type:    meta["type"],
+		Hash:    Hash(doc.Content),
+	}
+	if essay.Title == "" {
+		essay.Title = doc.Title
+	}
+	if essay.Title == "" {
+		essay.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	return essay, nil
+}
+
+// Markdown 带 front matter 的文章, 可以用 ParseMarkdown 读回
+func Markdown(essay *Essay) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("---\n")
+	buf.WriteString("title: " + strconv.Quote(essay.Title) + "\n")
+	if essay.Type != "" {
+		buf.WriteString("type: " + strconv.Quote(essay.Type) + "\n")
+	}
+	buf.WriteString("---\n\n")
+	buf.WriteString(essay.Content)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// frontMatter 拆出开头 --- 之间的 key: value, 没有时原样返回
+func frontMatter(data []byte) (map[string]string, []byte) {
+	meta := map[string]string{}
+
+	text := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+	if !strings.HasPrefix(text, "---\n") {
+		return meta, data
+	}
+	head, body, ok := strings.Cut(text[4:], "\n---")
+	if !ok {
+		return meta, data
+	}
+	// 结束的 --- 必须单独一行
+	rest, ok := strings.CutPrefix(body, "\n")
+	if !ok && body != "" {
+		return meta, data
+	}
+
+	for _, line := range strings.Split(head, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		meta[strings.ToLower(strings.TrimSpace(key))] = unquote(strings.TrimSpace(value))
+	}
+	return meta, []byte(rest)
+}
+
+func unquote(value string) string {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if rs, err := strconv.Unquote(value); err == nil {
+			return rs
+		}
+		return strings.Trim(value, `"`)
+	case len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
@@ -14,13 +14,51 @@ import (
 	"github.com/hashicorp/golang-lru/v2/expirable"
 )
 
-var xml = `
+const ProviderAzure = "azure"
+
+const DefaultAzureVoice = "en-US-AndrewMultilingualNeural"
+
+const azureTokenUrl = "https://eastus.api.cognitive.microsoft.com/sts/v1.0/issueToken"
+
+var ssml = `
 <speak version='1.0' xml:lang='en-US'><voice xml:lang='en-US' xml:gender='Male'
-name='en-US-AndrewMultilingualNeural'>
+name='%s'>
 	%s
 </voice></speak>
 `
 
+type Options struct {
+	Voice string
+	Rate  string
+}
+
+type Option func(o *Options)
+
+func WithVoice(voice string) Option {
+	return func(o *Options) {
+		if voice != "" {
+			o.Voice = voice
+		}
+	}
+}
+
+// WithRate 设置语速, 取值同 SSML prosody 的 rate, 如 "-10%"、"slow"
+func WithRate(rate string) Option {
+	return func(o *Options) {
+		o.Rate = rate
+	}
+}
+
+func NewOptions(opts ...Option) *Options {
+	options := &Options{
+		Voice: DefaultAzureVoice,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
 var cacheAzure *expirable.LRU[string, string]
 
 var cacheOnceAzure sync.Once
@@ -34,13 +72,18 @@ func newAzureTokenCache() *expirable.LRU[string, string] {
 	return cacheAzure
 }
 
-func Azure(ctx context.Context, text string) ([]byte, error) {
+func Azure(ctx context.Context, text string, opts ...Option) ([]byte, error) {
+	options := NewOptions(opts...)
+
 	token, err := getToken(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	body := fmt.Sprintf(xml, text)
+	if options.Rate != "" {
+		text = fmt.Sprintf("<prosody rate='%s'>%s</prosody>", options.Rate, text)
+	}
+	body := fmt.Sprintf(ssml, options.Voice, text)
 
 	resp, err := xhttp.Req("https://eastus.tts.speech.microsoft.com/cognitiveservices/v1", http.MethodPost, strings.NewReader(body), map[string]string{
 		"Authorization":            "Bearer " + token,
@@ -53,6 +96,22 @@ func Azure(ctx context.Context, text string) ([]byte, error) {
 	return resp, nil
 }
 
+// Ping 用订阅密钥换取一次令牌, 检查密钥是否仍然有效
+func Ping(ctx context.Context) error {
+	resp, err := xhttp.Stream(ctx, azureTokenUrl, http.MethodPost, nil, map[string]string{
+		"Ocp-Apim-Subscription-Key": os.Getenv("AZURE_SPEECH_KEY"),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("azure issue token: %s", resp.Status)
+	}
+	return nil
+}
+
 func getToken(_ context.Context) (string, error) {
 
 	cache := newAzureTokenCache()
@@ -61,7 +120,7 @@ func getToken(_ context.Context) (string, error) {
 		return rs, nil
 	}
 	speechKey := os.Getenv("AZURE_SPEECH_KEY")
-	resp, err := xhttp.Req("https://eastus.api.cognitive.microsoft.com/sts/v1.0/issueToken", http.MethodPost, nil, map[string]string{
+	resp, err := xhttp.Req(azureTokenUrl, http.MethodPost, nil, map[string]string{
 		"Ocp-Apim-Subscription-Key": speechKey,
 	})
 
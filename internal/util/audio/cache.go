@@ -0,0 +1,17 @@
+package audio
+
+import (
+	"strings"
+
+	"github.com/usual2970/retell/internal/util/hash"
+)
+
+// Normalize 折叠空白字符, 使排版上的差异不会产生不同的缓存键
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// CacheKey 根据服务商、音色、语速和归一化后的文本生成合成结果的缓存键
+func CacheKey(provider, voice, rate, text string) string {
+	return hash.Sha1(strings.Join([]string{provider, voice, rate, Normalize(text)}, "\x00"))
+}
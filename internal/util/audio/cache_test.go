@@ -0,0 +1,58 @@
+package audio
+
+import "testing"
+
+func TestCacheKey(t *testing.T) {
+	base := CacheKey(ProviderAzure, DefaultAzureVoice, "", "Hello world. How are you?")
+
+	tests := []struct {
+		name     string
+		provider string
+		voice    string
+		rate     string
+		text     string
+		wantSame bool
+	}{
+		{
+			name:     "same text",
+			provider: ProviderAzure,
+			voice:    DefaultAzureVoice,
+			text:     "Hello world. How are you?",
+			wantSame: true,
+		},
+		{
+			name:     "whitespace only differs",
+			provider: ProviderAzure,
+			voice:    DefaultAzureVoice,
+			text:     "  Hello   world.\n How are\tyou? ",
+			wantSame: true,
+		},
+		{
+			name:     "different voice",
+			provider: ProviderAzure,
+			voice:    "en-US-JennyNeural",
+			text:     "Hello world. How are you?",
+		},
+		{
+			name:     "different rate",
+			provider: ProviderAzure,
+			voice:    DefaultAzureVoice,
+			rate:     "-10%",
+			text:     "Hello world. How are you?",
+		},
+		{
+			name:     "different provider",
+			provider: "other",
+			voice:    DefaultAzureVoice,
+			text:     "Hello world. How are you?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CacheKey(tt.provider, tt.voice, tt.rate, tt.text)
+			if (got == base) != tt.wantSame {
+				t.Errorf("CacheKey() = %v, base %v, wantSame %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package chat OpenAI 兼容协议的流式对话补全, zhipu 和 openai 共用
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	sseDataPrefix = "data:"
+	sseDone       = "[DONE]"
+)
+
+// maxChoices 一次请求最多接受的回复数, index 超出时视为无效响应
+const maxChoices = 16
+
+type Usage struct {
+	CompletionTokens int `json:"completion_tokens"`
+	PromptTokens     int `json:"prompt_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Index    int          `json:"index"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type chunk struct {
+	ID      string        `json:"id"`
+	Created int           `json:"created"`
+	Model   string        `json:"model"`
+	Choices []chunkChoice `json:"choices"`
+	Usage   Usage         `json:"usage"`
+}
+
+type chunkChoice struct {
+	Index        int    `json:"index"`
+	FinishReason string `json:"finish_reason"`
+	Delta        struct {
+		Content   string     `json:"content"`
+		ToolCalls []ToolCall `json:"tool_calls"`
+	} `json:"delta"`
+}
+
+// Choice 拼接好的一个回复
+type Choice struct {
+	Index        int
+	FinishReason string
+	Content      string
+	ToolCalls    []ToolCall
+}
+
+// Result 流式返回拼接后的完整结果
+type Result struct {
+	ID      string
+	Created int
+	Model   string
+	Choices []Choice
+	Usage   Usage
+}
+
+// Stream 读取 SSE 响应, 每收到一段增量内容就回调 streamingFunc.
+// check 不为空时先用它检查每个事件, 用于识别流中返回的错误.
+func Stream(ctx context.Context, body io.Reader, check func(data []byte) error, streamingFunc func(ctx context.Context, chunk []byte) error) (*Result, error) {
+	rs := &Result{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, sseDataPrefix) {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, sseDataPrefix))
+		if data == sseDone {
+			break
+		}
+
+		if check != nil {
+			if err := check([]byte(data)); err != nil {
+				return nil, err
+			}
+		}
+		c := &chunk{}
+		if err := json.Unmarshal([]byte(data), c); err != nil {
+			return nil, err
+		}
+
+		rs.ID, rs.Created, rs.Model = c.ID, c.Created, c.Model
+		if c.Usage.TotalTokens > 0 {
+			rs.Usage = c.Usage
+		}
+		for _, choice := range c.Choices {
+			if choice.Index < 0 || choice.Index >= maxChoices {
+				return nil, fmt.Errorf("invalid choice index: %d", choice.Index)
+			}
+			for len(rs.Choices) <= choice.Index {
+				rs.Choices = append(rs.Choices, Choice{Index: len(rs.Choices)})
+			}
+			merged := &rs.Choices[choice.Index]
+			merged.Content += choice.Delta.Content
+			merged.ToolCalls = MergeToolCalls(merged.ToolCalls, choice.Delta.ToolCalls)
+			if choice.FinishReason != "" {
+				merged.FinishReason = choice.FinishReason
+			}
+
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err := streamingFunc(ctx, []byte(choice.Delta.Content)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// MergeToolCalls 合并流式返回的工具调用, 同一 index 的参数分片依次拼接
+func MergeToolCalls(calls []ToolCall, deltas []ToolCall) []ToolCall {
+	for _, delta := range deltas {
+		merged := false
+		for i := range calls {
+			if calls[i].Index == delta.Index {
+				calls[i].Function.Arguments += delta.Function.Arguments
+				if delta.ID != "" {
+					calls[i].ID = delta.ID
+				}
+				if delta.Function.Name != "" {
+					calls[i].Function.Name = delta.Function.Name
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			calls = append(calls, delta)
+		}
+	}
+	return calls
+}
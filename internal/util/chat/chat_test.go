@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []string
+		check   func(data []byte) error
+		want    []Choice
+		chunks  string
+		wantErr bool
+	}{
+		{
+			name: "content",
+			events: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":", world"},"finish_reason":"stop"}]}`,
+				`[DONE]`,
+			},
+			want:   []Choice{{Index: 0, FinishReason: "stop", Content: "Hello, world"}},
+			chunks: "Hello, world",
+		},
+		{
+			name: "tool calls",
+			events: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","index":0,"type":"function","function":{"name":"lookup_word","arguments":"{\"wo"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"rd\":\"fox\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_2","index":1,"type":"function","function":{"name":"review_stats","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []Choice{{Index: 0, FinishReason: "tool_calls", ToolCalls: []ToolCall{
+				{ID: "call_1", Index: 0, Type: "function", Function: FunctionCall{Name: "lookup_word", Arguments: `{"word":"fox"}`}},
+				{ID: "call_2", Index: 1, Type: "function", Function: FunctionCall{Name: "review_stats", Arguments: "{}"}},
+			}}},
+		},
+		{
+			name:    "check error",
+			events:  []string{`{"error":{"code":"1301"}}`},
+			check:   func(data []byte) error { return errors.New(string(data)) },
+			wantErr: true,
+		},
+		{
+			name:    "negative index",
+			events:  []string{`{"choices":[{"index":-1,"delta":{"content":"x"}}]}`},
+			wantErr: true,
+		},
+		{
+			name:    "index too large",
+			events:  []string{`{"choices":[{"index":1000000000,"delta":{"content":"x"}}]}`},
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			events:  []string{`{`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &strings.Builder{}
+			for _, event := range tt.events {
+				body.WriteString("data: " + event + "\n\n")
+			}
+
+			chunks := &strings.Builder{}
+			got, err := Stream(context.Background(), strings.NewReader(body.String()), tt.check, func(ctx context.Context, chunk []byte) error {
+				chunks.Write(chunk)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Stream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Choices, tt.want) {
+				t.Errorf("Stream() choices = %+v, want %+v", got.Choices, tt.want)
+			}
+			if chunks.String() != tt.chunks {
+				t.Errorf("Stream() chunks = %q, want %q", chunks.String(), tt.chunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"github.com/tmc/langchaingo/llms"
+)
+
+type Message struct {
+	Role       string     `json:"role,omitempty"`
+	Content    string     `json:"content"`
+	ToolCallId string     `json:"tool_call_id,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type Function struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+// VisionReq 图片理解的消息内容是文字和图片组成的数组
+type VisionReq struct {
+	Model    string          `json:"model"`
+	Messages []VisionMessage `json:"messages"`
+}
+
+type VisionMessage struct {
+	Role    string       `json:"role"`
+	Content []VisionPart `json:"content"`
+}
+
+type VisionPart struct {
+	Type     string     `json:"type"`
+	Text     string     `json:"text,omitempty"`
+	ImageURL *VisionURL `json:"image_url,omitempty"`
+}
+
+type VisionURL struct {
+	URL string `json:"url"`
+}
+
+// ToMessages 转换成接口的消息格式, 工具调用结果以 tool 角色回传并带上对应的 tool_call_id
+func ToMessages(messages []llms.MessageContent) []Message {
+	rs := make([]Message, 0, len(messages))
+	for _, prompt := range messages {
+		msg := Message{Role: "user"}
+		switch prompt.Role {
+		case llms.ChatMessageTypeAI:
+			msg.Role = "assistant"
+		case llms.ChatMessageTypeSystem:
+			msg.Role = "system"
+		case llms.ChatMessageTypeTool, llms.ChatMessageTypeFunction:
+			msg.Role = "tool"
+		}
+
+		toolResps := make([]Message, 0)
+		for _, part := range prompt.Parts {
+			switch t := part.(type) {
+			case llms.TextContent:
+				msg.Content += t.Text
+			case llms.ToolCall:
+				call := ToolCall{
+					ID:    t.ID,
+					Index: len(msg.ToolCalls),
+					Type:  t.Type,
+				}
+				if t.FunctionCall != nil {
+					call.Function = FunctionCall{
+						Name:      t.FunctionCall.Name,
+						Arguments: t.FunctionCall.Arguments,
+					}
+				}
+				msg.ToolCalls = append(msg.ToolCalls, call)
+			case llms.ToolCallResponse:
+				toolResps = append(toolResps, Message{
+					Role:       "tool",
+					Content:    t.Content,
+					ToolCallId: t.ToolCallID,
+				})
+			}
+		}
+
+		// 一条消息里可能带多个工具的返回结果, 需要拆成多条 tool 消息
+		if len(toolResps) > 0 {
+			rs = append(rs, toolResps...)
+			continue
+		}
+		rs = append(rs, msg)
+	}
+	return rs
+}
+
+// ToTools 转换成接口的工具定义, 没有工具时两个返回值都为空
+func ToTools(option *llms.CallOptions) ([]Tool, any) {
+	tools := make([]Tool, 0, len(option.Tools)+len(option.Functions))
+	for _, tool := range option.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		tools = append(tools, Tool{
+			Type: "function",
+			Function: Function{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		})
+	}
+	for _, function := range option.Functions {
+		tools = append(tools, Tool{
+			Type: "function",
+			Function: Function{
+				Name:        function.Name,
+				Description: function.Description,
+				Parameters:  function.Parameters,
+			},
+		})
+	}
+
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	var toolChoice any = "auto"
+	if option.ToolChoice != nil {
+		toolChoice = option.ToolChoice
+	} else if option.FunctionCallBehavior != "" {
+		toolChoice = string(option.FunctionCallBehavior)
+	}
+	return tools, toolChoice
+}
+
+// ToContentChoice 把接口返回的一个回复转换成 llms 的格式
+func ToContentChoice(finishReason string, message Message) *llms.ContentChoice {
+	rs := &llms.ContentChoice{
+		StopReason: finishReason,
+		Content:    message.Content,
+	}
+	for _, call := range message.ToolCalls {
+		rs.ToolCalls = append(rs.ToolCalls, llms.ToolCall{
+			ID:   call.ID,
+			Type: call.Type,
+			FunctionCall: &llms.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		})
+	}
+	if len(rs.ToolCalls) > 0 {
+		rs.FuncCall = rs.ToolCalls[0].FunctionCall
+	}
+	return rs
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestToMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []llms.MessageContent
+		want     []Message
+	}{
+		{
+			name: "roles",
+			messages: []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeSystem, "be brief"),
+				llms.TextParts(llms.ChatMessageTypeHuman, "hi"),
+				llms.TextParts(llms.ChatMessageTypeAI, "hello"),
+			},
+			want: []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+		},
+		{
+			name: "tool calls",
+			messages: []llms.MessageContent{{
+				Role: llms.ChatMessageTypeAI,
+				Parts: []llms.ContentPart{
+					llms.ToolCall{ID: "call_1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "lookup_word", Arguments: "{}"}},
+					llms.ToolCall{ID: "call_2", Type: "function"},
+				},
+			}},
+			want: []Message{{Role: "assistant", ToolCalls: []ToolCall{
+				{ID: "call_1", Index: 0, Type: "function", Function: FunctionCall{Name: "lookup_word", Arguments: "{}"}},
+				{ID: "call_2", Index: 1, Type: "function"},
+			}}},
+		},
+		{
+			name: "tool responses are split",
+			messages: []llms.MessageContent{{
+				Role: llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{
+					llms.ToolCallResponse{ToolCallID: "call_1", Content: "fox"},
+					llms.ToolCallResponse{ToolCallID: "call_2", Content: "3"},
+				},
+			}},
+			want: []Message{{Role: "tool", Content: "fox", ToolCallId: "call_1"}, {Role: "tool", Content: "3", ToolCallId: "call_2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToMessages(tt.messages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToMessages() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package cover
+
+import (
+	"bytes"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	Size = 512
+
+	padding    = 48
+	fontSize   = 44
+	lineHeight = 58
+	maxLines   = 6
+
+	defaultTitle = "Retell"
+)
+
+// 背景渐变色, 按标题哈希选取, 同一标题每次生成的封面一致
+var palettes = [][2]color.RGBA{
+	{{0x1e, 0x3c, 0x72, 0xff}, {0x2a, 0x52, 0x98, 0xff}},
+	{{0x13, 0x4e, 0x5e, 0xff}, {0x71, 0xb2, 0x80, 0xff}},
+	{{0x42, 0x27, 0x5a, 0xff}, {0x73, 0x4b, 0x6d, 0xff}},
+	{{0xc0, 0x39, 0x2b, 0xff}, {0x8e, 0x44, 0xad, 0xff}},
+	{{0x23, 0x25, 0x26, 0xff}, {0x41, 0x43, 0x45, 0xff}},
+	{{0xe6, 0x7e, 0x22, 0xff}, {0xd3, 0x54, 0x00, 0xff}},
+}
+
+// TitleCard 渲染一张带标题文字的 jpeg 封面, 作为图片接口失败时的兜底
+func TitleCard(title string) ([]byte, error) {
+	f, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    fontSize,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	fillGradient(img, palette(title))
+
+	lines := wrap(face, printable(face, title), Size-2*padding)
+	if len(lines) == 0 {
+		lines = []string{defaultTitle}
+	}
+
+	metrics := face.Metrics()
+	top := (Size-lineHeight*len(lines))/2 + metrics.Ascent.Ceil()
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.White),
+		Face: face,
+	}
+	for i, line := range lines {
+		width := d.MeasureString(line).Ceil()
+		d.Dot = fixed.P((Size-width)/2, top+i*lineHeight)
+		d.DrawString(line)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func palette(title string) [2]color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	return palettes[h.Sum32()%uint32(len(palettes))]
+}
+
+func fillGradient(img *image.RGBA, p [2]color.RGBA) {
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	for y := 0; y < height; y++ {
+		c := color.RGBA{
+			R: lerp(p[0].R, p[1].R, y, height),
+			G: lerp(p[0].G, p[1].G, y, height),
+			B: lerp(p[0].B, p[1].B, y, height),
+			A: 0xff,
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func lerp(a, b uint8, i, n int) uint8 {
+	return uint8(int(a) + (int(b)-int(a))*i/n)
+}
+
+// printable 去掉字体里没有的字符, 例如中文
+func printable(face font.Face, title string) string {
+	var sb strings.Builder
+	for _, r := range title {
+		if unicode.IsSpace(r) {
+			sb.WriteRune(' ')
+			continue
+		}
+		if _, ok := face.GlyphAdvance(r); ok {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// wrap 按单词折行, 超出行数时最后一行以省略号结尾
+func wrap(face font.Face, text string, width int) []string {
+	lines := make([]string, 0)
+	current := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if font.MeasureString(face, candidate).Ceil() <= width || current == "" {
+			current = candidate
+			continue
+		}
+		lines = append(lines, current)
+		current = word
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+
+	for i, line := range lines {
+		lines[i] = fit(face, line, width)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] = fit(face, lines[maxLines-1]+"…", width)
+	}
+	return lines
+}
+
+// fit 截断单行过长的文本
+func fit(face font.Face, line string, width int) string {
+	if font.MeasureString(face, line).Ceil() <= width {
+		return line
+	}
+	runes := []rune(line)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := string(runes) + "…"
+		if font.MeasureString(face, candidate).Ceil() <= width {
+			return candidate
+		}
+	}
+	return ""
+}
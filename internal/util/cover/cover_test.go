@@ -0,0 +1,46 @@
+package cover
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+)
+
+func TestTitleCard(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{
+			name:  "english",
+			title: "The Old Man and the Sea",
+		},
+		{
+			name:  "long",
+			title: "A very long title that certainly does not fit on a single line of the cover image and needs wrapping Pneumonoultramicroscopicsilicovolcanoconiosis",
+		},
+		{
+			name:  "chinese",
+			title: "老人与海",
+		},
+		{
+			name:  "empty",
+			title: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := TitleCard(tt.title)
+			if err != nil {
+				t.Fatalf("TitleCard() error = %v", err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode error = %v", err)
+			}
+			if img.Bounds().Dx() != Size || img.Bounds().Dy() != Size {
+				t.Errorf("TitleCard() bounds = %v, want %dx%d", img.Bounds(), Size, Size)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	Equal  = ' '
+	Delete = '-'
+	Insert = '+'
+)
+
+type Edit struct {
+	Kind rune
+	Text string
+}
+
+// maxCells 逐行比较时 lcs 表最多的格子数, 约 8MB
+const maxCells = 1 << 20
+
+// ErrTooLarge 去掉相同的开头和结尾后改动仍然太多, 无法逐行比较
+var ErrTooLarge = errors.New("diff too large")
+
+// Lines 用最长公共子序列比较两组文本行(或句子), 返回把 a 变成 b 的编辑序列;
+// 相同的开头和结尾不参与比较, 剩下的部分超过 maxCells 时整段删除再整段插入, 并返回 ErrTooLarge
+func Lines(a, b []string) ([]Edit, error) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	rs := make([]Edit, 0, max(len(a), len(b)))
+	for _, line := range a[:prefix] {
+		rs = append(rs, Edit{Kind: Equal, Text: line})
+	}
+	var err error
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(ma)+1)*(len(mb)+1) > maxCells {
+		for _, line := range ma {
+			rs = append(rs, Edit{Kind: Delete, Text: line})
+		}
+		for _, line := range mb {
+			rs = append(rs, Edit{Kind: Insert, Text: line})
+		}
+		err = ErrTooLarge
+	} else {
+		rs = lcsEdits(rs, ma, mb)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		rs = append(rs, Edit{Kind: Equal, Text: line})
+	}
+	return rs, err
+}
+
+// lcsEdits 把 a 变成 b 的编辑序列追加到 rs
+func lcsEdits(rs []Edit, a, b []string) []Edit {
+	// lcs[i][j] 为 a[i:] 和 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			rs = append(rs, Edit{Kind: Equal, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			rs = append(rs, Edit{Kind: Delete, Text: a[i]})
+			i++
+		default:
+			rs = append(rs, Edit{Kind: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		rs = append(rs, Edit{Kind: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		rs = append(rs, Edit{Kind: Insert, Text: b[j]})
+	}
+	return rs
+}
+
+// Format 输出类似 unified diff 的文本, 每处修改前后最多保留 context 行未变化的内容, 其余用 … 代替
+func Format(edits []Edit, context int) string {
+	keep := make([]bool, len(edits))
+	for i, e := range edits {
+		if e.Kind == Equal {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(edits)-1, i+context); j++ {
+			keep[j] = true
+		}
+	}
+
+	sb := &strings.Builder{}
+	skipped := false
+	for i, e := range edits {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString("…\n")
+			skipped = false
+		}
+		sb.WriteRune(e.Kind)
+		sb.WriteString(" ")
+		sb.WriteString(e.Text)
+		sb.WriteString("\n")
+	}
+	if skipped && sb.Len() > 0 {
+		sb.WriteString("…\n")
+	}
+	return sb.String()
+}
+
+// Changed 编辑序列中是否有修改
+func Changed(edits []Edit) bool {
+	for _, e := range edits {
+		if e.Kind != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 编辑序列中删除和插入的行数
+func Count(edits []Edit) (deleted, inserted int) {
+	for _, e := range edits {
+		switch e.Kind {
+		case Delete:
+			deleted++
+		case Insert:
+			inserted++
+		}
+	}
+	return deleted, inserted
+}
@@ -0,0 +1,125 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want []Edit
+	}{
+		{
+			name: "equal",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: []Edit{{Equal, "a"}, {Equal, "b"}},
+		},
+		{
+			name: "replace",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			want: []Edit{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}},
+		},
+		{
+			name: "append",
+			a:    []string{"a"},
+			b:    []string{"a", "b"},
+			want: []Edit{{Equal, "a"}, {Insert, "b"}},
+		},
+		{
+			name: "empty",
+			a:    nil,
+			b:    []string{"a"},
+			want: []Edit{{Insert, "a"}},
+		},
+		{
+			name: "common prefix and suffix",
+			a:    []string{"a", "b", "c", "b", "a"},
+			b:    []string{"a", "b", "x", "b", "a"},
+			want: []Edit{{Equal, "a"}, {Equal, "b"}, {Delete, "c"}, {Insert, "x"}, {Equal, "b"}, {Equal, "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lines(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Lines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines_TooLarge(t *testing.T) {
+	lines := func(prefix string, n int) []string {
+		rs := make([]string, n)
+		for i := range rs {
+			rs[i] = prefix + strconv.Itoa(i)
+		}
+		return rs
+	}
+	a := append(append([]string{"head"}, lines("a", 2000)...), "tail")
+	b := append(append([]string{"head"}, lines("b", 2000)...), "tail")
+
+	got, err := Lines(a, b)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Lines() error = %v, want %v", err, ErrTooLarge)
+	}
+	if got[0] != (Edit{Equal, "head"}) || got[len(got)-1] != (Edit{Equal, "tail"}) {
+		t.Errorf("Lines() keeps %v ... %v, want head ... tail", got[0], got[len(got)-1])
+	}
+	if deleted, inserted := Count(got); deleted != 2000 || inserted != 2000 {
+		t.Errorf("Count() = %d, %d, want 2000, 2000", deleted, inserted)
+	}
+
+	// 相同的开头和结尾不计入表的大小
+	same := lines("s", 5000)
+	if _, err := Lines(same, append(slices.Clone(same), "x")); err != nil {
+		t.Errorf("Lines() on an append error = %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       []string
+		b       []string
+		context int
+		want    string
+	}{
+		{
+			name:    "context",
+			a:       []string{"1", "2", "3", "4", "5", "6"},
+			b:       []string{"1", "2", "3", "x", "5", "6"},
+			context: 1,
+			want:    "…\n  3\n- 4\n+ x\n  5\n…\n",
+		},
+		{
+			name:    "no change",
+			a:       []string{"1"},
+			b:       []string{"1"},
+			context: 1,
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, err := Lines(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Lines() error = %v", err)
+			}
+			if got := Format(edits, tt.context); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
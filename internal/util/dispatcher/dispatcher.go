@@ -0,0 +1,310 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/logger"
+	"github.com/usual2970/retell/internal/util/metrics"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram 的限制: 全局每秒约 30 条, 同一个聊天每秒 1 条(允许短暂突发)
+const (
+	globalInterval = time.Second / 30
+	globalBurst    = 30
+	chatInterval   = time.Second
+	chatBurst      = 3
+
+	retries = 3
+	backoff = time.Second
+)
+
+// Sender 实际发送消息, 一般是 *tgbotapi.BotAPI
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+type Option func(*Dispatcher)
+
+// WithGlobalLimit 所有聊天共享的发送间隔和突发数
+func WithGlobalLimit(interval time.Duration, burst int) Option {
+	return func(d *Dispatcher) {
+		d.global = newLimiter(interval, burst)
+	}
+}
+
+// WithChatLimit 单个聊天的发送间隔和突发数
+func WithChatLimit(interval time.Duration, burst int) Option {
+	return func(d *Dispatcher) {
+		d.chatInterval = interval
+		d.chatBurst = burst
+	}
+}
+
+// WithRetry 失败后最多重试 n 次, 没有 RetryAfter 时按 backoff 指数退避
+func WithRetry(n int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.retries = n
+		d.backoff = backoff
+	}
+}
+
+// Dispatcher 按聊天排队发送消息, 同一个聊天内严格按投递顺序发送
+type Dispatcher struct {
+	sender       Sender
+	global       *limiter
+	chatInterval time.Duration
+	chatBurst    int
+	retries      int
+	backoff      time.Duration
+
+	mu    sync.Mutex
+	chats map[int64]*queue
+}
+
+type result struct {
+	message tgbotapi.Message
+	err     error
+}
+
+type request struct {
+	ctx  context.Context
+	item domain.TgChatItem
+	done chan result
+}
+
+type queue struct {
+	pending []*request
+	limiter *limiter
+}
+
+func New(sender Sender, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		sender:       sender,
+		global:       newLimiter(globalInterval, globalBurst),
+		chatInterval: chatInterval,
+		chatBurst:    chatBurst,
+		retries:      retries,
+		backoff:      backoff,
+		chats:        make(map[int64]*queue),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Dispatch 把 items 依次放进 chatID 的队列并等待全部发送完.
+// 每条消息发送成功后才调用它的 Callback, 返回所有发送失败的错误.
+func (d *Dispatcher) Dispatch(ctx context.Context, chatID int64, items []domain.TgChatItem) error {
+	reqs := make([]*request, 0, len(items))
+	for _, item := range items {
+		reqs = append(reqs, &request{ctx: ctx, item: item, done: make(chan result, 1)})
+	}
+	d.enqueue(chatID, reqs)
+
+	log := logger.FromContext(ctx)
+	var errs []error
+	for _, req := range reqs {
+		rs := <-req.done
+		if rs.err != nil {
+			log.Error("send item error:", "err", rs.err, "chattable", fmt.Sprintf("%T", req.item.Chat))
+			errs = append(errs, rs.err)
+			continue
+		}
+		log.Debug("send item success", "message_id", rs.message.MessageID)
+
+		if req.item.Callback == nil {
+			continue
+		}
+		if err := req.item.Callback(rs.message); err != nil {
+			log.Error("send callback error:", "err", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pending 还在排队等待发送的消息数
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for _, q := range d.chats {
+		n += len(q.pending)
+	}
+	return n
+}
+
+// enqueue 一次性放入同一批消息, 并发投递到同一个聊天时不会交错
+func (d *Dispatcher) enqueue(chatID int64, reqs []*request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q, ok := d.chats[chatID]
+	if !ok {
+		q = &queue{limiter: newLimiter(d.chatInterval, d.chatBurst)}
+		d.chats[chatID] = q
+		go d.run(chatID, q)
+	}
+	q.pending = append(q.pending, reqs...)
+}
+
+// run 每个聊天一个协程, 队列空了且限速状态恢复后退出
+func (d *Dispatcher) run(chatID int64, q *queue) {
+	for {
+		d.mu.Lock()
+		if len(q.pending) == 0 {
+			// 限速还没恢复时先等一会, 避免退出后新建的队列绕过限速
+			if wait := q.limiter.idle(); wait > 0 {
+				d.mu.Unlock()
+				time.Sleep(wait)
+				continue
+			}
+			delete(d.chats, chatID)
+			d.mu.Unlock()
+			return
+		}
+		req := q.pending[0]
+		q.pending = q.pending[1:]
+		d.mu.Unlock()
+
+		msg, err := d.deliver(req.ctx, q.limiter, req.item)
+		req.done <- result{message: msg, err: err}
+	}
+}
+
+// deliver 发送 item, 编辑内容没有变化时视为成功, 请求无法完成时改发 Fallback
+func (d *Dispatcher) deliver(ctx context.Context, chat *limiter, item domain.TgChatItem) (tgbotapi.Message, error) {
+	msg, err := d.send(ctx, chat, item.Chat)
+	if err == nil || notModified(err) {
+		return msg, nil
+	}
+
+	var tgErr *tgbotapi.Error
+	if item.Fallback == nil || !errors.As(err, &tgErr) || tgErr.Code != http.StatusBadRequest {
+		return msg, err
+	}
+	logger.FromContext(ctx).Info("send fallback item", "err", err, "chattable", fmt.Sprintf("%T", item.Fallback))
+	return d.send(ctx, chat, item.Fallback)
+}
+
+func (d *Dispatcher) send(ctx context.Context, chat *limiter, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	for attempt := 0; ; attempt++ {
+		if err := chat.wait(ctx); err != nil {
+			return tgbotapi.Message{}, err
+		}
+		if err := d.global.wait(ctx); err != nil {
+			return tgbotapi.Message{}, err
+		}
+
+		msg, err := d.sender.Send(c)
+		if err == nil {
+			return msg, nil
+		}
+		metrics.SendErrors.WithLabelValues(errorCode(err)).Inc()
+
+		delay, ok := retryDelay(err, attempt, d.backoff)
+		if !ok || attempt >= d.retries {
+			return msg, err
+		}
+		logger.FromContext(ctx).Warn("send item retry", "err", err, "attempt", attempt+1, "delay", delay.String())
+
+		select {
+		case <-ctx.Done():
+			return msg, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay 被限流时按 telegram 返回的 RetryAfter 等待, 服务端错误和网络错误指数退避, 其他错误不重试
+func retryDelay(err error, attempt int, backoff time.Duration) (time.Duration, bool) {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		switch {
+		case tgErr.RetryAfter > 0:
+			return time.Duration(tgErr.RetryAfter) * time.Second, true
+		case tgErr.Code == 429 || tgErr.Code >= 500:
+			return backoff << attempt, true
+		}
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return backoff << attempt, true
+	}
+	return 0, false
+}
+
+// notModified 重复点击同一个按钮时编辑后的内容和原消息相同, telegram 会返回这个错误
+func notModified(err error) bool {
+	var tgErr *tgbotapi.Error
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "message is not modified")
+}
+
+// errorCode telegram 返回的错误码, 网络错误等没有错误码的记为 network
+func errorCode(err error) string {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return strconv.Itoa(tgErr.Code)
+	}
+	return "network"
+}
+
+// limiter 允许 burst 条突发、之后每 interval 一条的限速器(GCRA)
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	// tat 理论上下一条消息的到达时间
+	tat time.Time
+}
+
+func newLimiter(interval time.Duration, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{interval: interval, burst: burst}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.tat.Before(now) {
+		l.tat = now
+	}
+	at := l.tat.Add(-l.interval * time.Duration(l.burst-1))
+	l.tat = l.tat.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// idle 距离限速完全恢复还需要的时间
+func (l *limiter) idle() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.tat)
+}
@@ -0,0 +1,219 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeSender 按顺序返回 errs 中的错误, 用完后都发送成功
+type fakeSender struct {
+	mu   sync.Mutex
+	errs []error
+	sent []string
+}
+
+func (f *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return tgbotapi.Message{}, err
+		}
+	}
+	text := c.(tgbotapi.MessageConfig).Text
+	f.sent = append(f.sent, text)
+	return tgbotapi.Message{MessageID: len(f.sent), Text: text}, nil
+}
+
+func newTestDispatcher(sender Sender) *Dispatcher {
+	return New(sender,
+		WithGlobalLimit(time.Millisecond, 1),
+		WithChatLimit(time.Millisecond, 1),
+		WithRetry(2, time.Millisecond),
+	)
+}
+
+func items(texts ...string) []domain.TgChatItem {
+	rs := make([]domain.TgChatItem, 0, len(texts))
+	for _, text := range texts {
+		rs = append(rs, domain.TgChatItem{Chat: tgbotapi.NewMessage(1, text)})
+	}
+	return rs
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			want: []string{"audio", "text"},
+		},
+		{
+			name: "retry after",
+			errs: []error{&tgbotapi.Error{Code: 429, Message: "Too Many Requests"}},
+			want: []string{"audio", "text"},
+		},
+		{
+			name: "network",
+			errs: []error{&net.OpError{Op: "dial", Err: errors.New("refused")}},
+			want: []string{"audio", "text"},
+		},
+		{
+			name:    "bad request",
+			errs:    []error{&tgbotapi.Error{Code: 400, Message: "Bad Request"}},
+			want:    []string{"text"},
+			wantErr: true,
+		},
+		{
+			name: "retries exhausted",
+			errs: []error{
+				&tgbotapi.Error{Code: 502, Message: "Bad Gateway"},
+				&tgbotapi.Error{Code: 502, Message: "Bad Gateway"},
+				&tgbotapi.Error{Code: 502, Message: "Bad Gateway"},
+			},
+			want:    []string{"text"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{errs: tt.errs}
+			d := newTestDispatcher(sender)
+
+			err := d.Dispatch(context.Background(), 1, items("audio", "text"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dispatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sender.sent) != len(tt.want) {
+				t.Fatalf("Dispatch() sent = %v, want %v", sender.sent, tt.want)
+			}
+			for i := range tt.want {
+				if sender.sent[i] != tt.want[i] {
+					t.Errorf("Dispatch() sent = %v, want %v", sender.sent, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Callback(t *testing.T) {
+	sender := &fakeSender{errs: []error{
+		&tgbotapi.Error{Code: 500, Message: "Internal Server Error"}, nil,
+		&tgbotapi.Error{Code: 400, Message: "Bad Request"},
+	}}
+	d := newTestDispatcher(sender)
+
+	var called []string
+	reply := items("audio", "text")
+	for i := range reply {
+		reply[i].Callback = func(message tgbotapi.Message) error {
+			called = append(called, message.Text)
+			return nil
+		}
+	}
+
+	// audio 重试一次后成功, text 失败, 只有 audio 的回调会执行
+	if err := d.Dispatch(context.Background(), 1, reply); err == nil {
+		t.Fatalf("Dispatch() error = nil, want error")
+	}
+	if len(called) != 1 || called[0] != "audio" {
+		t.Errorf("Dispatch() callbacks = %v, want [audio]", called)
+	}
+}
+
+func TestDispatcher_Order(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDispatcher(sender)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Dispatch(context.Background(), 1, items("audio", "text"))
+		}()
+	}
+	wg.Wait()
+
+	// 并发投递的批次之间不会交错
+	for i := 0; i < len(sender.sent); i += 2 {
+		if sender.sent[i] != "audio" || sender.sent[i+1] != "text" {
+			t.Fatalf("Dispatch() sent = %v, want audio/text pairs", sender.sent)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(20*time.Millisecond, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+
+	// 前 2 条突发, 之后每条间隔 20ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("wait() elapsed = %v, want >= 40ms", elapsed)
+	}
+}
+
+func TestDispatcher_Fallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "not modified",
+			err:  &tgbotapi.Error{Code: 400, Message: "Bad Request: message is not modified"},
+			want: nil,
+		},
+		{
+			name: "cannot edit",
+			err:  &tgbotapi.Error{Code: 400, Message: "Bad Request: message can't be edited"},
+			want: []string{"fallback"},
+		},
+		{
+			name:    "forbidden",
+			err:     &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{errs: []error{tt.err}}
+			d := newTestDispatcher(sender)
+
+			item := domain.TgChatItem{
+				Chat:     tgbotapi.NewMessage(1, "edit"),
+				Fallback: tgbotapi.NewMessage(1, "fallback"),
+			}
+			err := d.Dispatch(context.Background(), 1, []domain.TgChatItem{item})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dispatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sender.sent) != len(tt.want) || (len(tt.want) > 0 && sender.sent[0] != tt.want[0]) {
+				t.Errorf("Dispatch() sent = %v, want %v", sender.sent, tt.want)
+			}
+		})
+	}
+}
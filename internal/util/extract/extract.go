@@ -0,0 +1,165 @@
+package extract
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/usual2970/retell/internal/util/str"
+)
+
+// ErrUnsupported 不支持的文件类型
+var ErrUnsupported = errors.New("unsupported file type")
+
+// ErrEmpty 没有提取到正文
+var ErrEmpty = errors.New("no text found")
+
+// ErrTooLarge 文档解压或者提取出的内容超过上限
+var ErrTooLarge = errors.New("document too large")
+
+// maxDocSize 一个文档累计解压和提取的最大字节数.
+// 单个文件有 maxEntrySize 的限制, 这里防止同一段压缩数据被反复引用
+const maxDocSize = 64 << 20
+
+// titleMaxRunes 推断的标题最多保留的字数
+const titleMaxRunes = 60
+
+// Doc 提取出的文章, 原文没有标题时 Title 为空
+type Doc struct {
+	Title   string
+	Content string
+}
+
+// Extensions 支持导入的文档类型
+var Extensions = []string{".txt", ".md", ".docx", ".pdf", ".epub"}
+
+// File 按文件扩展名提取文档的标题和正文
+func File(name string, data []byte) (*Doc, error) {
+	var (
+		doc *Doc
+		err error
+	)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".txt":
+		doc = Text(data)
+	case ".md", ".markdown":
+		doc = Markdown(data)
+	case ".docx":
+		doc, err = Docx(data)
+	case ".pdf":
+		doc, err = PDF(data)
+	case ".epub":
+		doc, err = Epub(data)
+	case ".html", ".htm":
+		doc, err = HTML(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if doc.Content == "" {
+		return nil, ErrEmpty
+	}
+	return doc, nil
+}
+
+// budget 一个文档还可以解压和提取的字节数
+type budget struct {
+	left int
+}
+
+func newBudget() *budget {
+	return &budget{left: maxDocSize}
+}
+
+// take 用掉 n 字节, 超过上限时返回 ErrTooLarge
+func (b *budget) take(n int) error {
+	b.left -= n
+	if b.left < 0 {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// Text 纯文本, 不猜测标题
+func Text(data []byte) *Doc {
+	return &Doc{Content: clean(string(data))}
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^#{1,6}\s+`)
+	mdImage   = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	mdLink    = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdEmph    = regexp.MustCompile("(\\*\\*|__|\\*|`)")
+	mdList    = regexp.MustCompile(`^(\s*[-*+]\s+|\s*>\s?)`)
+	mdRule    = regexp.MustCompile(`^\s*([-*_]\s*){3,}$`)
+)
+
+// Markdown 去掉标记只保留文字, 第一个一级标题作为文章标题
+func Markdown(data []byte) *Doc {
+	doc := &Doc{}
+	lines := strings.Split(string(data), "\n")
+	rs := make([]string, 0, len(lines))
+	fence := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fence = !fence
+			continue
+		}
+		if fence {
+			rs = append(rs, line)
+			continue
+		}
+		if mdRule.MatchString(line) {
+			continue
+		}
+		if doc.Title == "" && len(rs) == 0 && strings.HasPrefix(line, "# ") {
+			doc.Title = strings.TrimSpace(line[2:])
+			continue
+		}
+		line = mdHeading.ReplaceAllString(line, "")
+		line = mdList.ReplaceAllString(line, "")
+		line = mdImage.ReplaceAllString(line, "")
+		line = mdLink.ReplaceAllString(line, "$1")
+		line = mdEmph.ReplaceAllString(line, "")
+		rs = append(rs, line)
+	}
+	doc.Content = clean(strings.Join(rs, "\n"))
+	return doc
+}
+
+// InferTitle 没有标题时用第一行或第一句话作为标题
+func InferTitle(content string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) > titleMaxRunes {
+		if sentences := str.Sentences(line); len(sentences) > 0 {
+			line = sentences[0]
+		}
+	}
+	line = strings.TrimRight(line, ".。!！?？,，;；:： ")
+
+	runes := []rune(line)
+	if len(runes) > titleMaxRunes {
+		return string(runes[:titleMaxRunes]) + "…"
+	}
+	return line
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// clean 统一换行, 去掉行尾空白和多余的空行
+func clean(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\u00a0")
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
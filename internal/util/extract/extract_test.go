@@ -0,0 +1,385 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	p1 = "The quick brown fox jumps over the lazy dog, and everyone in the village talked about it for weeks."
+	p2 = "Scientists later confirmed that foxes, when properly motivated, can clear obstacles twice their height."
+	p3 = "Nobody asked the dog what it thought, which, in hindsight, was probably a mistake."
+)
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		file  string
+		title string
+		want  string
+	}{
+		{file: "article.html", title: "The Jumping Fox", want: p1 + "\n\n" + p2 + "\n\n" + p3},
+		{file: "essay.md", title: "The Jumping Fox", want: p1 + "\n\nLater\n\n" + p2 + "\n\n" + p3 + "\n\nsource and"},
+		{file: "essay.txt", title: "", want: p1 + "\n\n" + p2 + "\n" + p3},
+		{file: "essay.docx", title: "The Jumping Fox", want: p1 + "\n\n" + p2 + "\n\n" + p3},
+		{file: "essay.epub", title: "The Jumping Fox", want: "Chapter One\n\n" + p1 + "\n\nChapter Two\n\n" + p2 + "\n\n" + p3},
+		{file: "essay.pdf", title: "The Jumping Fox", want: p1 + "\n\n" + p2 + "\n\n" + p3},
+		{file: "gbk.html", title: "狐狸", want: "敏捷的棕色狐狸跳过了那只懒狗，村里的人们议论了好几个星期。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := File(tt.file, data)
+			if err != nil {
+				t.Fatalf("File() error = %v", err)
+			}
+			if doc.Title != tt.title {
+				t.Errorf("File() title = %q, want %q", doc.Title, tt.title)
+			}
+			if doc.Content != tt.want {
+				t.Errorf("File() content = %q, want %q", doc.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_Unsupported(t *testing.T) {
+	if _, err := File("essay.exe", []byte("MZ")); err != ErrUnsupported {
+		t.Errorf("File() error = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := File("essay.txt", []byte(" \n ")); err != ErrEmpty {
+		t.Errorf("File() error = %v, want %v", err, ErrEmpty)
+	}
+	if _, err := File("essay.pdf", []byte("not a pdf")); err == nil {
+		t.Error("File() want error for corrupted pdf")
+	}
+}
+
+const pdfContent = "BT (Hello fox) Tj ET"
+
+// pdfFixture 依次编号的对象组成的 PDF, 前两个对象是一页文字
+func pdfFixture(objects ...string) []byte {
+	objects = append([]string{
+		"<< /Type /Page /Contents 2 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(pdfContent), pdfContent),
+	}, objects...)
+
+	sb := &strings.Builder{}
+	sb.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(sb, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	return []byte(sb.String())
+}
+
+func TestPDF_Malformed(t *testing.T) {
+	deep := strings.Repeat("[", 1<<20)
+	length := func(l string) []byte {
+		return bytes.Replace(pdfFixture(), []byte(fmt.Sprintf("/Length %d", len(pdfContent))), []byte("/Length "+l), 1)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{name: "nested arrays", data: pdfFixture(deep), wantErr: errCorrupted},
+		{name: "nested dicts", data: pdfFixture(strings.Repeat("<<", 1<<20)), wantErr: errCorrupted},
+		{name: "nested arrays in trailer", data: append(pdfFixture(), "trailer\n"+deep...), wantErr: errCorrupted},
+		{
+			name:    "nested arrays in content",
+			data:    []byte("%PDF-1.4\n1 0 obj\n<< /Type /Page /Contents 2 0 R >>\nendobj\n2 0 obj\n<< >>\nstream\n" + deep + "\nendstream\nendobj\n"),
+			wantErr: errCorrupted,
+		},
+		{name: "negative length", data: length("-99999"), want: "Hello fox"},
+		{name: "huge length", data: length("1e300"), want: "Hello fox"},
+		{name: "negative first", data: pdfFixture("<< /Type /ObjStm /N 1 /First -1 /Length 9 >>\nstream\n4 0 (Hi)\nendstream"), want: "Hello fox"},
+		{name: "huge first", data: pdfFixture("<< /Type /ObjStm /N 1 /First 1e300 /Length 9 >>\nstream\n4 0 (Hi)\nendstream"), want: "Hello fox"},
+		{name: "negative offset", data: pdfFixture("<< /Type /ObjStm /N 1 /First 5 /Length 9 >>\nstream\n4 -9 (Hi)\nendstream"), want: "Hello fox"},
+		{name: "offset out of range", data: pdfFixture("<< /Type /ObjStm /N 1 /First 5 /Length 9 >>\nstream\n4 9e18 (Hi)\nendstream"), want: "Hello fox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := PDF(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PDF() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && doc.Content != tt.want {
+				t.Errorf("PDF() content = %q, want %q", doc.Content, tt.want)
+			}
+		})
+	}
+}
+
+// flateStream 压缩后的内容流对象
+func flateStream(content []byte) string {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	zw.Write(content)
+	zw.Close()
+	return fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", buf.Len(), buf.Bytes())
+}
+
+func TestPDF_Budget(t *testing.T) {
+	// 1000 个页面引用同一个内容流
+	shared := pdfFixture(slices.Repeat([]string{"<< /Type /Page /Contents 2 0 R >>"}, 1000)...)
+	// 每个内容流解压后 16MB, 总量超过上限
+	bomb := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		bomb = append(bomb, fmt.Sprintf("<< /Type /Page /Contents %d 0 R >>", 4+i*2), flateStream(bytes.Repeat([]byte(" "), 16<<20)))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{name: "shared content stream", data: shared, want: "Hello fox"},
+		{name: "decoded too large", data: pdfFixture(bomb...), wantErr: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := PDF(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PDF() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && doc.Content != tt.want {
+				t.Errorf("PDF() content = %q, want %q", doc.Content, tt.want)
+			}
+		})
+	}
+}
+
+// epubFixture 书脊按 spine 引用 chapters 中的章节
+func epubFixture(chapters map[string][]byte, spine []string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	add := func(name string, data []byte) {
+		w, _ := zw.Create(name)
+		w.Write(data)
+	}
+	add("META-INF/container.xml", []byte(`<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`))
+
+	opf := &strings.Builder{}
+	opf.WriteString("<package><metadata><title>Fox</title></metadata><manifest>")
+	for name, data := range chapters {
+		fmt.Fprintf(opf, `<item id="%s" href="%s.html"/>`, name, name)
+		add(name+".html", data)
+	}
+	opf.WriteString("</manifest><spine>")
+	for _, name := range spine {
+		fmt.Fprintf(opf, `<itemref idref="%s"/>`, name)
+	}
+	opf.WriteString("</spine></package>")
+	add("content.opf", []byte(opf.String()))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestEpub_Budget(t *testing.T) {
+	chapter := []byte("<html><body><p>Hello fox</p></body></html>")
+	large := map[string][]byte{}
+	for _, name := range []string{"a", "b", "c"} {
+		large[name] = append(bytes.Repeat([]byte(" "), 30<<20), chapter...)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{name: "repeated itemref", data: epubFixture(map[string][]byte{"a": chapter}, slices.Repeat([]string{"a"}, 1000)), want: "Hello fox"},
+		{name: "chapters too large", data: epubFixture(large, []string{"a", "b", "c"}), wantErr: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Epub(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Epub() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && doc.Content != tt.want {
+				t.Errorf("Epub() content = %q, want %q", doc.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gbk":
+			w.Header().Set("Content-Type", "text/html; charset=gbk")
+			http.ServeFile(w, r, "testdata/gbk.html")
+		case "/files/essay.pdf":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			http.ServeFile(w, r, "testdata/essay.pdf")
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			http.ServeFile(w, r, "testdata/article.html")
+		}
+	}))
+	defer server.Close()
+
+	// 测试服务在本机, 换成不限制地址的客户端
+	client := fetchClient
+	fetchClient = server.Client()
+	defer func() { fetchClient = client }()
+
+	tests := []struct {
+		path    string
+		title   string
+		prefix  string
+		wantErr bool
+	}{
+		{path: "/news/fox", title: "The Jumping Fox", prefix: p1},
+		{path: "/gbk", title: "狐狸", prefix: "敏捷的棕色狐狸"},
+		{path: "/files/essay.pdf", title: "The Jumping Fox", prefix: p1},
+		{path: "/missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			doc, err := URL(context.Background(), server.URL+tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("URL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if doc.Title != tt.title || !strings.HasPrefix(doc.Content, tt.prefix) {
+				t.Errorf("URL() = %q %q", doc.Title, doc.Content)
+			}
+		})
+	}
+}
+
+func TestURL_Forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/article.html")
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	for _, rawURL := range []string{server.URL, "http://localhost:" + u.Port()} {
+		if _, err := URL(context.Background(), rawURL); !errors.Is(err, errForbiddenAddress) {
+			t.Errorf("URL(%q) error = %v, want %v", rawURL, err, errForbiddenAddress)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1::", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "::", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "::ffff:10.0.0.1", want: false},
+		{ip: "0.1.2.3", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "100.127.255.254", want: false},
+		{ip: "198.18.0.1", want: false},
+		{ip: "198.19.255.1", want: false},
+		{ip: "255.255.255.255", want: false},
+		{ip: "::7f00:1", want: false},
+		{ip: "64:ff9b::7f00:1", want: false},
+		{ip: "64:ff9b::a9fe:a9fe", want: false},
+		{ip: "64:ff9b::808:808", want: true},
+		{ip: "2002:7f00:1::", want: false},
+		{ip: "2002:c0a8:101::1", want: false},
+		{ip: "2002:808:808::1", want: true},
+		{ip: "ff02::1", want: false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		via     int
+		wantErr bool
+	}{
+		{name: "https", target: "https://example.com/a", via: 1},
+		{name: "other scheme", target: "file:///etc/passwd", via: 1, wantErr: true},
+		{name: "too many", target: "https://example.com/a", via: maxRedirects, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if err := checkRedirect(req, make([]*http.Request, tt.via)); (err != nil) != tt.wantErr {
+				t.Errorf("checkRedirect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: " https://example.com/a?b=1 ", want: true},
+		{text: "http://example.com", want: true},
+		{text: "ftp://example.com", want: false},
+		{text: "see https://example.com", want: false},
+		{text: "example.com", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsURL(tt.text); got != tt.want {
+			t.Errorf("IsURL(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestInferTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "first line", content: "A Short Title\n\nBody text.", want: "A Short Title"},
+		{name: "first sentence", content: strings.Repeat("word ", 10) + "end. " + strings.Repeat("more ", 20), want: strings.Repeat("word ", 10) + "end"},
+		{name: "too long", content: strings.Repeat("长", 80), want: strings.Repeat("长", 60) + "…"},
+		{name: "empty", content: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InferTitle(tt.content); got != tt.want {
+				t.Errorf("InferTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package extract
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 参考 readability 的做法: 给包含段落的节点打分, 取得分最高的节点作为正文
+
+// minParagraphRunes 参与打分的段落最少字数
+const minParagraphRunes = 25
+
+var (
+	// unlikely class 或 id 命中时大概率不是正文
+	unlikely = regexp.MustCompile(`(?i)comment|sidebar|footer|foot|nav|menu|share|social|related|advert|\bads?\b|promo|cookie|subscribe|newsletter|breadcrumb|popup|banner`)
+	// likely 命中时即使同时命中 unlikely 也保留
+	likely   = regexp.MustCompile(`(?i)article|content|body|main|post|entry|text|story`)
+	spaces   = regexp.MustCompile(`[ \t\n\r\f\x{00a0}]+`)
+	siteName = regexp.MustCompile(`\s+[-|–—_]\s+[^-|–—_]+$`)
+)
+
+// removed 不包含正文的标签
+var removed = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true, atom.Header: true,
+	atom.Footer: true, atom.Aside: true, atom.Form: true, atom.Iframe: true, atom.Svg: true,
+	atom.Button: true, atom.Select: true, atom.Figure: true, atom.Template: true,
+}
+
+// blocks 输出时单独成段的标签
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Blockquote: true, atom.Pre: true, atom.Div: true, atom.Section: true,
+	atom.Article: true, atom.Tr: true, atom.Dd: true, atom.Dt: true,
+}
+
+// HTML 提取网页的标题和正文
+func HTML(data []byte) (*Doc, error) {
+	// 按页面中声明的编码转换
+	if !utf8.Valid(data) {
+		converted, err := toUTF8(data, "")
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Doc{Title: htmlTitle(root)}
+	prune(root)
+
+	body := find(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+	top := topCandidate(body)
+	if top == nil {
+		top = body
+	}
+
+	paragraphs := make([]string, 0)
+	collect(top, &paragraphs)
+	// 正文开头的标题和文章标题重复
+	if len(paragraphs) > 0 && doc.Title != "" && paragraphs[0] == doc.Title {
+		paragraphs = paragraphs[1:]
+	}
+	doc.Content = clean(strings.Join(paragraphs, "\n\n"))
+	return doc, nil
+}
+
+// htmlTitle 依次取 og:title、唯一的 h1、title 标签
+func htmlTitle(root *html.Node) string {
+	title := ""
+	h1s := make([]string, 0)
+	walk(root, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Meta:
+			if attr(n, "property") == "og:title" || attr(n, "name") == "twitter:title" {
+				if title == "" {
+					title = strings.TrimSpace(attr(n, "content"))
+				}
+			}
+		case atom.H1:
+			h1s = append(h1s, textOf(n))
+		}
+		return true
+	})
+	if title != "" {
+		return title
+	}
+	if len(h1s) == 1 && h1s[0] != "" {
+		return h1s[0]
+	}
+	if n := find(root, atom.Title); n != nil {
+		return siteName.ReplaceAllString(textOf(n), "")
+	}
+	return ""
+}
+
+// prune 去掉脚本、导航等不可能是正文的节点
+func prune(root *html.Node) {
+	var remove []*html.Node
+	walk(root, func(n *html.Node) bool {
+		switch {
+		case n.Type == html.CommentNode:
+			remove = append(remove, n)
+			return false
+		case n.Type != html.ElementNode:
+			return true
+		case removed[n.DataAtom]:
+			remove = append(remove, n)
+			return false
+		case n.DataAtom != atom.Body && n.DataAtom != atom.Html:
+			names := attr(n, "class") + " " + attr(n, "id")
+			if unlikely.MatchString(names) && !likely.MatchString(names) {
+				remove = append(remove, n)
+				return false
+			}
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// topCandidate 段落的得分累加到父节点和祖父节点上, 再按链接文字的比例打折
+func topCandidate(body *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+	walk(body, func(n *html.Node) bool {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Blockquote {
+			return true
+		}
+		text := textOf(n)
+		length := len([]rune(text))
+		if length < minParagraphRunes {
+			return false
+		}
+
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")) + min(float64(length)/100, 3)
+		if parent := n.Parent; parent != nil {
+			if _, ok := scores[parent]; !ok {
+				scores[parent] = classWeight(parent)
+			}
+			scores[parent] += score
+			if grand := parent.Parent; grand != nil {
+				if _, ok := scores[grand]; !ok {
+					scores[grand] = classWeight(grand)
+				}
+				scores[grand] += score / 2
+			}
+		}
+		return false
+	})
+
+	var (
+		top      *html.Node
+		topScore float64
+	)
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		if top == nil || score > topScore {
+			top, topScore = n, score
+		}
+	}
+	return top
+}
+
+func classWeight(n *html.Node) float64 {
+	names := attr(n, "class") + " " + attr(n, "id")
+	weight := 0.0
+	if likely.MatchString(names) {
+		weight += 25
+	}
+	if unlikely.MatchString(names) {
+		weight -= 25
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		weight += 10
+	}
+	return weight
+}
+
+// linkDensity 链接文字占全部文字的比例
+func linkDensity(n *html.Node) float64 {
+	total := len([]rune(textOf(n)))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walk(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			links += len([]rune(textOf(c)))
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(total)
+}
+
+// collect 按块输出文字, 每个块一段
+func collect(n *html.Node, paragraphs *[]string) {
+	inline := &strings.Builder{}
+	flush := func() {
+		if text := strings.TrimSpace(spaces.ReplaceAllString(inline.String(), " ")); text != "" {
+			*paragraphs = append(*paragraphs, text)
+		}
+		inline.Reset()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			inline.WriteString(c.Data)
+		case c.Type != html.ElementNode:
+		case c.DataAtom == atom.Br:
+			flush()
+		case c.DataAtom == atom.Pre:
+			flush()
+			if text := strings.TrimSpace(rawText(c)); text != "" {
+				*paragraphs = append(*paragraphs, text)
+			}
+		case blocks[c.DataAtom] || hasBlock(c):
+			flush()
+			collect(c, paragraphs)
+		default:
+			inline.WriteString(rawText(c))
+		}
+	}
+	flush()
+}
+
+func hasBlock(n *html.Node) bool {
+	found := false
+	walk(n, func(c *html.Node) bool {
+		if c != n && blocks[c.DataAtom] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func textOf(n *html.Node) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(rawText(n), " "))
+}
+
+func rawText(n *html.Node) string {
+	sb := &strings.Builder{}
+	walk(n, func(c *html.Node) bool {
+		switch {
+		case c.Type == html.TextNode:
+			sb.WriteString(c.Data)
+		case c.DataAtom == atom.Br:
+			sb.WriteString("\n")
+		}
+		return true
+	})
+	return sb.String()
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var rs *html.Node
+	walk(n, func(c *html.Node) bool {
+		if rs == nil && c.DataAtom == a {
+			rs = c
+		}
+		return rs == nil
+	})
+	return rs
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// walk 深度优先遍历, fn 返回 false 时不再进入子节点
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		walk(c, fn)
+		c = next
+	}
+}
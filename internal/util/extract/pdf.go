@@ -0,0 +1,844 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/usual2970/retell/internal/util/str"
+)
+
+// 只实现提取文字需要的部分: 对象和对象流、FlateDecode、页面树、ToUnicode 映射.
+// 扫描件等没有文字层的 PDF 提取不到内容
+
+type (
+	pdfName   string
+	pdfString []byte
+	pdfRef    int
+	pdfOp     string
+	pdfDict   map[pdfName]any
+)
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfFile struct {
+	objects map[pdfRef]any
+	order   []pdfRef // 对象在文件中出现的顺序
+	trailer pdfDict
+
+	budget  *budget
+	err     error                 // 解压超过 budget 时记录, 之后不再解压
+	decoded map[*pdfStream][]byte // 同一个流只解压一次
+	shown   map[*pdfStream]bool   // 已经提取过文字的内容流
+	cmaps   map[*pdfStream]*cmap  // 多个页面共用的字体映射只解析一次
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// maxPDFDepth 数组和字典的最大嵌套层数, 超过时认为文件损坏, 避免递归耗尽栈
+const maxPDFDepth = 100
+
+// PDF 按页面顺序提取文字层
+func PDF(data []byte) (*Doc, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return nil, errCorrupted
+	}
+
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	doc := &Doc{}
+	if title, ok := f.resolve(f.info()["Title"]).(pdfString); ok {
+		doc.Title = strings.TrimSpace(decodePDFText(title))
+	}
+
+	paragraphs := make([]string, 0)
+	for _, page := range f.pages() {
+		contents := f.contents(page)
+		if f.err != nil {
+			return nil, f.err
+		}
+		if len(contents) == 0 {
+			continue
+		}
+		fonts := f.fonts(page)
+		for _, content := range contents {
+			text, err := pdfText(content, fonts)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.budget.take(len(text)); err != nil {
+				return nil, err
+			}
+			if text != "" {
+				paragraphs = append(paragraphs, text)
+			}
+		}
+	}
+	doc.Content = clean(strings.Join(paragraphs, "\n\n"))
+	return doc, nil
+}
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	f := &pdfFile{
+		objects: map[pdfRef]any{},
+		budget:  newBudget(),
+		decoded: map[*pdfStream][]byte{},
+		shown:   map[*pdfStream]bool{},
+		cmaps:   map[*pdfStream]*cmap{},
+	}
+	end := 0
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		// 跳过流数据中恰好形如对象头的内容
+		if m[0] < end {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		lx := &pdfLexer{data: data, pos: m[1]}
+		v := lx.value()
+		if lx.err != nil {
+			return nil, lx.err
+		}
+		if d, ok := v.(pdfDict); ok {
+			if raw := lx.stream(d); raw != nil {
+				v = &pdfStream{dict: d, raw: raw}
+				// 交叉引用流的字典就是 trailer
+				if d["Type"] == pdfName("XRef") {
+					f.trailer = d
+				}
+			}
+		}
+		end = lx.pos
+		if _, ok := f.objects[pdfRef(num)]; !ok {
+			f.order = append(f.order, pdfRef(num))
+		}
+		// 增量更新时后出现的对象覆盖前面的
+		f.objects[pdfRef(num)] = v
+	}
+	if i := bytes.LastIndex(data, []byte("trailer")); i >= 0 {
+		lx := &pdfLexer{data: data, pos: i + len("trailer")}
+		v := lx.value()
+		if lx.err != nil {
+			return nil, lx.err
+		}
+		if d, ok := v.(pdfDict); ok {
+			f.trailer = d
+		}
+	}
+
+	// 对象流中的对象
+	for _, ref := range f.order {
+		s, ok := f.objects[ref].(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data := f.decode(s)
+		n, _ := f.resolve(s.dict["N"]).(float64)
+		first, _ := f.resolve(s.dict["First"]).(float64)
+		// 先按浮点数检查范围, 过大的数转成 int 会溢出
+		if data == nil || first < 0 || first > float64(len(data)) {
+			continue
+		}
+		lx := &pdfLexer{data: data[:int(first)]}
+		for i := 0; i < int(n); i++ {
+			num, _ := lx.value().(float64)
+			offset, _ := lx.value().(float64)
+			if lx.err != nil {
+				return nil, lx.err
+			}
+			if offset < 0 || offset >= float64(len(data)-int(first)) {
+				break
+			}
+			if _, ok := f.objects[pdfRef(num)]; !ok {
+				obj := &pdfLexer{data: data, pos: int(first) + int(offset)}
+				f.objects[pdfRef(num)] = obj.value()
+				if obj.err != nil {
+					return nil, obj.err
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f *pdfFile) resolve(v any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(v any) pdfDict {
+	switch d := f.resolve(v).(type) {
+	case pdfDict:
+		return d
+	case *pdfStream:
+		return d.dict
+	}
+	return nil
+}
+
+// catalog 根对象, trailer 损坏时直接找 Catalog
+func (f *pdfFile) catalog() pdfDict {
+	if d := f.dict(f.trailer["Root"]); d != nil {
+		return d
+	}
+	for _, ref := range f.order {
+		if d := f.dict(ref); d["Type"] == pdfName("Catalog") {
+			return d
+		}
+	}
+	for _, v := range f.objects {
+		if d, ok := v.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+			return d
+		}
+	}
+	return nil
+}
+
+func (f *pdfFile) info() pdfDict {
+	return f.dict(f.trailer["Info"])
+}
+
+// pages 按页面树的顺序返回页面, 页面树损坏时按对象顺序
+func (f *pdfFile) pages() []pdfDict {
+	rs := make([]pdfDict, 0)
+	seen := map[pdfRef]bool{}
+	var visit func(v any, inherited pdfDict)
+	visit = func(v any, inherited pdfDict) {
+		if ref, ok := v.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		node := f.dict(v)
+		if node == nil {
+			return
+		}
+		// 子页面继承父节点的资源
+		if res, ok := node["Resources"]; ok {
+			inherited = pdfDict{"Resources": res}
+		}
+		if kids, ok := f.resolve(node["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				visit(kid, inherited)
+			}
+			return
+		}
+		if _, ok := node["Resources"]; !ok && inherited != nil {
+			node["Resources"] = inherited["Resources"]
+		}
+		rs = append(rs, node)
+	}
+	if catalog := f.catalog(); catalog != nil {
+		visit(catalog["Pages"], nil)
+	}
+	if len(rs) > 0 {
+		return rs
+	}
+
+	for _, ref := range f.order {
+		if d := f.dict(ref); d["Type"] == pdfName("Page") {
+			rs = append(rs, d)
+		}
+	}
+	return rs
+}
+
+func (f *pdfFile) contents(page pdfDict) [][]byte {
+	refs, ok := f.resolve(page["Contents"]).([]any)
+	if !ok {
+		refs = []any{page["Contents"]}
+	}
+
+	rs := make([][]byte, 0, len(refs))
+	for _, ref := range refs {
+		// 多个页面引用同一个内容流时只提取一次
+		if s, ok := f.resolve(ref).(*pdfStream); ok && !f.shown[s] {
+			f.shown[s] = true
+			if data := f.decode(s); data != nil {
+				rs = append(rs, data)
+			}
+		}
+	}
+	return rs
+}
+
+// fonts 页面字体名称到 ToUnicode 映射, 没有映射的字体按单字节编码处理
+func (f *pdfFile) fonts(page pdfDict) map[pdfName]*cmap {
+	rs := map[pdfName]*cmap{}
+	resources := f.dict(page["Resources"])
+	for name, ref := range f.dict(resources["Font"]) {
+		font := f.dict(ref)
+		s, ok := f.resolve(font["ToUnicode"]).(*pdfStream)
+		if !ok {
+			continue
+		}
+		if c, ok := f.cmaps[s]; ok {
+			rs[name] = c
+			continue
+		}
+		if data := f.decode(s); data != nil {
+			f.cmaps[s] = parseCMap(data)
+			rs[name] = f.cmaps[s]
+		}
+	}
+	return rs
+}
+
+// decode 只支持 FlateDecode, 其他压缩方式多是图片.
+// 解压的总量超过 budget 后记录错误并返回 nil.
+func (f *pdfFile) decode(s *pdfStream) []byte {
+	if data, ok := f.decoded[s]; ok {
+		return data
+	}
+	if f.err != nil {
+		return nil
+	}
+	data := f.inflate(s)
+	if err := f.budget.take(len(data)); err != nil {
+		f.err = err
+		return nil
+	}
+	f.decoded[s] = data
+	return data
+}
+
+func (f *pdfFile) inflate(s *pdfStream) []byte {
+	filters := []any{}
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, v)
+	case []any:
+		filters = v
+	}
+
+	data := s.raw
+	for _, filter := range filters {
+		if f.resolve(filter) != pdfName("FlateDecode") {
+			return nil
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		// 数据末尾损坏时保留已经解压的部分
+		out, _ := io.ReadAll(io.LimitReader(zr, maxEntrySize))
+		zr.Close()
+		data = out
+	}
+	return data
+}
+
+// pdfText 执行内容流中的文字操作符, 按文字的纵坐标换行
+func pdfText(content []byte, fonts map[pdfName]*cmap) (string, error) {
+	sb := &strings.Builder{}
+	lx := &pdfLexer{data: content}
+	operands := make([]any, 0, 8)
+	var (
+		font     *cmap
+		y        float64      // 当前行的纵坐标
+		tl       float64      // TL 设置的行距
+		shownY   = math.NaN() // 上一次输出文字时的纵坐标
+		lineStep float64      // 最近一次正常换行的距离
+	)
+
+	// show 输出文字, 纵坐标变化时换行, 间距明显大于行距时分段
+	show := func(s pdfString) {
+		if !math.IsNaN(shownY) && y != shownY {
+			dy := math.Abs(shownY - y)
+			if lineStep > 0 && dy > lineStep*1.6 {
+				sb.WriteString("\n\n")
+			} else {
+				sb.WriteString("\n")
+				lineStep = dy
+			}
+		}
+		shownY = y
+		sb.WriteString(font.decode(s))
+	}
+	operand := func(i int) any {
+		if i < 0 || i >= len(operands) {
+			return nil
+		}
+		return operands[i]
+	}
+	number := func(i int) float64 {
+		n, _ := operand(i).(float64)
+		return n
+	}
+
+	for {
+		v := lx.value()
+		if lx.err != nil {
+			return "", lx.err
+		}
+		if v == nil && lx.eof() {
+			break
+		}
+		op, ok := v.(pdfOp)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+
+		n := len(operands)
+		switch op {
+		case "BI":
+			lx.skipInlineImage()
+		case "BT":
+			y = 0
+		case "Tf":
+			name, _ := operand(n - 2).(pdfName)
+			font = fonts[name]
+		case "TL":
+			tl = number(n - 1)
+		case "Td":
+			y += number(n - 1)
+		case "TD":
+			tl = -number(n - 1)
+			y += number(n - 1)
+		case "Tm":
+			y = number(n - 1)
+		case "T*":
+			y -= tl
+		case "Tj":
+			if s, ok := operand(n - 1).(pdfString); ok {
+				show(s)
+			}
+		case "'", "\"":
+			y -= tl
+			if s, ok := operand(n - 1).(pdfString); ok {
+				show(s)
+			}
+		case "TJ":
+			items, _ := operand(n - 1).([]any)
+			for _, item := range items {
+				switch t := item.(type) {
+				case pdfString:
+					show(t)
+				case float64:
+					// 较大的负偏移相当于空格
+					if t < -200 {
+						sb.WriteString(" ")
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return reflow(sb.String()), nil
+}
+
+// reflow 把同一段中按版面折行的文字接起来
+func reflow(text string) string {
+	paragraphs := strings.Split(text, "\n\n")
+	for i, p := range paragraphs {
+		lines := strings.Split(p, "\n")
+		sb := &strings.Builder{}
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				str.JoinLine(sb, line)
+			}
+		}
+		paragraphs[i] = sb.String()
+	}
+	return strings.TrimSpace(strings.Join(paragraphs, "\n\n"))
+}
+
+// decodePDFText 文档信息中的字符串, UTF-16BE 或者 PDFDocEncoding
+func decodePDFText(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		return utf16BE(s[2:])
+	}
+	return latin1(s)
+}
+
+func utf16BE(b []byte) string {
+	codes := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		codes = append(codes, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(codes))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// cmap ToUnicode 映射, 字符编码到文字
+type cmap struct {
+	width int // 编码的字节数
+	chars map[uint32]string
+}
+
+var (
+	bfchar  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	bfrange = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	hexCode = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>|\[|\]`)
+)
+
+func parseCMap(data []byte) *cmap {
+	c := &cmap{width: 1, chars: map[uint32]string{}}
+	code := func(h string) (uint32, int) {
+		b, _ := hex.DecodeString(strings.Join(strings.Fields(h), ""))
+		var v uint32
+		for _, x := range b {
+			v = v<<8 | uint32(x)
+		}
+		return v, len(b)
+	}
+
+	for _, m := range bfchar.FindAllSubmatch(data, -1) {
+		tokens := hexCode.FindAllStringSubmatch(string(m[1]), -1)
+		for i := 0; i+1 < len(tokens); i += 2 {
+			src, width := code(tokens[i][1])
+			c.width = max(c.width, width)
+			dst, _ := hex.DecodeString(strings.Join(strings.Fields(tokens[i+1][1]), ""))
+			c.chars[src] = utf16BE(dst)
+		}
+	}
+
+	for _, m := range bfrange.FindAllSubmatch(data, -1) {
+		tokens := hexCode.FindAllStringSubmatch(string(m[1]), -1)
+		for i := 0; i+2 < len(tokens); {
+			lo, width := code(tokens[i][1])
+			hi, _ := code(tokens[i+1][1])
+			c.width = max(c.width, width)
+			if hi < lo || hi-lo > 0xffff {
+				break
+			}
+			if tokens[i+2][0] == "[" {
+				j := i + 3
+				for k := lo; j < len(tokens) && tokens[j][0] != "]"; j, k = j+1, k+1 {
+					dst, _ := hex.DecodeString(strings.Join(strings.Fields(tokens[j][1]), ""))
+					c.chars[k] = utf16BE(dst)
+				}
+				i = j + 1
+				continue
+			}
+
+			dst, _ := hex.DecodeString(strings.Join(strings.Fields(tokens[i+2][1]), ""))
+			for k := lo; k <= hi; k++ {
+				c.chars[k] = utf16BE(dst)
+				// 范围内的编码依次加一
+				if len(dst) > 0 {
+					dst = bytes.Clone(dst)
+					dst[len(dst)-1]++
+				}
+			}
+			i += 3
+		}
+	}
+	return c
+}
+
+func (c *cmap) decode(s pdfString) string {
+	if c == nil {
+		return latin1(s)
+	}
+	sb := &strings.Builder{}
+	for i := 0; i+c.width <= len(s); i += c.width {
+		var code uint32
+		for _, b := range s[i : i+c.width] {
+			code = code<<8 | uint32(b)
+		}
+		sb.WriteString(c.chars[code])
+	}
+	return sb.String()
+}
+
+// pdfLexer 读取 PDF 对象和内容流中的记号
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int // 当前数组和字典的嵌套层数
+	err   error
+}
+
+func (lx *pdfLexer) eof() bool {
+	lx.skipSpace()
+	return lx.pos >= len(lx.data)
+}
+
+func (lx *pdfLexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		lx.pos++
+	}
+}
+
+// value 读取一个值, 遇到关键字时返回 pdfOp
+func (lx *pdfLexer) value() any {
+	lx.skipSpace()
+	if lx.pos >= len(lx.data) {
+		return nil
+	}
+
+	c := lx.data[lx.pos]
+	switch {
+	case c == '/':
+		lx.pos++
+		return pdfName(lx.word())
+	case c == '(':
+		return lx.literal()
+	case c == '<' && lx.peek(1) == '<':
+		if !lx.nest() {
+			return nil
+		}
+		defer lx.unnest()
+		lx.pos += 2
+		d := pdfDict{}
+		for {
+			lx.skipSpace()
+			if lx.pos >= len(lx.data) {
+				return d
+			}
+			if lx.data[lx.pos] == '>' && lx.peek(1) == '>' {
+				lx.pos += 2
+				return d
+			}
+			key, ok := lx.value().(pdfName)
+			if !ok {
+				continue
+			}
+			d[key] = lx.value()
+		}
+	case c == '<':
+		end := bytes.IndexByte(lx.data[lx.pos:], '>')
+		if end < 0 {
+			lx.pos = len(lx.data)
+			return pdfString(nil)
+		}
+		h := strings.Join(strings.Fields(string(lx.data[lx.pos+1:lx.pos+end])), "")
+		lx.pos += end + 1
+		if len(h)%2 == 1 {
+			h += "0"
+		}
+		b, _ := hex.DecodeString(h)
+		return pdfString(b)
+	case c == '[':
+		if !lx.nest() {
+			return nil
+		}
+		defer lx.unnest()
+		lx.pos++
+		arr := make([]any, 0)
+		for {
+			lx.skipSpace()
+			if lx.pos >= len(lx.data) {
+				return arr
+			}
+			if lx.data[lx.pos] == ']' {
+				lx.pos++
+				return arr
+			}
+			arr = append(arr, lx.value())
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		lx.pos++
+		return pdfOp(string(rune(c)))
+	}
+
+	word := lx.word()
+	if word == "" {
+		lx.pos++
+		return pdfOp(string(rune(c)))
+	}
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		// 形如 "12 0 R" 的间接引用
+		save := lx.pos
+		if gen, ok := lx.value().(float64); ok && gen == math.Trunc(gen) {
+			if op, ok := lx.value().(pdfOp); ok && op == "R" {
+				return pdfRef(n)
+			}
+		}
+		lx.pos = save
+		return n
+	}
+	switch word {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return pdfOp(word)
+}
+
+// nest 进入一层数组或字典, 嵌套过深时记录错误并跳到末尾
+func (lx *pdfLexer) nest() bool {
+	if lx.depth >= maxPDFDepth {
+		lx.err = errCorrupted
+		lx.pos = len(lx.data)
+		return false
+	}
+	lx.depth++
+	return true
+}
+
+func (lx *pdfLexer) unnest() {
+	lx.depth--
+}
+
+func (lx *pdfLexer) word() string {
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	return string(lx.data[start:lx.pos])
+}
+
+func (lx *pdfLexer) peek(n int) byte {
+	if lx.pos+n < len(lx.data) {
+		return lx.data[lx.pos+n]
+	}
+	return 0
+}
+
+func (lx *pdfLexer) literal() pdfString {
+	lx.pos++
+	rs := make([]byte, 0)
+	depth := 1
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return rs
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return rs
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				if e == '\r' && lx.peek(0) == '\n' {
+					lx.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		rs = append(rs, c)
+	}
+	return rs
+}
+
+// stream 读取字典后面的流数据, 长度不可信时找 endstream
+func (lx *pdfLexer) stream(d pdfDict) []byte {
+	save := lx.pos
+	lx.skipSpace()
+	if !bytes.HasPrefix(lx.data[lx.pos:], []byte("stream")) {
+		lx.pos = save
+		return nil
+	}
+	start := lx.pos + len("stream")
+	if start < len(lx.data) && lx.data[start] == '\r' {
+		start++
+	}
+	if start < len(lx.data) && lx.data[start] == '\n' {
+		start++
+	}
+
+	if length, ok := d["Length"].(float64); ok && length >= 0 && length <= float64(len(lx.data)-start) {
+		end := start + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(lx.data[end:], "\r\n "), []byte("endstream")) {
+			lx.pos = end
+			return lx.data[start:end]
+		}
+	}
+	end := bytes.Index(lx.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	lx.pos = start + end
+	return bytes.TrimRight(lx.data[start:start+end], "\r\n")
+}
+
+// skipInlineImage 跳过 BI ... ID 二进制数据 EI
+func (lx *pdfLexer) skipInlineImage() {
+	id := bytes.Index(lx.data[lx.pos:], []byte("ID"))
+	if id < 0 {
+		lx.pos = len(lx.data)
+		return
+	}
+	lx.pos += id + 2
+	for lx.pos < len(lx.data) {
+		ei := bytes.Index(lx.data[lx.pos:], []byte("EI"))
+		if ei < 0 {
+			lx.pos = len(lx.data)
+			return
+		}
+		lx.pos += ei + 2
+		if lx.pos >= len(lx.data) || isPDFSpace(lx.data[lx.pos]) {
+			return
+		}
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
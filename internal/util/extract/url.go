@@ -0,0 +1,193 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// maxPageSize 网页或者文档的最大字节数
+	maxPageSize  = 20 << 20
+	fetchTimeout = 30 * time.Second
+	userAgent    = "Mozilla/5.0 (compatible; RetellBot/1.0)"
+	maxRedirects = 10
+)
+
+// errForbiddenAddress 网址解析到内网、本机等非公网地址
+var errForbiddenAddress = errors.New("forbidden address")
+
+// fetchClient 只能连接公网地址, 防止借导入网址访问内网服务.
+// 在建立连接时检查解析出的 IP, 重定向的每一跳都会重新检查.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublic}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+	CheckRedirect: checkRedirect,
+}
+
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addr.Addr()) {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, addr.Addr())
+	}
+	return nil
+}
+
+// deniedPrefixes 不允许访问的地址段: 本机、内网、链路本地、组播和保留地址
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"), // 基准测试
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"), // 未指定、本机和已废弃的 IPv4 兼容地址
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"), // Teredo
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+var (
+	nat64     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour = netip.MustParsePrefix("2002::/16")
+)
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return false
+	}
+	// NAT64 和 6to4 地址会转到其中嵌入的 IPv4 地址
+	if v4, ok := embeddedIPv4(ip); ok && !isPublic(v4) {
+		return false
+	}
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func embeddedIPv4(ip netip.Addr) (netip.Addr, bool) {
+	b := ip.As16()
+	switch {
+	case nat64.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+// checkRedirect 地址在连接时检查, 这里限制跳转次数和协议
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to %s not allowed", req.URL.Scheme)
+	}
+	return nil
+}
+
+// IsURL 整条消息是否只有一个网址
+func IsURL(text string) bool {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, " \n\t") {
+		return false
+	}
+	u, err := url.Parse(text)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// URL 下载网页并提取正文, 网址指向支持的文档时按文档处理
+func URL(ctx context.Context, rawURL string) (*Doc, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(rawURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.8")
+
+	res, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", rawURL, res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPageSize {
+		return nil, errors.New("page too large")
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "":
+		if data, err = toUTF8(data, contentType); err != nil {
+			return nil, err
+		}
+		return File("page.html", data)
+	case mediaType == "text/plain":
+		if data, err = toUTF8(data, contentType); err != nil {
+			return nil, err
+		}
+		return File("page.txt", data)
+	case mediaType == "text/markdown":
+		return File("page.md", data)
+	}
+
+	// 其他类型按网址中的文件名判断
+	return File(path.Base(res.Request.URL.Path), data)
+}
+
+// toUTF8 按响应头或者页面中声明的编码转换成 UTF-8
+func toUTF8(data []byte, contentType string) ([]byte, error) {
+	r, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
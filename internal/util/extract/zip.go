@@ -0,0 +1,219 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxEntrySize 压缩包中单个文件解压后的最大字节数, 防止压缩炸弹
+const maxEntrySize = 32 << 20
+
+var errCorrupted = errors.New("corrupted document")
+
+// Docx 提取 Word 文档, 标题取文档属性或者 Title 样式的段落
+func Docx(data []byte) (*Doc, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readEntry(zr, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Doc{}
+	if core, err := readEntry(zr, "docProps/core.xml"); err == nil {
+		doc.Title = strings.TrimSpace(xmlText(core, "title"))
+	}
+
+	paragraphs := make([]string, 0)
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	sb := &strings.Builder{}
+	style, inText := "", false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				sb.Reset()
+				style = ""
+			case "pStyle":
+				style = xmlAttr(t, "val")
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(sb.String())
+				if text == "" {
+					continue
+				}
+				if doc.Title == "" && len(paragraphs) == 0 && style == "Title" {
+					doc.Title = text
+					continue
+				}
+				paragraphs = append(paragraphs, text)
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+
+	doc.Content = clean(strings.Join(paragraphs, "\n\n"))
+	return doc, nil
+}
+
+// Epub 按书脊顺序提取每一章的文字
+func Epub(data []byte) (*Doc, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	container := struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}{}
+	if err := unmarshalEntry(zr, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, errCorrupted
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	pkg := struct {
+		Title string `xml:"metadata>title"`
+		Items []struct {
+			Id   string `xml:"id,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			Idref string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}{}
+	if err := unmarshalEntry(zr, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Items))
+	for _, item := range pkg.Items {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			href = item.Href
+		}
+		hrefs[item.Id] = path.Join(path.Dir(opfPath), href)
+	}
+
+	// 同一章在书脊中重复出现时只读一次
+	b := newBudget()
+	read := map[string]bool{}
+	paragraphs := make([]string, 0)
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.Idref]
+		if !ok || read[href] {
+			continue
+		}
+		read[href] = true
+		chapter, err := readEntry(zr, href)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.take(len(chapter)); err != nil {
+			return nil, err
+		}
+		root, err := html.Parse(bytes.NewReader(chapter))
+		if err != nil {
+			return nil, err
+		}
+		prune(root)
+		if body := find(root, atom.Body); body != nil {
+			collect(body, &paragraphs)
+		}
+	}
+
+	return &Doc{
+		Title:   strings.TrimSpace(pkg.Title),
+		Content: clean(strings.Join(paragraphs, "\n\n")),
+	}, nil
+}
+
+func readEntry(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEntrySize {
+		return nil, errCorrupted
+	}
+	return data, nil
+}
+
+func unmarshalEntry(zr *zip.Reader, name string, v any) error {
+	data, err := readEntry(zr, name)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// xmlText 第一个名为 local 的元素的文字, 忽略命名空间
+func xmlText(data []byte, local string) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == local {
+			var text string
+			if err := decoder.DecodeElement(&text, &t); err != nil {
+				return ""
+			}
+			return text
+		}
+	}
+}
+
+func xmlAttr(t xml.StartElement, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"time"
@@ -21,6 +22,11 @@ func WithTimeout(timeout time.Duration) Option {
 }
 
 func Req(url string, method string, body io.Reader, head map[string]string, opts ...Option) ([]byte, error) {
+	return ReqContext(context.Background(), url, method, body, head, opts...)
+}
+
+// ReqContext 与 Req 相同, 请求随 ctx 取消, ctx 的期限早于超时时间时以 ctx 为准
+func ReqContext(ctx context.Context, url string, method string, body io.Reader, head map[string]string, opts ...Option) ([]byte, error) {
 	options := &Options{
 		Timeout: 30000 * time.Millisecond,
 	}
@@ -30,8 +36,10 @@ func Req(url string, method string, body io.Reader, head map[string]string, opts
 	}
 	client := httpclient.NewClient(httpclient.WithHTTPTimeout(options.Timeout))
 
-	// Create an http.Request instance
-	req, _ := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
 	for k, v := range head {
 		req.Header.Set(k, v)
 	}
@@ -44,3 +52,17 @@ func Req(url string, method string, body io.Reader, head map[string]string, opts
 
 	return io.ReadAll(res.Body)
 }
+
+// Stream 发送请求并直接返回响应, 由调用方逐步读取并关闭 Body, 适用于 SSE 等流式接口.
+// 整个请求的生命周期由 ctx 控制, 不设置超时.
+func Stream(ctx context.Context, url string, method string, body io.Reader, head map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range head {
+		req.Header.Set(k, v)
+	}
+
+	return http.DefaultClient.Do(req)
+}
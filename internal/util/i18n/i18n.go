@@ -0,0 +1,161 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 机器人界面的多语言文案, 每种语言一个 locales/<语言>.json, 键相同;
+// 文案是 fmt 格式串, 需要区分单复数的文案写成 {"one": "...", "other": "..."}
+
+//go:embed locales/*.json
+var files embed.FS
+
+const (
+	// Default 没有语言信息时使用的语言
+	Default = "zh"
+	// Fallback 不支持用户的语言时使用的语言
+	Fallback = "en"
+)
+
+// Locales 支持的语言, 按选择语言时的展示顺序
+var Locales = []string{"zh", "en", "ja", "vi"}
+
+// pluralForms 各语言需要的复数类别, 没有列出的语言不区分单复数, 只有 other
+var pluralForms = map[string][]string{
+	"en": {"one", "other"},
+}
+
+// message 一条文案, 不区分单复数时只有 text
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.plural)
+}
+
+var (
+	catalog map[string]map[string]message
+	once    sync.Once
+)
+
+// getCatalog 文案随程序一起编译, 格式错误在测试中就会发现
+func getCatalog() map[string]map[string]message {
+	once.Do(func() {
+		rs, err := load()
+		if err != nil {
+			panic(err)
+		}
+		catalog = rs
+	})
+	return catalog
+}
+
+func load() (map[string]map[string]message, error) {
+	rs := make(map[string]map[string]message, len(Locales))
+	for _, lang := range Locales {
+		data, err := files.ReadFile(path.Join("locales", lang+".json"))
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]message)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", lang, err)
+		}
+		rs[lang] = messages
+	}
+	return rs, nil
+}
+
+// Supported 是否支持该语言
+func Supported(lang string) bool {
+	_, ok := getCatalog()[lang]
+	return ok
+}
+
+// Match 把 Telegram 的 language_code(如 en-US、zh-hans)匹配到支持的语言
+func Match(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return Default
+	}
+	base, _, _ := strings.Cut(strings.ReplaceAll(code, "_", "-"), "-")
+	if Supported(base) {
+		return base
+	}
+	return Fallback
+}
+
+// Name 语言用自身文字写的名称, 如 English、日本語
+func Name(lang string) string {
+	return New(lang).T("language.name")
+}
+
+// Localizer 按一种语言取文案
+type Localizer struct {
+	lang string
+}
+
+func New(lang string) *Localizer {
+	return &Localizer{lang: Match(lang)}
+}
+
+func (l *Localizer) Lang() string {
+	return l.lang
+}
+
+// T 取文案并用 args 格式化, 当前语言缺少时依次使用默认语言和键本身
+func (l *Localizer) T(key string, args ...any) string {
+	return l.format(key, "other", args)
+}
+
+// N 按 n 选择单复数形式, n 作为第一个格式化参数
+func (l *Localizer) N(key string, n int, args ...any) string {
+	return l.format(key, pluralForm(l.lang, n), append([]any{n}, args...))
+}
+
+// Duration 把撤销时限等时长格式化成分钟或秒
+func (l *Localizer) Duration(d time.Duration) string {
+	if d >= time.Minute {
+		return l.N("duration.minutes", int(d.Minutes()))
+	}
+	return l.N("duration.seconds", int(d.Seconds()))
+}
+
+func (l *Localizer) format(key, form string, args []any) string {
+	msg, ok := getCatalog()[l.lang][key]
+	if !ok {
+		if msg, ok = getCatalog()[Default][key]; !ok {
+			return key
+		}
+	}
+
+	text := msg.text
+	if msg.plural != nil {
+		if text, ok = msg.plural[form]; !ok {
+			text = msg.plural["other"]
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// pluralForm CLDR 的复数类别, 目前支持的语言只需要区分 one 和 other
+func pluralForm(lang string, n int) string {
+	if len(pluralForms[lang]) > 1 && n == 1 {
+		return "one"
+	}
+	return "other"
+}
@@ -0,0 +1,116 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+var verbReg = regexp.MustCompile(`%(?:\[\d+\])?[-+# 0]*\d*(?:\.\d+)?[a-zA-Z]`)
+
+// verbs 格式串中的占位符类型, 翻译时可以调整顺序
+func verbs(text string) []string {
+	rs := make([]string, 0)
+	for _, verb := range verbReg.FindAllString(text, -1) {
+		rs = append(rs, verb[len(verb)-1:])
+	}
+	slices.Sort(rs)
+	return rs
+}
+
+func TestCatalog(t *testing.T) {
+	catalog, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lang := range Locales {
+		messages := catalog[lang]
+		for key, want := range catalog[Default] {
+			got, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: missing key %s", lang, key)
+				continue
+			}
+			if (got.plural == nil) != (want.plural == nil) {
+				t.Errorf("%s: %s plural mismatch", lang, key)
+				continue
+			}
+
+			texts := map[string]string{"other": got.text}
+			if got.plural != nil {
+				texts = got.plural
+				forms := pluralForms[lang]
+				if forms == nil {
+					forms = []string{"other"}
+				}
+				for _, form := range forms {
+					if _, ok := got.plural[form]; !ok {
+						t.Errorf("%s: %s missing plural form %s", lang, key, form)
+					}
+				}
+			}
+
+			wantVerbs := verbs(want.text)
+			if want.plural != nil {
+				wantVerbs = verbs(want.plural["other"])
+			}
+			for form, text := range texts {
+				if text == "" {
+					t.Errorf("%s: %s.%s is empty", lang, key, form)
+				}
+				if got := verbs(text); !slices.Equal(got, wantVerbs) {
+					t.Errorf("%s: %s.%s verbs = %v, want %v", lang, key, form, got, wantVerbs)
+				}
+			}
+		}
+
+		for key := range messages {
+			if _, ok := catalog[Default][key]; !ok {
+				t.Errorf("%s: unknown key %s", lang, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"":        Default,
+		"en":      "en",
+		"en-US":   "en",
+		"zh-hans": "zh",
+		"ZH_TW":   "zh",
+		"ja":      "ja",
+		"vi":      "vi",
+		"fr":      Fallback,
+	}
+	for code, want := range tests {
+		if got := Match(code); got != want {
+			t.Errorf("Match(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	tests := []struct {
+		lang string
+		got  func(l *Localizer) string
+		want string
+	}{
+		{"en", func(l *Localizer) string { return l.N("list.total", 1) }, "1 essay"},
+		{"en", func(l *Localizer) string { return l.N("list.total", 3) }, "3 essays"},
+		{"zh", func(l *Localizer) string { return l.N("list.total", 1) }, "共 1 篇"},
+		{"en", func(l *Localizer) string { return l.N("version.list", 2, "Fox") }, "“Fox” has 2 versions. Choose one to see the changes"},
+		{"en", func(l *Localizer) string { return l.N("review.title", 1) }, "1 word is due for review"},
+		{"ja", func(l *Localizer) string { return l.T("add.saved", "Fox") }, "『Fox』を保存しました"},
+		{"vi", func(l *Localizer) string { return l.Duration(90 * time.Second) }, "1 phút"},
+		{"en", func(l *Localizer) string { return l.Duration(30 * time.Second) }, "30 seconds"},
+		{"en", func(l *Localizer) string { return l.T("no.such.key") }, "no.such.key"},
+	}
+	for _, tt := range tests {
+		if got := tt.got(New(tt.lang)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/metrics"
+	"github.com/usual2970/retell/internal/util/openai"
+	"github.com/usual2970/retell/internal/util/zhipu"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	ProviderZhipu  = "zhipu"
+	ProviderOpenAI = "openai"
+)
+
+type Config struct {
+	Provider string
+	BaseUrl  string
+	ApiKey   string
+	// ImageApiKey 图片生成单独使用的密钥, 为空时使用 ApiKey
+	ImageApiKey string
+
+	ChatModel      string
+	EmbeddingModel string
+	ImageModel     string
+	VisionModel    string
+}
+
+// ConfigFromEnv 从环境变量读取配置, 未设置 LLM_PROVIDER 时使用智谱
+func ConfigFromEnv() *Config {
+	conf := &Config{
+		Provider:       os.Getenv("LLM_PROVIDER"),
+		ChatModel:      os.Getenv("LLM_CHAT_MODEL"),
+		EmbeddingModel: os.Getenv("LLM_EMBEDDING_MODEL"),
+		ImageModel:     os.Getenv("LLM_IMAGE_MODEL"),
+		VisionModel:    os.Getenv("LLM_VISION_MODEL"),
+	}
+
+	switch conf.Provider {
+	case ProviderOpenAI:
+		conf.BaseUrl = os.Getenv("OPENAI_BASE_URL")
+		conf.ApiKey = os.Getenv("OPENAI_API_KEY")
+		conf.ImageApiKey = os.Getenv("OPENAI_IMAGE_API_KEY")
+	default:
+		conf.Provider = ProviderZhipu
+		conf.BaseUrl = os.Getenv("ZHIPU_BASE_URL")
+		conf.ApiKey = os.Getenv("ZHIPU_API_KEY")
+		conf.ImageApiKey = os.Getenv("ZHIPU_IMAGE_API_KEY")
+	}
+
+	return conf
+}
+
+var instance domain.ILLM
+var once sync.Once
+
+// Default 返回按环境变量配置的实例
+func Default() domain.ILLM {
+	once.Do(func() {
+		instance = New(ConfigFromEnv())
+	})
+	return instance
+}
+
+type provider struct {
+	llms.Model
+	name     string
+	embedder embedder
+	imager   imager
+	visioner visioner
+}
+
+type embedder interface {
+	CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+type imager interface {
+	GenerateImg(ctx context.Context, prompt string) (string, error)
+}
+
+type visioner interface {
+	Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error)
+}
+
+func (p *provider) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (rs *llms.ContentResponse, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(p.name, "chat", start, err) }(time.Now())
+	return p.Model.GenerateContent(ctx, messages, options...)
+}
+
+func (p *provider) Call(ctx context.Context, prompt string, options ...llms.CallOption) (rs string, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(p.name, "chat", start, err) }(time.Now())
+	return p.Model.Call(ctx, prompt, options...)
+}
+
+func (p *provider) CreateEmbedding(ctx context.Context, texts []string) (rs [][]float32, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(p.name, "embedding", start, err) }(time.Now())
+	return p.embedder.CreateEmbedding(ctx, texts)
+}
+
+func (p *provider) GenerateImg(ctx context.Context, prompt string) (rs string, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(p.name, "image", start, err) }(time.Now())
+	return p.imager.GenerateImg(ctx, prompt)
+}
+
+func (p *provider) Vision(ctx context.Context, prompt string, image []byte, mimeType string) (rs string, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(p.name, "vision", start, err) }(time.Now())
+	return p.visioner.Vision(ctx, prompt, image, mimeType)
+}
+
+func New(conf *Config) domain.ILLM {
+	imageApiKey := conf.ImageApiKey
+	if imageApiKey == "" {
+		imageApiKey = conf.ApiKey
+	}
+
+	switch conf.Provider {
+	case ProviderZhipu, "":
+		var options []llms.CallOption
+		if conf.ChatModel != "" {
+			options = append(options, llms.WithModel(conf.ChatModel))
+		}
+		client := zhipu.NewZhipu(conf.ApiKey, options...).
+			WithBaseUrl(conf.BaseUrl).
+			WithEmbeddingModel(conf.EmbeddingModel).
+			WithVisionModel(conf.VisionModel)
+
+		return &provider{
+			Model:    client,
+			name:     ProviderZhipu,
+			embedder: client,
+			visioner: client,
+			imager:   zhipu.NewZhipu(imageApiKey).WithBaseUrl(conf.BaseUrl).WithImageModel(conf.ImageModel),
+		}
+	case ProviderOpenAI:
+		client := openai.New(&openai.Config{
+			BaseUrl:        conf.BaseUrl,
+			ApiKey:         conf.ApiKey,
+			ChatModel:      conf.ChatModel,
+			EmbeddingModel: conf.EmbeddingModel,
+			VisionModel:    conf.VisionModel,
+		})
+
+		return &provider{
+			Model:    client,
+			name:     ProviderOpenAI,
+			embedder: client,
+			visioner: client,
+			imager: openai.New(&openai.Config{
+				BaseUrl:    conf.BaseUrl,
+				ApiKey:     imageApiKey,
+				ImageModel: conf.ImageModel,
+			}),
+		}
+	}
+
+	return &unsupported{provider: conf.Provider}
+}
+
+// unsupported 未知的服务商, 所有调用都返回错误
+type unsupported struct {
+	provider string
+}
+
+func (u *unsupported) err() error {
+	return fmt.Errorf("unsupported llm provider: %s", u.provider)
+}
+
+func (u *unsupported) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return nil, u.err()
+}
+
+func (u *unsupported) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", u.err()
+}
+
+func (u *unsupported) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, u.err()
+}
+
+func (u *unsupported) GenerateImg(ctx context.Context, prompt string) (string, error) {
+	return "", u.err()
+}
+
+func (u *unsupported) Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error) {
+	return "", u.err()
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/usual2970/retell/internal/util/app"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys 值会被整体隐藏的字段
+var secretKeys = map[string]bool{
+	"token":         true,
+	"apikey":        true,
+	"api_key":       true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+}
+
+// bodyKeys 文章正文等用户内容, 只记录长度
+var bodyKeys = map[string]bool{
+	"content":  true,
+	"text":     true,
+	"body":     true,
+	"prompt":   true,
+	"question": true,
+	"answer":   true,
+}
+
+type attrsKey struct{}
+
+// With 把关联字段(如 update_id、chat_id、essay_id)放进 ctx, 之后通过 FromContext 输出的日志都会带上
+func With(ctx context.Context, args ...any) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]any)
+	attrs := make([]any, 0, len(prev)+len(args))
+	attrs = append(attrs, prev...)
+	attrs = append(attrs, args...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// FromContext 返回带有 ctx 中关联字段并会脱敏的 logger
+func FromContext(ctx context.Context) *slog.Logger {
+	l := slog.New(NewHandler(app.Get().Logger().Handler()))
+	if attrs, ok := ctx.Value(attrsKey{}).([]any); ok && len(attrs) > 0 {
+		l = l.With(attrs...)
+	}
+	return l
+}
+
+type handler struct {
+	slog.Handler
+}
+
+// NewHandler 包装 inner, 输出前隐藏密钥类字段并把正文替换成长度
+func NewHandler(inner slog.Handler) slog.Handler {
+	return &handler{Handler: inner}
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	rs := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		rs.AddAttrs(redact(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, rs)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	rs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		rs = append(rs, redact(a))
+	}
+	return &handler{Handler: h.Handler.WithAttrs(rs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{Handler: h.Handler.WithGroup(name)}
+}
+
+func redact(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+
+	switch {
+	case a.Value.Kind() == slog.KindGroup:
+		attrs := a.Value.Group()
+		rs := make([]slog.Attr, 0, len(attrs))
+		for _, attr := range attrs {
+			rs = append(rs, redact(attr))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(rs...)}
+	case secretKeys[key]:
+		return slog.String(a.Key, redacted)
+	case bodyKeys[key]:
+		return slog.String(a.Key, fmt.Sprintf("[%d chars]", len([]rune(a.Value.String()))))
+	case a.Value.Kind() == slog.KindString && strings.HasPrefix(a.Value.String(), "Bearer "):
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		args []any
+		key  string
+		want any
+	}{
+		{
+			name: "secret",
+			args: []any{"token", "abc.def"},
+			key:  "token",
+			want: redacted,
+		},
+		{
+			name: "secret case insensitive",
+			args: []any{"apiKey", "sk-123"},
+			key:  "apiKey",
+			want: redacted,
+		},
+		{
+			name: "bearer value",
+			args: []any{"header", "Bearer sk-123"},
+			key:  "header",
+			want: redacted,
+		},
+		{
+			name: "body",
+			args: []any{"content", "Hello world"},
+			key:  "content",
+			want: "[11 chars]",
+		},
+		{
+			name: "group",
+			args: []any{slog.Group("req", "password", "123456")},
+			key:  "req",
+			want: map[string]any{"password": redacted},
+		},
+		{
+			name: "plain",
+			args: []any{"essay_id", "abc"},
+			key:  "essay_id",
+			want: "abc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l := slog.New(NewHandler(slog.NewJSONHandler(buf, nil)))
+			l.Info("test", tt.args...)
+
+			line := map[string]any{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("unmarshal log line error = %v", err)
+			}
+
+			got, _ := json.Marshal(line[tt.key])
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("log %s = %s, want %s", tt.key, got, want)
+			}
+		})
+	}
+}
+
+func TestHandler_WithAttrs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := slog.New(NewHandler(slog.NewJSONHandler(buf, nil))).With("token", "abc", "chat_id", 1)
+	l.Info("test")
+
+	line := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("unmarshal log line error = %v", err)
+	}
+	if line["token"] != redacted {
+		t.Errorf("log token = %v, want %v", line["token"], redacted)
+	}
+	if line["chat_id"] != float64(1) {
+		t.Errorf("log chat_id = %v, want 1", line["chat_id"])
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "retell"
+
+const (
+	StatusOk    = "ok"
+	StatusError = "error"
+)
+
+// 所有标签的取值都必须是有限集合, 不能带聊天 id、文章 id 等
+var (
+	registry = prometheus.NewRegistry()
+
+	UpdatesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_received_total",
+		Help:      "Telegram updates received by type.",
+	}, []string{"type"})
+
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling an update per command or callback.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "status"})
+
+	SendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_send_errors_total",
+		Help:      "Telegram send failures by error code.",
+	}, []string{"code"})
+
+	ProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "External provider calls by provider, operation and status.",
+	}, []string{"provider", "operation", "status"})
+
+	ProviderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_duration_seconds",
+		Help:      "External provider call latency.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"provider", "operation"})
+
+	JobsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_in_flight",
+		Help:      "Background post-processing jobs currently running.",
+	}, []string{"job"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		UpdatesReceived,
+		HandlerDuration,
+		SendErrors,
+		ProviderRequests,
+		ProviderDuration,
+		JobsInFlight,
+	)
+}
+
+// GaugeFunc 注册一个在采集时才取值的指标, 例如队列长度
+func GaugeFunc(name, help string, fn func() float64) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// ObserveProvider 记录一次外部服务调用的耗时和结果
+func ObserveProvider(provider, operation string, start time.Time, err error) {
+	status := StatusOk
+	if err != nil {
+		status = StatusError
+	}
+	ProviderRequests.WithLabelValues(provider, operation, status).Inc()
+	ProviderDuration.WithLabelValues(provider, operation).Observe(time.Since(start).Seconds())
+}
+
+// TrackJob 记录后台任务的并发数, 返回的函数在任务结束时调用
+func TrackJob(job string) func() {
+	gauge := JobsInFlight.WithLabelValues(job)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status string
+	}{
+		{
+			name:   "ok",
+			status: StatusOk,
+		},
+		{
+			name:   "error",
+			err:    errors.New("boom"),
+			status: StatusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := ProviderRequests.WithLabelValues("test", tt.name, tt.status)
+			before := testutil.ToFloat64(counter)
+
+			ObserveProvider("test", tt.name, time.Now(), tt.err)
+
+			if got := testutil.ToFloat64(counter); got != before+1 {
+				t.Errorf("ObserveProvider() count = %v, want %v", got, before+1)
+			}
+		})
+	}
+}
+
+func TestTrackJob(t *testing.T) {
+	gauge := JobsInFlight.WithLabelValues("test")
+
+	done := TrackJob("test")
+	if got := testutil.ToFloat64(gauge); got != 1 {
+		t.Errorf("TrackJob() in flight = %v, want 1", got)
+	}
+
+	done()
+	if got := testutil.ToFloat64(gauge); got != 0 {
+		t.Errorf("TrackJob() in flight after done = %v, want 0", got)
+	}
+}
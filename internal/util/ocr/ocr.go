@@ -0,0 +1,107 @@
+package ocr
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/usual2970/retell/internal/domain"
+	"github.com/usual2970/retell/internal/util/llm"
+	"github.com/usual2970/retell/internal/util/str"
+)
+
+const prompt = `请识别图片中的全部文字, 按原文逐字输出, 保留原来的段落.
+不要翻译、总结或解释, 不要使用 Markdown, 不要输出图片中没有的内容. 图片中没有文字时不要输出任何内容.`
+
+// shortLine 短于段落中最长一行的这个比例时, 认为这一行是段落的结尾或者标题
+const shortLine = 0.6
+
+var instance domain.IOcr
+var once sync.Once
+
+// Default 使用默认大模型识别文字
+func Default() domain.IOcr {
+	once.Do(func() {
+		instance = New(llm.Default())
+	})
+	return instance
+}
+
+// New 调用多模态大模型识别图片中的文字
+func New(model domain.ILLM) domain.IOcr {
+	return &llmOcr{llm: model}
+}
+
+type llmOcr struct {
+	llm domain.ILLM
+}
+
+func (o *llmOcr) Recognize(ctx context.Context, image []byte, mimeType string) (string, error) {
+	text, err := o.llm.Vision(ctx, prompt, image, mimeType)
+	if err != nil {
+		return "", err
+	}
+	return Clean(text), nil
+}
+
+// Fake 返回固定结果, 用于测试和本地调试
+type Fake struct {
+	Text string
+	Err  error
+}
+
+func (f *Fake) Recognize(ctx context.Context, image []byte, mimeType string) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return Clean(f.Text), nil
+}
+
+var (
+	fence      = regexp.MustCompile("(?m)^```[a-z]*\\s*$")
+	pageNumber = regexp.MustCompile(`^\s*[-—]?\s*\d{1,4}\s*[-—]?\s*$`)
+	blank      = regexp.MustCompile(`\n\s*\n`)
+	spaces     = regexp.MustCompile(`[ \t\x{00a0}\x{3000}]+`)
+)
+
+// Clean 整理识别结果: 接上按版面折断的行和连字符断开的单词, 去掉页码
+func Clean(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = fence.ReplaceAllString(text, "")
+
+	blocks := blank.Split(strings.TrimSpace(text), -1)
+	rs := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block = mergeLines(block); block != "" {
+			rs = append(rs, block)
+		}
+	}
+	return strings.Join(rs, "\n\n")
+}
+
+// mergeLines 合并一段中的行, 明显较短的行后面另起一段
+func mergeLines(block string) string {
+	lines := make([]string, 0)
+	longest := 0
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+		if line == "" || pageNumber.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+		longest = max(longest, utf8.RuneCountInString(line))
+	}
+
+	sb := &strings.Builder{}
+	for i, line := range lines {
+		if i > 0 && float64(utf8.RuneCountInString(lines[i-1])) < float64(longest)*shortLine {
+			sb.WriteString("\n\n")
+			sb.WriteString(line)
+			continue
+		}
+		str.JoinLine(sb, line)
+	}
+	return sb.String()
+}
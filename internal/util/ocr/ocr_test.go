@@ -0,0 +1,101 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usual2970/retell/internal/domain"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "wrapped lines",
+			text: "The quick brown fox jumps over\nthe lazy dog and everyone in the\nvillage talked about it.",
+			want: "The quick brown fox jumps over the lazy dog and everyone in the village talked about it.",
+		},
+		{
+			name: "hyphenation",
+			text: "Scientists later con-\nfirmed that foxes can jump.",
+			want: "Scientists later confirmed that foxes can jump.",
+		},
+		{
+			name: "keep compound words",
+			text: "The meeting is scheduled for mid-\nJanuary next year, as usual.",
+			want: "The meeting is scheduled for mid-January next year, as usual.",
+		},
+		{
+			name: "short line ends paragraph",
+			text: "Unit 3\nThe quick brown fox jumps over the lazy dog,\nand everyone talked.\nNobody asked the dog what it thought about\nit, which was a mistake.",
+			want: "Unit 3\n\nThe quick brown fox jumps over the lazy dog, and everyone talked.\n\nNobody asked the dog what it thought about it, which was a mistake.",
+		},
+		{
+			name: "page number and fence",
+			text: "```\nFirst paragraph line.\n\n  12  \n\nSecond paragraph.\n```",
+			want: "First paragraph line.\n\nSecond paragraph.",
+		},
+		{
+			name: "chinese",
+			text: "敏捷的棕色狐狸跳过了\n那只懒狗。",
+			want: "敏捷的棕色狐狸跳过了那只懒狗。",
+		},
+		{
+			name: "empty",
+			text: " \n ",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Clean(tt.text); got != tt.want {
+				t.Errorf("Clean() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// visionLLM 只实现图片理解的大模型
+type visionLLM struct {
+	domain.ILLM
+	text string
+	err  error
+
+	mimeType string
+}
+
+func (v *visionLLM) Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error) {
+	v.mimeType = mimeType
+	return v.text, v.err
+}
+
+func TestLLM_Recognize(t *testing.T) {
+	model := &visionLLM{text: "Hello wor-\nld, nice to\nmeet you."}
+	got, err := New(model).Recognize(context.Background(), []byte("img"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Recognize() error = %v", err)
+	}
+	if want := "Hello world, nice to meet you."; got != want {
+		t.Errorf("Recognize() = %q, want %q", got, want)
+	}
+	if model.mimeType != "image/jpeg" {
+		t.Errorf("Recognize() mimeType = %q", model.mimeType)
+	}
+
+	wantErr := errors.New("quota exceeded")
+	if _, err := New(&visionLLM{err: wantErr}).Recognize(context.Background(), nil, "image/png"); !errors.Is(err, wantErr) {
+		t.Errorf("Recognize() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestFake_Recognize(t *testing.T) {
+	var o domain.IOcr = &Fake{Text: "Line one\nline two."}
+	got, err := o.Recognize(context.Background(), nil, "")
+	if err != nil || got != "Line one line two." {
+		t.Errorf("Recognize() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,352 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/usual2970/retell/internal/util/chat"
+	xhttp "github.com/usual2970/retell/internal/util/http"
+	"github.com/usual2970/retell/internal/util/logger"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// OpenAI 兼容 OpenAI 接口协议的服务, 如 OpenAI、llama.cpp server、Ollama 等
+
+const (
+	defaultBaseUrl = "https://api.openai.com/v1"
+
+	completionPath  = "/chat/completions"
+	embeddingPath   = "/embeddings"
+	generateImgPath = "/images/generations"
+)
+
+const (
+	defaultCompletionModel = "gpt-4o-mini"
+	defaultEmbeddingModel  = "text-embedding-3-small"
+	defaultImageModel      = "dall-e-3"
+	defaultVisionModel     = "gpt-4o-mini"
+)
+
+type Config struct {
+	BaseUrl        string
+	ApiKey         string
+	ChatModel      string
+	EmbeddingModel string
+	ImageModel     string
+	VisionModel    string
+}
+
+type OpenAI struct {
+	conf           *Config
+	defaultOptions []llms.CallOption
+}
+
+func New(conf *Config, options ...llms.CallOption) *OpenAI {
+	c := *conf
+	if c.BaseUrl == "" {
+		c.BaseUrl = defaultBaseUrl
+	}
+	c.BaseUrl = strings.TrimRight(c.BaseUrl, "/")
+	if c.ChatModel == "" {
+		c.ChatModel = defaultCompletionModel
+	}
+	if c.EmbeddingModel == "" {
+		c.EmbeddingModel = defaultEmbeddingModel
+	}
+	if c.ImageModel == "" {
+		c.ImageModel = defaultImageModel
+	}
+	if c.VisionModel == "" {
+		c.VisionModel = defaultVisionModel
+	}
+
+	return &OpenAI{
+		conf:           &c,
+		defaultOptions: options,
+	}
+}
+
+type completionReq struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	TopP        float64   `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Stop        []string  `json:"stop,omitempty"`
+	Tools       []Tool    `json:"tools,omitempty"`
+	ToolChoice  any       `json:"tool_choice,omitempty"`
+}
+
+type completionResp struct {
+	ID      string    `json:"id"`
+	Created int       `json:"created"`
+	Model   string    `json:"model"`
+	Choices []Choices `json:"choices"`
+	Usage   Usage     `json:"usage"`
+}
+
+type Choices struct {
+	Index        int     `json:"index"`
+	FinishReason string  `json:"finish_reason"`
+	Message      Message `json:"message"`
+}
+
+type Usage = chat.Usage
+
+type Message = chat.Message
+
+type ToolCall = chat.ToolCall
+
+type FunctionCall = chat.FunctionCall
+
+type Tool = chat.Tool
+
+type Function = chat.Function
+
+type embeddingReq struct {
+	Input []string `json:"input"`
+	Model string   `json:"model"`
+}
+
+type embeddingResp struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+type generateImgReq struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type generateImgResp struct {
+	Data []struct {
+		URL string `json:"url"`
+	} `json:"data"`
+}
+
+type apiErrorResp struct {
+	Error *apiError `json:"error"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("openai error type:%s,msg:%s", e.Type, e.Message)
+}
+
+func (o *OpenAI) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	generations, err := o.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)}, options...)
+	if err != nil {
+		return "", err
+	}
+	if len(generations.Choices) == 0 {
+		return "", errors.New("empty choices")
+	}
+	return generations.Choices[0].Content, nil
+}
+
+func (o *OpenAI) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	option := &llms.CallOptions{}
+	for _, opt := range o.defaultOptions {
+		opt(option)
+	}
+	for _, opt := range options {
+		opt(option)
+	}
+
+	if option.Model == "" {
+		option.Model = o.conf.ChatModel
+	}
+
+	req := &completionReq{
+		Model:       option.Model,
+		Messages:    chat.ToMessages(messages),
+		Temperature: option.Temperature,
+		TopP:        option.TopP,
+		MaxTokens:   option.MaxTokens,
+		Stop:        option.StopWords,
+	}
+	req.Tools, req.ToolChoice = chat.ToTools(option)
+
+	var (
+		temp *completionResp
+		err  error
+	)
+	if option.StreamingFunc != nil {
+		req.Stream = true
+		temp, err = o.stream(ctx, req, option.StreamingFunc)
+	} else {
+		temp = &completionResp{}
+		err = o.post(ctx, completionPath, req, temp)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("openai completion error:", "err", err, "model", req.Model, "stream", req.Stream)
+		return nil, err
+	}
+
+	choices := make([]*llms.ContentChoice, 0, len(temp.Choices))
+	for _, choice := range temp.Choices {
+		choices = append(choices, chat.ToContentChoice(choice.FinishReason, choice.Message))
+	}
+
+	return &llms.ContentResponse{
+		Choices: choices,
+	}, nil
+}
+
+// stream 以 SSE 方式请求, 每收到一段增量内容就回调 streamingFunc
+func (o *OpenAI) stream(ctx context.Context, req *completionReq, streamingFunc func(ctx context.Context, chunk []byte) error) (*completionResp, error) {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := xhttp.Stream(ctx, o.conf.BaseUrl+completionPath, http.MethodPost, bytes.NewReader(bts), o.header())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if apiErr := parseApiError(body); apiErr != nil {
+			return nil, apiErr
+		}
+		return nil, fmt.Errorf("openai stream status:%d,body:%s", resp.StatusCode, body)
+	}
+
+	rs, err := chat.Stream(ctx, resp.Body, nil, streamingFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &completionResp{ID: rs.ID, Created: rs.Created, Model: rs.Model, Usage: rs.Usage}
+	for _, choice := range rs.Choices {
+		out.Choices = append(out.Choices, Choices{
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+			Message:      Message{Role: "assistant", Content: choice.Content, ToolCalls: choice.ToolCalls},
+		})
+	}
+	return out, nil
+}
+
+func (o *OpenAI) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+
+	temp := &embeddingResp{}
+	if err := o.post(ctx, embeddingPath, &embeddingReq{
+		Input: texts,
+		Model: o.conf.EmbeddingModel,
+	}, temp); err != nil {
+		return nil, err
+	}
+
+	if len(temp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding count mismatch: want %d, got %d", len(texts), len(temp.Data))
+	}
+
+	rs := make([][]float32, len(texts))
+	for _, data := range temp.Data {
+		if data.Index < 0 || data.Index >= len(rs) {
+			return nil, fmt.Errorf("embedding index out of range: %d", data.Index)
+		}
+		rs[data.Index] = data.Embedding
+	}
+	return rs, nil
+}
+
+func (o *OpenAI) GenerateImg(ctx context.Context, prompt string) (string, error) {
+	temp := &generateImgResp{}
+	if err := o.post(ctx, generateImgPath, &generateImgReq{
+		Model:          o.conf.ImageModel,
+		Prompt:         prompt,
+		N:              1,
+		ResponseFormat: "url",
+	}, temp); err != nil {
+		return "", err
+	}
+
+	if len(temp.Data) == 0 || temp.Data[0].URL == "" {
+		return "", errors.New("生成图片失败")
+	}
+
+	return temp.Data[0].URL, nil
+}
+
+// Vision 让多模态模型按提示词处理图片, 图片以 data URL 的形式上传
+func (o *OpenAI) Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error) {
+	temp := &completionResp{}
+	if err := o.post(ctx, completionPath, &chat.VisionReq{
+		Model: o.conf.VisionModel,
+		Messages: []chat.VisionMessage{{
+			Role: "user",
+			Content: []chat.VisionPart{
+				{Type: "text", Text: prompt},
+				{Type: "image_url", ImageURL: &chat.VisionURL{URL: "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image)}},
+			},
+		}},
+	}, temp); err != nil {
+		return "", err
+	}
+
+	if len(temp.Choices) == 0 {
+		return "", errors.New("图片识别失败")
+	}
+	return temp.Choices[0].Message.Content, nil
+}
+
+func (o *OpenAI) header() map[string]string {
+	header := map[string]string{
+		"Content-Type": "application/json",
+	}
+	// 本地服务通常不需要鉴权
+	if o.conf.ApiKey != "" {
+		header["Authorization"] = "Bearer " + o.conf.ApiKey
+	}
+	return header
+}
+
+func (o *OpenAI) post(ctx context.Context, path string, body any, rs any) error {
+	bts, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := xhttp.ReqContext(ctx, o.conf.BaseUrl+path, http.MethodPost, bytes.NewReader(bts), o.header())
+	if err != nil {
+		return err
+	}
+
+	if apiErr := parseApiError(resp); apiErr != nil {
+		return apiErr
+	}
+
+	return json.Unmarshal(resp, rs)
+}
+
+func parseApiError(resp []byte) *apiError {
+	rs := &apiErrorResp{}
+	if err := json.Unmarshal(resp, rs); err != nil || rs.Error == nil {
+		return nil
+	}
+	return rs.Error
+}
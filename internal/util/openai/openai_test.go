@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/usual2970/retell/internal/util/chat"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case completionPath:
+			req := &completionReq{}
+			json.NewDecoder(r.Body).Decode(req)
+			if req.Model != "local-chat" {
+				t.Errorf("chat model = %v", req.Model)
+			}
+			w.Write([]byte(`{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"pong"}}]}`))
+		case embeddingPath:
+			req := &embeddingReq{}
+			json.NewDecoder(r.Body).Decode(req)
+			// 倒序返回, 验证按 index 归位
+			w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+		case generateImgPath:
+			w.Write([]byte(`{"error":{"message":"not supported","type":"invalid_request_error"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestOpenAI_Call(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	o := New(&Config{BaseUrl: srv.URL, ChatModel: "local-chat"})
+	got, err := o.Call(context.Background(), "ping")
+	if err != nil {
+		t.Fatalf("OpenAI.Call() error = %v", err)
+	}
+	if got != "pong" {
+		t.Errorf("OpenAI.Call() = %v, want pong", got)
+	}
+}
+
+func TestOpenAI_CreateEmbedding(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	o := New(&Config{BaseUrl: srv.URL})
+	got, err := o.CreateEmbedding(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("OpenAI.CreateEmbedding() error = %v", err)
+	}
+	if want := [][]float32{{1, 0}, {0, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenAI.CreateEmbedding() = %v, want %v", got, want)
+	}
+}
+
+func TestOpenAI_GenerateImg(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	o := New(&Config{BaseUrl: srv.URL})
+	if _, err := o.GenerateImg(context.Background(), "cat"); err == nil {
+		t.Errorf("OpenAI.GenerateImg() want error")
+	}
+}
+
+func TestOpenAI_Vision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &chat.VisionReq{}
+		json.NewDecoder(r.Body).Decode(req)
+		if req.Model != "local-vision" || len(req.Messages) != 1 || len(req.Messages[0].Content) != 2 {
+			t.Errorf("vision req = %+v", req)
+		}
+		if url := req.Messages[0].Content[1].ImageURL.URL; url != "data:image/png;base64,aW1n" {
+			t.Errorf("image url = %v", url)
+		}
+		w.Write([]byte(`{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"hello"}}]}`))
+	}))
+	defer srv.Close()
+
+	o := New(&Config{BaseUrl: srv.URL, VisionModel: "local-vision"})
+	got, err := o.Vision(context.Background(), "read", []byte("img"), "image/png")
+	if err != nil {
+		t.Fatalf("OpenAI.Vision() error = %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("OpenAI.Vision() = %v, want hello", got)
+	}
+}
@@ -39,6 +39,16 @@ func Err(e *core.RequestEvent, err error) error {
 	return e.JSON(http.StatusOK, rs)
 }
 
+// Unavailable 返回 503, 供部署平台的就绪探针识别
+func Unavailable(e *core.RequestEvent, data interface{}) error {
+	rs := &Response{
+		Code: http.StatusServiceUnavailable,
+		Msg:  "unavailable",
+		Data: data,
+	}
+	return e.JSON(http.StatusServiceUnavailable, rs)
+}
+
 func WecomVerifyUrl(e *core.RequestEvent, msg string) error {
 
 	return e.String(http.StatusOK, msg)
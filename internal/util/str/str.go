@@ -1,5 +1,11 @@
 package str
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 func IsString(i interface{}) bool {
 	_, ok := i.(string)
 	return ok
@@ -13,3 +19,75 @@ func IsNotEmptyString(i interface{}) bool {
 
 	return len(s) > 0
 }
+
+// Sentences 按句末标点和换行把文本切分成句子, 去掉空白句
+func Sentences(text string) []string {
+	rs := make([]string, 0)
+	runes := []rune(text)
+	start := 0
+
+	flush := func(end int) {
+		s := strings.TrimSpace(string(runes[start:end]))
+		if s != "" {
+			rs = append(rs, s)
+		}
+		start = end
+	}
+
+	for i, r := range runes {
+		switch r {
+		case '\n':
+			flush(i + 1)
+		case '.', '!', '?':
+			if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) {
+				flush(i + 1)
+			}
+		case '。', '！', '？':
+			flush(i + 1)
+		}
+	}
+	flush(len(runes))
+
+	return rs
+}
+
+// JoinLine 把按版面折断的一行接到 sb 后面: 连字符断开的单词直接接上,
+// 中日韩文字前后不加空格, 其他情况用空格隔开
+func JoinLine(sb *strings.Builder, line string) {
+	prev := sb.String()
+	switch {
+	case prev == "":
+	case hyphenated(prev) && unicode.IsLower(firstRune(line)):
+		// 单词被连字符断开, 去掉连字符直接接上
+		sb.Reset()
+		sb.WriteString(strings.TrimSuffix(prev, "-"))
+	case hyphenated(prev):
+		// 本来就带连字符的词, 如 mid-January
+	case isCJK(lastRune(prev)) || isCJK(firstRune(line)):
+	default:
+		sb.WriteString(" ")
+	}
+	sb.WriteString(line)
+}
+
+// hyphenated 结尾是紧跟在字母后面的连字符
+func hyphenated(s string) bool {
+	if !strings.HasSuffix(s, "-") {
+		return false
+	}
+	return unicode.IsLetter(lastRune(strings.TrimSuffix(s, "-")))
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || (unicode.IsPunct(r) && r > 0x3000)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
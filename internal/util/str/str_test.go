@@ -0,0 +1,70 @@
+package str
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "english",
+			text: "Hello world. How are you? I'm fine!",
+			want: []string{"Hello world.", "How are you?", "I'm fine!"},
+		},
+		{
+			name: "decimal and newline",
+			text: "It costs 3.5 dollars\nBuy it now.",
+			want: []string{"It costs 3.5 dollars", "Buy it now."},
+		},
+		{
+			name: "chinese",
+			text: "你好。今天天气不错！",
+			want: []string{"你好。", "今天天气不错！"},
+		},
+		{
+			name: "empty",
+			text: "  \n ",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sentences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{name: "english", lines: []string{"The quick brown", "fox jumps."}, want: "The quick brown fox jumps."},
+		{name: "broken word", lines: []string{"The quick bro-", "wn fox"}, want: "The quick brown fox"},
+		{name: "hyphenated word", lines: []string{"It was mid-", "January"}, want: "It was mid-January"},
+		{name: "dash after number", lines: []string{"Pages 3 -", "5"}, want: "Pages 3 - 5"},
+		{name: "chinese", lines: []string{"敏捷的棕色狐狸", "跳过了那只懒狗。"}, want: "敏捷的棕色狐狸跳过了那只懒狗。"},
+		{name: "chinese punctuation", lines: []string{"狐狸，", "fox"}, want: "狐狸，fox"},
+		{name: "japanese after english", lines: []string{"Tokyo", "東京"}, want: "Tokyo東京"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := &strings.Builder{}
+			for _, line := range tt.lines {
+				JoinLine(sb, line)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("JoinLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
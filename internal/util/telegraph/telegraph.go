@@ -83,6 +83,16 @@ func (t *Telegraph) CreatePage(title, content, imgUrl string) (*telegraph.Page,
 	return rs, nil
 }
 
+// Ping 获取一次账号信息, 检查 telegraph 服务是否可用
+func (t *Telegraph) Ping() error {
+	account, err := t.getAccount()
+	if err != nil {
+		return err
+	}
+	_, err = account.GetAccountInfo(telegraph.FieldShortName)
+	return err
+}
+
 func (t *Telegraph) getAccount() (*telegraph.Account, error) {
 
 	cache := newAccountCache()
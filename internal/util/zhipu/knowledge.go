@@ -1,23 +1,23 @@
 package zhipu
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"time"
-
-	xhttp "github.com/usual2970/retell/internal/util/http"
 
 	jsoniter "github.com/json-iterator/go"
 )
 
+// knowledge 智谱知识库应用, appId 为应用的 model-api id
 type knowledge struct {
 	apiKey string
+	appId  string
 }
 
-func NewKnowledge(apiKey string) *knowledge {
+func NewKnowledge(apiKey string, appId string) *knowledge {
 	return &knowledge{
 		apiKey: apiKey,
+		appId:  appId,
 	}
 }
 
@@ -46,7 +46,7 @@ type PromptItem struct {
 
 const baseUrl = "https://open.bigmodel.cn/api/llm-application/open"
 
-func (k *knowledge) Invoke(content string) (*KnowledgeInvokeResp, error) {
+func (k *knowledge) Invoke(ctx context.Context, content string) (*KnowledgeInvokeResp, error) {
 	req := &KnowledgeInvokeReq{
 
 		Prompt: []PromptItem{
@@ -57,21 +57,13 @@ func (k *knowledge) Invoke(content string) (*KnowledgeInvokeResp, error) {
 		},
 	}
 
-	url := fmt.Sprintf("%s/model-api/%s/invoke", baseUrl, "1764820437164064769")
-
-	reqBytes, _ := jsoniter.Marshal(req)
-
-	token, err := GenerateToken(k.apiKey, time.Hour*12)
-	if err != nil {
-		return nil, err
+	if k.appId == "" {
+		return nil, errors.New("knowledge app id is required")
 	}
 
-	header := map[string]string{
-		"Authorization": token,
-		"Content-Type":  "application/json",
-	}
+	url := fmt.Sprintf("%s/model-api/%s/invoke", baseUrl, k.appId)
 
-	resp, err := xhttp.Req(url, http.MethodPost, bytes.NewBuffer(reqBytes), header)
+	resp, err := request(ctx, k.apiKey, url, req)
 	if err != nil {
 		return nil, err
 	}
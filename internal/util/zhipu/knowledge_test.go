@@ -1,6 +1,7 @@
 package zhipu
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -8,6 +9,7 @@ import (
 func Test_knowledge_Invoke(t *testing.T) {
 	type fields struct {
 		apiKey string
+		appId  string
 	}
 	type args struct {
 		content string
@@ -23,6 +25,7 @@ func Test_knowledge_Invoke(t *testing.T) {
 			name: "1",
 			fields: fields{
 				apiKey: "7a909dd632f00f28a0d08efba999b3dc.50FHMHrklQIaaD16",
+				appId:  "1764820437164064769",
 			},
 			args: args{
 				content: "如何下载app",
@@ -34,8 +37,9 @@ func Test_knowledge_Invoke(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			k := &knowledge{
 				apiKey: tt.fields.apiKey,
+				appId:  tt.fields.appId,
 			}
-			got, err := k.Invoke(tt.args.content)
+			got, err := k.Invoke(context.Background(), tt.args.content)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("knowledge.Invoke() error = %v, wantErr %v", err, tt.wantErr)
 				return
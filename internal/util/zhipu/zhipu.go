@@ -3,37 +3,44 @@ package zhipu
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/usual2970/retell/internal/util/app"
+	"github.com/usual2970/retell/internal/util/chat"
 	xhttp "github.com/usual2970/retell/internal/util/http"
+	"github.com/usual2970/retell/internal/util/logger"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/schema"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
 )
 
 const (
-	embeddingUrl   = "https://open.bigmodel.cn/api/paas/v4/embeddings"
-	completionUrl  = "https://open.bigmodel.cn/api/paas/v4/chat/completions"
-	generateImgUrl = "https://open.bigmodel.cn/api/paas/v4/images/generations"
+	paasUrl = "https://open.bigmodel.cn/api/paas/v4"
+
+	embeddingPath   = "/embeddings"
+	completionPath  = "/chat/completions"
+	generateImgPath = "/images/generations"
 )
 
+const roleTypeUser llms.ChatMessageType = "user"
+
 const (
-	roleTypeUser schema.ChatMessageType = "user"
+	defaultCompletionModel = "GLM-4"
+	defaultEmbeddingModel  = "embedding-2"
+	defaultImageModel      = "cogview-3"
+	defaultVisionModel     = "glm-4v-flash"
 )
 
-const defaultCompletionModel = "GLM-4"
-
 type completionReq struct {
 	Model       string    `json:"model,omitempty"`
 	Messages    []Message `json:"messages,omitempty"`
@@ -45,7 +52,7 @@ type completionReq struct {
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	Stop        []string  `json:"stop,omitempty"`
 	Tools       []Tool    `json:"tools,omitempty"`
-	ToolChoice  string    `json:"tool_tool,omitempty"`
+	ToolChoice  any       `json:"tool_choice,omitempty"`
 }
 
 type completionResp struct {
@@ -58,10 +65,13 @@ type completionResp struct {
 }
 
 type embeddingReq struct {
-	Input string `json:"input"`
-	Model string `json:"model"`
+	Input []string `json:"input"`
+	Model string   `json:"model"`
 }
 
+// embeddingBatchSize 单次请求最多携带的文本数
+const embeddingBatchSize = 64
+
 type embeddingResp struct {
 	Model  string `json:"model"`
 	Data   []Data `json:"data"`
@@ -79,47 +89,33 @@ type Choices struct {
 	Index        int     `json:"index"`
 	Message      Message `json:"message"`
 }
-type Usage struct {
-	CompletionTokens int `json:"completion_tokens"`
-	PromptTokens     int `json:"prompt_tokens"`
-	TotalTokens      int `json:"total_tokens"`
-}
+type Usage = chat.Usage
 
-type Message struct {
-	Role       schema.ChatMessageType `json:"role"`
-	Content    string                 `json:"content"`
-	ToolCallId string                 `json:"tool_call_id"`
-	ToolCalls  []ToolCall             `json:"tool_calls"`
-}
+type Message = chat.Message
 
-type ToolCall struct {
-	ID       string       `json:"id"`
-	Index    int          `json:"index"`
-	Type     string       `json:"type"`
-	Function FunctionResp `json:"function"`
-}
-type FunctionResp struct {
-	Arguments string `json:"arguments"`
-	Name      string `json:"name"`
+type ToolCall = chat.ToolCall
+type FunctionResp = chat.FunctionCall
+
+type cachedToken struct {
+	token    string
+	expireAt time.Time
 }
 
-var cache *expirable.LRU[string, string]
+var cache *expirable.LRU[string, cachedToken]
 
 var cacheOnce sync.Once
 
-func newZhipuTokenCache() *expirable.LRU[string, string] {
+func newZhipuTokenCache() *expirable.LRU[string, cachedToken] {
 
 	cacheOnce.Do(func() {
-		cache = expirable.NewLRU[string, string](5, nil, time.Hour*defaultHour)
+		cache = expirable.NewLRU[string, cachedToken](16, nil, time.Hour*defaultHour)
 	})
 
 	return cache
 }
 
-type Tool struct {
-	Type     string   `json:"type"`
-	Function Function `json:"function"`
-}
+type Tool = chat.Tool
+
 type Property struct {
 	Type        string `json:"type"`
 	Description string `json:"description"`
@@ -130,14 +126,15 @@ type Parameters struct {
 	Properties map[string]Property `json:"properties"`
 	Required   []string            `json:"required"`
 }
-type Function struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Parameters  any    `json:"parameters"`
-}
+
+type Function = chat.Function
 
 type Zhipu struct {
 	apiKey         string
+	baseUrl        string
+	embeddingModel string
+	imageModel     string
+	visionModel    string
 	defaultOptions []llms.CallOption
 }
 
@@ -146,7 +143,62 @@ func NewZhipu(apiKey string, options ...llms.CallOption) *Zhipu {
 	return &Zhipu{
 		defaultOptions: options,
 		apiKey:         apiKey,
+		baseUrl:        paasUrl,
+		embeddingModel: defaultEmbeddingModel,
+		imageModel:     defaultImageModel,
+		visionModel:    defaultVisionModel,
+	}
+}
+
+// WithBaseUrl 替换接口地址, 为空时保持默认
+func (z *Zhipu) WithBaseUrl(url string) *Zhipu {
+	if url != "" {
+		z.baseUrl = strings.TrimRight(url, "/")
+	}
+	return z
+}
+
+// WithEmbeddingModel 设置向量模型, 为空时保持默认
+func (z *Zhipu) WithEmbeddingModel(model string) *Zhipu {
+	if model != "" {
+		z.embeddingModel = model
+	}
+	return z
+}
+
+// WithImageModel 设置图片生成模型, 为空时保持默认
+func (z *Zhipu) WithImageModel(model string) *Zhipu {
+	if model != "" {
+		z.imageModel = model
+	}
+	return z
+}
+
+// WithVisionModel 设置图片理解模型, 为空时保持默认
+func (z *Zhipu) WithVisionModel(model string) *Zhipu {
+	if model != "" {
+		z.visionModel = model
 	}
+	return z
+}
+
+func modelOrDefault(model, defaultModel string) string {
+	if model == "" {
+		return defaultModel
+	}
+	return model
+}
+
+func (z *Zhipu) url(path string) string {
+	if z.baseUrl == "" {
+		return paasUrl + path
+	}
+	return z.baseUrl + path
+}
+
+// post 发送请求, 鉴权失败时作废缓存的 token 并用新 token 重试一次
+func (z *Zhipu) post(ctx context.Context, path string, body any) ([]byte, error) {
+	return request(ctx, z.apiKey, z.url(path), body)
 }
 
 func (z *Zhipu) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
@@ -158,8 +210,6 @@ func (z *Zhipu) Call(ctx context.Context, prompt string, options ...llms.CallOpt
 }
 
 func (z *Zhipu) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
-	msg, _ := jsoniter.MarshalToString(messages)
-	println(msg)
 	option := &llms.CallOptions{}
 	for _, opt := range z.defaultOptions {
 		opt(option)
@@ -171,15 +221,6 @@ func (z *Zhipu) GenerateContent(ctx context.Context, messages []llms.MessageCont
 	if option.Model == "" {
 		option.Model = defaultCompletionModel
 	}
-	token, err := GenerateToken(z.apiKey, time.Hour*12)
-	if err != nil {
-		return nil, err
-	}
-
-	header := map[string]string{
-		"Authorization": token,
-		"Content-Type":  "application/json",
-	}
 
 	stopWrods := []string{}
 	if len(option.StopWords) > 0 {
@@ -188,115 +229,90 @@ func (z *Zhipu) GenerateContent(ctx context.Context, messages []llms.MessageCont
 
 	req := &completionReq{
 		Model:       option.Model,
-		Messages:    []Message{},
+		Messages:    chat.ToMessages(messages),
 		RequestId:   uuid.New().String(),
 		Temperature: option.Temperature,
 		TopP:        option.TopP,
+		MaxTokens:   option.MaxTokens,
 		Stop:        stopWrods,
 	}
-	for _, prompt := range messages {
-		content := ""
-		for _, part := range prompt.Parts {
-			switch t := part.(type) {
-			case llms.TextContent:
-				content += t.Text
-			}
-		}
+	req.Tools, req.ToolChoice = chat.ToTools(option)
 
-		defaultRoleType := roleTypeUser
-		switch prompt.Role {
-
-		case schema.ChatMessageTypeAI:
-			defaultRoleType = "assistant"
-		case schema.ChatMessageTypeSystem:
-			defaultRoleType = "system"
-		case schema.ChatMessageTypeHuman:
-			defaultRoleType = "user"
-		case schema.ChatMessageTypeFunction:
-			defaultRoleType = "user"
-		}
+	temp, err := z.complete(ctx, req, option.StreamingFunc)
+	if err != nil {
+		return nil, err
+	}
 
-		req.Messages = append(req.Messages, Message{
-			Role:    defaultRoleType,
-			Content: content,
-		})
+	choices := make([]*llms.ContentChoice, 0, len(temp.Choices))
+	for _, choice := range temp.Choices {
+		choices = append(choices, chat.ToContentChoice(choice.FinishReason, choice.Message))
 	}
 
-	if len(option.Functions) > 0 {
-		for _, function := range option.Functions {
-			req.Tools = append(req.Tools, Tool{
-				Type: "function",
-				Function: Function{
-					Name:        function.Name,
-					Description: function.Description,
-					Parameters:  function.Parameters,
-				},
-			})
-		}
+	return &llms.ContentResponse{
+		Choices: choices,
+	}, nil
 
-		req.ToolChoice = "auto"
+}
+
+func (z *Zhipu) complete(ctx context.Context, req *completionReq, streamingFunc func(ctx context.Context, chunk []byte) error) (*completionResp, error) {
+	if streamingFunc != nil {
+		req.Stream = true
+		return z.stream(ctx, req, streamingFunc)
 	}
 
-	bts, err := json.Marshal(req)
+	resp, err := z.post(ctx, completionPath, req)
 	if err != nil {
+		logger.FromContext(ctx).Error("zhipu completion error:", "err", err, "model", req.Model, "zhipu_request_id", req.RequestId)
 		return nil, err
 	}
-	resp, err := xhttp.Req(completionUrl, http.MethodPost, bytes.NewReader(bts), header)
-	app.Get().Logger().Info("zhipu resp", "req", string(bts), "resp", string(resp), "err", err)
-	if err != nil {
+
+	rs := &completionResp{}
+	if err := json.Unmarshal(resp, rs); err != nil {
 		return nil, err
 	}
+	logger.FromContext(ctx).Debug("zhipu completion", "model", req.Model, "zhipu_request_id", req.RequestId, "total_tokens", rs.Usage.TotalTokens)
+	return rs, nil
+}
 
-	temp := &completionResp{}
-
-	if err := json.Unmarshal(resp, temp); err != nil {
+// stream 以 SSE 方式请求, 每收到一段增量内容就回调 streamingFunc, 结束后返回拼接好的完整结果
+func (z *Zhipu) stream(ctx context.Context, req *completionReq, streamingFunc func(ctx context.Context, chunk []byte) error) (*completionResp, error) {
+	body, err := streamRequest(ctx, z.apiKey, z.url(completionPath), req)
+	if err != nil {
 		return nil, err
 	}
-	choices := make([]*llms.ContentChoice, 0)
-	for _, choice := range temp.Choices {
-		if len(choice.Message.ToolCalls) > 0 {
-			choices = append(choices, &llms.ContentChoice{
-				FuncCall: &schema.FunctionCall{
-					Name:      choice.Message.ToolCalls[0].Function.Name,
-					Arguments: choice.Message.ToolCalls[0].Function.Arguments,
-				},
-				StopReason: choice.FinishReason,
-				Content:    choice.Message.Content,
-			})
-			continue
+	defer body.Close()
+
+	rs, err := chat.Stream(ctx, body, func(data []byte) error {
+		if apiErr := parseApiError(data); apiErr != nil {
+			return apiErr
 		}
+		return nil
+	}, streamingFunc)
+	if err != nil {
+		return nil, err
+	}
 
-		choices = append(choices, &llms.ContentChoice{
-			StopReason: choice.FinishReason,
-			Content:    choice.Message.Content,
+	resp := &completionResp{ID: rs.ID, Created: rs.Created, Model: rs.Model, Usage: rs.Usage}
+	for _, choice := range rs.Choices {
+		resp.Choices = append(resp.Choices, Choices{
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+			Message:      Message{Role: "assistant", Content: choice.Content, ToolCalls: choice.ToolCalls},
 		})
 	}
-
-	return &llms.ContentResponse{
-		Choices: choices,
-	}, nil
-
+	return resp, nil
 }
 
+// CreateEmbedding 批量生成向量, 按 embeddingBatchSize 分批请求, 返回结果与 texts 一一对应
 func (z *Zhipu) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
-	token, err := GenerateToken(z.apiKey, time.Hour*12)
-	if err != nil {
-		return nil, err
-	}
+	rs := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch := texts[start:min(start+embeddingBatchSize, len(texts))]
 
-	header := map[string]string{
-		"Authorization": token,
-		"Content-Type":  "application/json",
-	}
-
-	rs := make([][]float32, 0)
-	for _, text := range texts {
-		req := &embeddingReq{
-			Input: text,
-			Model: "embedding-2",
-		}
-		bts, _ := json.Marshal(req)
-		resp, err := xhttp.Req(embeddingUrl, http.MethodPost, bytes.NewReader(bts), header)
+		resp, err := z.post(ctx, embeddingPath, &embeddingReq{
+			Input: batch,
+			Model: modelOrDefault(z.embeddingModel, defaultEmbeddingModel),
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -305,11 +321,16 @@ func (z *Zhipu) CreateEmbedding(ctx context.Context, texts []string) ([][]float3
 		if err := json.Unmarshal(resp, temp); err != nil {
 			return nil, err
 		}
+		if len(temp.Data) != len(batch) {
+			return nil, fmt.Errorf("embedding count mismatch: want %d, got %d", len(batch), len(temp.Data))
+		}
 
 		for _, data := range temp.Data {
-			rs = append(rs, data.Embedding)
+			if data.Index < 0 || data.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding index out of range: %d", data.Index)
+			}
+			rs[start+data.Index] = data.Embedding
 		}
-
 	}
 	return rs, nil
 }
@@ -327,23 +348,12 @@ type GenerateImgResp struct {
 }
 
 func (z *Zhipu) GenerateImg(ctx context.Context, prompt string) (string, error) {
-	token, err := GenerateToken(z.apiKey, time.Hour*12)
-	if err != nil {
-		return "", err
-	}
-
-	header := map[string]string{
-		"Authorization": token,
-		"Content-Type":  "application/json",
-	}
-
 	req := &GenerateImgReq{
-		Model:  "cogview-3",
+		Model:  modelOrDefault(z.imageModel, defaultImageModel),
 		Prompt: prompt,
 	}
 
-	bts, _ := json.Marshal(req)
-	resp, err := xhttp.Req(generateImgUrl, http.MethodPost, bytes.NewReader(bts), header)
+	resp, err := z.post(ctx, generateImgPath, req)
 	if err != nil {
 		return "", err
 	}
@@ -360,6 +370,34 @@ func (z *Zhipu) GenerateImg(ctx context.Context, prompt string) (string, error)
 	return temp.Data[0].URL, nil
 }
 
+// Vision 让图片理解模型按提示词处理图片, 图片以 base64 编码上传
+func (z *Zhipu) Vision(ctx context.Context, prompt string, image []byte, mimeType string) (string, error) {
+	req := &chat.VisionReq{
+		Model: modelOrDefault(z.visionModel, defaultVisionModel),
+		Messages: []chat.VisionMessage{{
+			Role: "user",
+			Content: []chat.VisionPart{
+				{Type: "image_url", ImageURL: &chat.VisionURL{URL: base64.StdEncoding.EncodeToString(image)}},
+				{Type: "text", Text: prompt},
+			},
+		}},
+	}
+
+	resp, err := z.post(ctx, completionPath, req)
+	if err != nil {
+		return "", err
+	}
+
+	temp := &completionResp{}
+	if err := json.Unmarshal(resp, temp); err != nil {
+		return "", err
+	}
+	if len(temp.Choices) == 0 {
+		return "", errors.New("图片识别失败")
+	}
+	return temp.Choices[0].Message.Content, nil
+}
+
 const (
 	defaultHour = 12
 )
@@ -370,17 +408,11 @@ type ZpClaims struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
-const tokenKey = "zpToken"
+// tokenRefreshMargin token 到期前提前刷新的时间, 避免请求途中过期
+const tokenRefreshMargin = 5 * time.Minute
 
 func GenerateToken(apiKey string, duration time.Duration) (string, error) {
 
-	cache := newZhipuTokenCache()
-
-	rs, ok := cache.Get(tokenKey)
-	if ok {
-		return rs, nil
-	}
-
 	if apiKey == "" {
 		return "", errors.New("密钥不能为空")
 	}
@@ -388,26 +420,143 @@ func GenerateToken(apiKey string, duration time.Duration) (string, error) {
 		return "", errors.New("密钥格式不正确")
 	}
 
-	apiKeyInfo := strings.Split(apiKey, ".")
-	key, secret := apiKeyInfo[0], apiKeyInfo[1]
-
 	if duration == 0 {
 		duration = defaultHour * time.Hour
 	}
 
+	cache := newZhipuTokenCache()
+
+	margin := min(tokenRefreshMargin, duration/2)
+	if rs, ok := cache.Get(apiKey); ok && time.Until(rs.expireAt) > margin {
+		return rs.token, nil
+	}
+
+	apiKeyInfo := strings.Split(apiKey, ".")
+	key, secret := apiKeyInfo[0], apiKeyInfo[1]
+
+	expireAt := time.Now().Add(duration)
 	token, err := createToken(ZpClaims{
 		key,
-		time.Now().Add(duration).Unix(),
+		expireAt.Unix(),
 		time.Now().Unix(),
 	}, secret)
 	if err != nil {
 		return "", err
 	}
 
-	cache.Add(tokenKey, token)
+	cache.Add(apiKey, cachedToken{token: token, expireAt: expireAt})
 	return token, nil
 }
 
+// InvalidateToken 作废指定密钥缓存的 token
+func InvalidateToken(apiKey string) {
+	newZhipuTokenCache().Remove(apiKey)
+}
+
+type apiErrorResp struct {
+	Error *apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("zhipu error code:%s,msg:%s", e.Code, e.Message)
+}
+
+// isAuthFailed 1000~1004 为鉴权相关的错误码
+func (e *apiError) isAuthFailed() bool {
+	switch e.Code {
+	case "1000", "1001", "1002", "1003", "1004":
+		return true
+	}
+	return false
+}
+
+func parseApiError(resp []byte) *apiError {
+	rs := &apiErrorResp{}
+	if err := json.Unmarshal(resp, rs); err != nil || rs.Error == nil || rs.Error.Code == "" {
+		return nil
+	}
+	return rs.Error
+}
+
+func request(ctx context.Context, apiKey string, url string, body any) ([]byte, error) {
+	bts, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := GenerateToken(apiKey, time.Hour*defaultHour)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := xhttp.ReqContext(ctx, url, http.MethodPost, bytes.NewReader(bts), map[string]string{
+			"Authorization": token,
+			"Content-Type":  "application/json",
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		apiErr := parseApiError(resp)
+		if apiErr == nil {
+			return resp, nil
+		}
+		if !apiErr.isAuthFailed() || attempt > 0 {
+			return nil, apiErr
+		}
+
+		logger.FromContext(ctx).Warn("zhipu auth failed, retry with new token", "code", apiErr.Code)
+		InvalidateToken(apiKey)
+	}
+}
+
+// streamRequest 发送流式请求并返回响应体, 鉴权失败时与 request 一样重试一次
+func streamRequest(ctx context.Context, apiKey string, url string, body any) (io.ReadCloser, error) {
+	bts, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := GenerateToken(apiKey, time.Hour*defaultHour)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := xhttp.Stream(ctx, url, http.MethodPost, bytes.NewReader(bts), map[string]string{
+			"Authorization": token,
+			"Content-Type":  "application/json",
+			"Accept":        "text/event-stream",
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+
+		errBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		apiErr := parseApiError(errBody)
+		if apiErr == nil {
+			return nil, fmt.Errorf("zhipu stream status:%d,body:%s", resp.StatusCode, errBody)
+		}
+		if !apiErr.isAuthFailed() || attempt > 0 {
+			return nil, apiErr
+		}
+
+		logger.FromContext(ctx).Warn("zhipu auth failed, retry with new token", "code", apiErr.Code)
+		InvalidateToken(apiKey)
+	}
+}
+
 // createToken 生成一个token.
 func createToken(claims ZpClaims, secret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -2,8 +2,15 @@ package zhipu
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tmc/langchaingo/llms"
 )
@@ -138,3 +145,262 @@ func TestZhipu_GenerateImg(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateToken(t *testing.T) {
+	first, err := GenerateToken("key1.secret1", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		duration time.Duration
+		wantSame bool
+		wantErr  bool
+	}{
+		{
+			name:     "same key is cached",
+			apiKey:   "key1.secret1",
+			duration: time.Hour,
+			wantSame: true,
+		},
+		{
+			name:     "different key",
+			apiKey:   "key2.secret2",
+			duration: time.Hour,
+		},
+		{
+			name:    "invalid key",
+			apiKey:  "invalid",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateToken(tt.apiKey, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GenerateToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == first) != tt.wantSame {
+				t.Errorf("GenerateToken() = %v, first %v, wantSame %v", got, first, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestGenerateToken_refreshBeforeExpiry(t *testing.T) {
+	apiKey := "key3.secret3"
+	newZhipuTokenCache().Add(apiKey, cachedToken{
+		token:    "stale",
+		expireAt: time.Now().Add(time.Minute),
+	})
+
+	got, err := GenerateToken(apiKey, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if got == "stale" {
+		t.Errorf("GenerateToken() returned a token about to expire")
+	}
+}
+
+func TestZhipu_GenerateImg_retryOnAuthFailed(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"1002","message":"Authorization Token非法"}}`))
+			return
+		}
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/a.png"}]}`))
+	}))
+	defer srv.Close()
+
+	z := &Zhipu{
+		apiKey:  "key4.secret4",
+		baseUrl: srv.URL,
+	}
+	got, err := z.GenerateImg(context.Background(), "cat")
+	if err != nil {
+		t.Fatalf("Zhipu.GenerateImg() error = %v", err)
+	}
+	if got != "https://example.com/a.png" {
+		t.Errorf("Zhipu.GenerateImg() = %v", got)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestZhipu_GenerateContent_stream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &completionReq{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || !req.Stream {
+			t.Errorf("stream request = %+v, err %v", req, err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, data := range []string{
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":", "}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"world"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":3,"total_tokens":4}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	z := &Zhipu{
+		apiKey:  "key5.secret5",
+		baseUrl: srv.URL,
+	}
+
+	chunks := make([]string, 0)
+	got, err := z.GenerateContent(context.Background(), []llms.MessageContent{llms.TextParts(roleTypeUser, "hi")},
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			chunks = append(chunks, string(chunk))
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("Zhipu.GenerateContent() error = %v", err)
+	}
+
+	if want := []string{"Hello", ", ", "world"}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %v, want %v", chunks, want)
+	}
+	if len(got.Choices) != 1 || got.Choices[0].Content != "Hello, world" || got.Choices[0].StopReason != "stop" {
+		t.Errorf("Zhipu.GenerateContent() = %+v", got.Choices[0])
+	}
+}
+
+func TestZhipu_GenerateContent_streamAbort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"b\"}}]}\n\n")
+	}))
+	defer srv.Close()
+
+	z := &Zhipu{
+		apiKey:  "key5.secret5",
+		baseUrl: srv.URL,
+	}
+
+	abort := errors.New("abort")
+	_, err := z.GenerateContent(context.Background(), []llms.MessageContent{llms.TextParts(roleTypeUser, "hi")},
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return abort
+		}))
+	if !errors.Is(err, abort) {
+		t.Errorf("Zhipu.GenerateContent() error = %v, want %v", err, abort)
+	}
+}
+
+func TestZhipu_GenerateContent_toolCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["tool_choice"] != "auto" {
+			t.Errorf("tool_choice = %v", req["tool_choice"])
+		}
+
+		messages := req["messages"].([]any)
+		if len(messages) != 4 {
+			t.Fatalf("messages = %v", messages)
+		}
+		assistant := messages[1].(map[string]any)
+		if calls := assistant["tool_calls"].([]any); len(calls) != 2 {
+			t.Errorf("assistant tool_calls = %v", calls)
+		}
+		for i, id := range []string{"call_1", "call_2"} {
+			tool := messages[2+i].(map[string]any)
+			if tool["role"] != "tool" || tool["tool_call_id"] != id {
+				t.Errorf("tool message %d = %v", i, tool)
+			}
+		}
+
+		w.Write([]byte(`{"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[
+			{"id":"call_3","index":0,"type":"function","function":{"name":"find_essay","arguments":"{\"keyword\":\"a\"}"}},
+			{"id":"call_4","index":1,"type":"function","function":{"name":"review_stats","arguments":"{}"}}
+		]}}]}`))
+	}))
+	defer srv.Close()
+
+	z := &Zhipu{
+		apiKey:  "key6.secret6",
+		baseUrl: srv.URL,
+	}
+
+	call := func(id, name string) llms.ToolCall {
+		return llms.ToolCall{ID: id, Type: "function", FunctionCall: &llms.FunctionCall{Name: name, Arguments: "{}"}}
+	}
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hi"),
+		{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{call("call_1", "lookup_word"), call("call_2", "review_stats")}},
+		{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{
+			llms.ToolCallResponse{ToolCallID: "call_1", Name: "lookup_word", Content: "apple"},
+			llms.ToolCallResponse{ToolCallID: "call_2", Name: "review_stats", Content: "3"},
+		}},
+	}
+	tools := []llms.Tool{{Type: "function", Function: &llms.FunctionDefinition{Name: "find_essay"}}}
+
+	got, err := z.GenerateContent(context.Background(), messages, llms.WithTools(tools))
+	if err != nil {
+		t.Fatalf("Zhipu.GenerateContent() error = %v", err)
+	}
+
+	choice := got.Choices[0]
+	if len(choice.ToolCalls) != 2 || choice.ToolCalls[1].ID != "call_4" || choice.ToolCalls[1].FunctionCall.Name != "review_stats" {
+		t.Errorf("tool calls = %+v", choice.ToolCalls)
+	}
+	if choice.FuncCall == nil || choice.FuncCall.Name != "find_essay" {
+		t.Errorf("func call = %+v", choice.FuncCall)
+	}
+}
+
+func TestZhipu_CreateEmbedding_batch(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		req := &embeddingReq{}
+		json.NewDecoder(r.Body).Decode(req)
+
+		rs := &embeddingResp{}
+		for i, text := range req.Input {
+			rs.Data = append(rs.Data, Data{Index: i, Embedding: []float32{float32(len(text))}})
+		}
+		json.NewEncoder(w).Encode(rs)
+	}))
+	defer srv.Close()
+
+	texts := make([]string, embeddingBatchSize+6)
+	for i := range texts {
+		texts[i] = strings.Repeat("a", i)
+	}
+
+	z := &Zhipu{
+		apiKey:  "key7.secret7",
+		baseUrl: srv.URL,
+	}
+	got, err := z.CreateEmbedding(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Zhipu.CreateEmbedding() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+	for i, vec := range got {
+		if len(vec) != 1 || vec[0] != float32(i) {
+			t.Errorf("embedding %d = %v", i, vec)
+		}
+	}
+}
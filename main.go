@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/usual2970/retell/internal/cmd"
 	"github.com/usual2970/retell/internal/routes"
 	"github.com/usual2970/retell/internal/util/app"
 
@@ -28,6 +29,9 @@ func main() {
 		Automigrate: isGoRun,
 	})
 
+	// retell essays export/import 备份和迁移文章库
+	app.RootCmd.AddCommand(cmd.NewEssaysCommand())
+
 	app.OnRecordCreateRequest("essay").BindFunc(func(e *core.RecordRequestEvent) error {
 		return routes.OnessayCreate(e)
 	})
@@ -44,6 +48,12 @@ func main() {
 		return e.Next()
 	})
 
+	// 收到 SIGTERM 等信号时先处理完手头的更新和后台任务
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		routes.UnRegister()
+		return e.Next()
+	})
+
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
 	}
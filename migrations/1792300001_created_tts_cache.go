@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("tts_cache")
+
+		collection.Fields.Add(
+			&core.TextField{Name: "key", Required: true},
+			&core.TextField{Name: "provider"},
+			&core.TextField{Name: "voice"},
+			&core.TextField{Name: "rate"},
+			&core.FileField{Name: "file", MaxSelect: 1, MaxSize: 50 << 20},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_tts_cache_key", true, "`key`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("tts_cache")
+		if err != nil {
+			return nil
+		}
+
+		return app.Delete(collection)
+	})
+}
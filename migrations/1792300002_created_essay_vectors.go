@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		essay, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		collection := core.NewBaseCollection("essay_vectors")
+
+		collection.Fields.Add(
+			&core.RelationField{Name: "essay", CollectionId: essay.Id, MaxSelect: 1, CascadeDelete: true, Required: true},
+			&core.SelectField{Name: "kind", Values: []string{"essay", "sentence"}, MaxSelect: 1, Required: true},
+			&core.NumberField{Name: "position", OnlyInt: true},
+			&core.TextField{Name: "text"},
+			&core.JSONField{Name: "vector"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_essay_vectors_essay", false, "`essay`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay_vectors")
+		if err != nil {
+			return nil
+		}
+
+		return app.Delete(collection)
+	})
+}
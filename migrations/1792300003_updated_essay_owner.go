@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		// 机器人添加的文章没有所属用户, 因此不设为必填
+		collection.Fields.Add(&core.RelationField{Name: "user", CollectionId: users.Id, MaxSelect: 1, CascadeDelete: true})
+		collection.AddIndex("idx_essay_user", false, "`user`", "")
+
+		// 用户只能读取自己的文章, 写操作必须经过 /api/v1/essays
+		collection.ListRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id")
+		collection.ViewRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id")
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("user")
+		collection.RemoveIndex("idx_essay_user")
+
+		collection.ListRule = types.Pointer("")
+		collection.ViewRule = types.Pointer("")
+		collection.CreateRule = types.Pointer("")
+		collection.UpdateRule = types.Pointer("")
+		collection.DeleteRule = types.Pointer("")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		// 在机器人里查看文章时更新, 用于按最久未学习排序
+		collection.Fields.Add(&core.DateField{Name: "studied_at"})
+		collection.AddIndex("idx_essay_studied_at", false, "`studied_at`", "")
+		collection.AddIndex("idx_essay_title", false, "`title`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("studied_at")
+		collection.RemoveIndex("idx_essay_studied_at")
+		collection.RemoveIndex("idx_essay_title")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		// 和 words 一样软删除, 回收站里的文章定期清理
+		collection.Fields.Add(&core.DateField{Name: "deleted"})
+		collection.AddIndex("idx_essay_deleted", false, "`deleted`", "")
+
+		collection.ListRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id && deleted = ''")
+		collection.ViewRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id && deleted = ''")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("deleted")
+		collection.RemoveIndex("idx_essay_deleted")
+
+		collection.ListRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id")
+		collection.ViewRule = types.Pointer("@request.auth.id != '' && user = @request.auth.id")
+
+		return app.Save(collection)
+	})
+}
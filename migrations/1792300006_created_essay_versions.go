@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		essay, err := app.FindCollectionByNameOrId("essay")
+		if err != nil {
+			return err
+		}
+
+		// 每次修改标题或内容前保存一份旧版本, 可以随时恢复
+		collection := core.NewBaseCollection("essay_versions")
+
+		collection.Fields.Add(
+			&core.RelationField{Name: "essay", CollectionId: essay.Id, MaxSelect: 1, CascadeDelete: true, Required: true},
+			&core.TextField{Name: "title"},
+			&core.TextField{Name: "content"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_essay_versions_essay", false, "`essay`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("essay_versions")
+		if err != nil {
+			return nil
+		}
+
+		return app.Delete(collection)
+	})
+}
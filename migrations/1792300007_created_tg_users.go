@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// 机器人用户的个人设置, 按 Telegram 用户 id 保存
+		collection := core.NewBaseCollection("tg_users")
+
+		collection.Fields.Add(
+			&core.NumberField{Name: "tg_id", Required: true, OnlyInt: true},
+			&core.TextField{Name: "language"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_tg_users_tg_id", true, "`tg_id`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("tg_users")
+		if err != nil {
+			return nil
+		}
+
+		return app.Delete(collection)
+	})
+}